@@ -6,18 +6,21 @@ import (
 	"io"
 	"log"
 	"os"
-	"time"
 
 	"github.com/man-on-box/litepage"
 )
 
 func main() {
-	lp, err := litepage.New("example.dev", litepage.WithBasePath("/litepage"))
+	lp, err := litepage.New("example.dev",
+		litepage.WithBasePath("/litepage"),
+		litepage.WithBasePathRewrite(),
+		litepage.WithFingerprint(),
+	)
 	if err != nil {
 		log.Fatalf("Could not create app: %v", err)
 	}
 
-	lp.Page("/index.html", handleHomepage())
+	lp.Page("/index.html", handleHomepage(lp))
 
 	err = lp.BuildOrServe()
 	if err != nil {
@@ -25,7 +28,7 @@ func main() {
 	}
 }
 
-func handleHomepage() func(w io.Writer) {
+func handleHomepage(lp litepage.Litepage) func(w io.Writer) {
 	data := struct {
 		Title     string `json:"title"`
 		Header    string `json:"header"`
@@ -34,6 +37,7 @@ func handleHomepage() func(w io.Writer) {
 	}{}
 	parseJSONFile("./content/homepage.json", &data)
 
+	tmpl := template.New("").Funcs(lp.TemplateFuncs())
 	t := template.Must(tmpl.ParseFiles("./view/base.html", "./view/home.html"))
 
 	return func(w io.Writer) {
@@ -45,12 +49,6 @@ func handleHomepage() func(w io.Writer) {
 
 }
 
-var tmpl = template.New("").Funcs(template.FuncMap{
-	"version": func() string {
-		return time.Now().Format("01021504")
-	},
-})
-
 func parseJSONFile(file string, data any) {
 	f, err := os.Open(file)
 	if err != nil {
@@ -0,0 +1,209 @@
+package asset
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/model"
+)
+
+// ManifestPath is where the manifest of fingerprinted files is written in the built site.
+const ManifestPath = "/asset-manifest.json"
+
+const hashLength = 8
+
+// hashedName matches the hash added to a file name, like the '.3f2a9c1b' in
+// 'styles.3f2a9c1b.css'.
+var hashedName = regexp.MustCompile(`\.[0-9a-f]{8}(\.[^./]+)$`)
+
+// Manifest maps the path of public files to the path of their fingerprinted copy.
+type Manifest map[string]string
+
+// JSON returns the manifest as indented JSON, with paths sorted.
+func (m Manifest) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Fingerprinter names public files after a hash of their contents, so that they
+// can be cached forever by browsers. Hashes are recomputed when files change.
+// The transforms, if any, are applied before hashing, for files such as bundles
+// whose contents come from other files, listed by deps.
+type Fingerprinter struct {
+	extensions map[string]bool
+	hashes     *hashCache
+}
+
+func NewFingerprinter(public fs.FS, extensions []string, transforms []model.Transform, deps model.Deps) *Fingerprinter {
+	exts := map[string]bool{}
+	for _, ext := range extensions {
+		exts[ext] = true
+	}
+	return &Fingerprinter{extensions: exts, hashes: newHashCache(public, transforms, deps, sha256Hex)}
+}
+
+// Fingerprints reports whether files with the extension of the path are fingerprinted.
+func (f *Fingerprinter) Fingerprints(filePath string) bool {
+	return f.extensions[path.Ext(filePath)]
+}
+
+// Lookup returns the fingerprinted path of the public file, such as
+// '/styles.3f2a9c1b.css' for '/styles.css'. Files that are not fingerprinted
+// are returned as they are.
+func (f *Fingerprinter) Lookup(filePath string) (string, error) {
+	if !f.Fingerprints(filePath) {
+		return filePath, nil
+	}
+	sum, err := f.hashes.get(filePath)
+	if err != nil {
+		return "", fmt.Errorf("could not fingerprint '%s': %w", filePath, err)
+	}
+	ext := path.Ext(filePath)
+	return strings.TrimSuffix(filePath, ext) + "." + sum[:hashLength] + ext, nil
+}
+
+// Resolve returns the public file a fingerprinted path was named after. The hash
+// is not checked, so that pages rendered before a file changed still load it.
+func (f *Fingerprinter) Resolve(hashedPath string) (string, bool) {
+	if !hashedName.MatchString(hashedPath) {
+		return "", false
+	}
+	filePath := hashedName.ReplaceAllString(hashedPath, "$1")
+	if !f.Fingerprints(filePath) {
+		return "", false
+	}
+	if !file.IsFile(f.hashes.files, filePath) {
+		return "", false
+	}
+	return filePath, true
+}
+
+// Manifest returns the fingerprinted path of every public file that is fingerprinted.
+func (f *Fingerprinter) Manifest() (Manifest, error) {
+	manifest := Manifest{}
+	err := file.WalkFiles(f.hashes.files, func(filePath string) error {
+		if !f.Fingerprints(filePath) {
+			return nil
+		}
+		hashed, err := f.Lookup(filePath)
+		if err != nil {
+			return err
+		}
+		manifest[filePath] = hashed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+type cached struct {
+	stamp string
+	hash  string
+}
+
+// hashCache hashes the files of a file system, and remembers each hash until the
+// size or modification time of the file, or of the files it depends on, changes.
+// Files are hashed once the transforms are applied, if any.
+type hashCache struct {
+	files      fs.FS
+	transforms []model.Transform
+	deps       model.Deps
+	hash       func(r io.Reader) (string, error)
+
+	mu      sync.Mutex
+	entries map[string]cached
+}
+
+func newHashCache(files fs.FS, transforms []model.Transform, deps model.Deps, hash func(r io.Reader) (string, error)) *hashCache {
+	return &hashCache{files: files, transforms: transforms, deps: deps, hash: hash, entries: map[string]cached{}}
+}
+
+func (c *hashCache) get(filePath string) (string, error) {
+	name := file.FSPath(filePath)
+	info, err := fs.Stat(c.files, name)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("'%s' is a directory", filePath)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[filePath]; ok && e.stamp == c.stamp(filePath, info) {
+		return e.hash, nil
+	}
+
+	var hash string
+	if len(c.transforms) == 0 {
+		hash, err = c.hashFile(name)
+	} else {
+		var contents []byte
+		contents, err = fs.ReadFile(c.files, name)
+		for _, t := range c.transforms {
+			if err != nil {
+				break
+			}
+			contents, err = t(filePath, contents)
+		}
+		if err == nil {
+			hash, err = c.hash(bytes.NewReader(contents))
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	// the dependencies are known once the transforms ran
+	c.entries[filePath] = cached{stamp: c.stamp(filePath, info), hash: hash}
+	return hash, nil
+}
+
+// stamp describes the version of the file and of the files it depends on, from
+// their size and modification time.
+func (c *hashCache) stamp(filePath string, info fs.FileInfo) string {
+	stamp := fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+	if c.deps == nil {
+		return stamp
+	}
+	for _, dep := range c.deps(filePath) {
+		depInfo, err := fs.Stat(c.files, file.FSPath(dep))
+		if err != nil {
+			stamp += " " + dep + ":missing"
+			continue
+		}
+		stamp += fmt.Sprintf(" %s:%d:%d", dep, depInfo.ModTime().UnixNano(), depInfo.Size())
+	}
+	return stamp
+}
+
+func (c *hashCache) hashFile(name string) (string, error) {
+	f, err := c.files.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return c.hash(f)
+}
+
+func sha256Hex(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
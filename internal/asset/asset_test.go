@@ -0,0 +1,164 @@
+package asset_test
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/man-on-box/litepage/internal/asset"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprinter(t *testing.T) {
+	publicDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(publicDir, "js"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "styles.css"), []byte("body { color: red; }"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "js", "app.js"), []byte("console.log('hi')"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "robots.txt"), []byte("User-agent: *"), 0644))
+
+	f := asset.NewFingerprinter(os.DirFS(publicDir), []string{".css", ".js"}, nil, nil)
+
+	t.Run("Looks up the fingerprinted path of a file", func(t *testing.T) {
+		hashed, err := f.Lookup("/styles.css")
+		assert.NoError(t, err)
+		assert.Regexp(t, `^/styles\.[0-9a-f]{8}\.css$`, hashed)
+
+		again, err := f.Lookup("/styles.css")
+		assert.NoError(t, err)
+		assert.Equal(t, hashed, again)
+	})
+
+	t.Run("Returns files that are not fingerprinted as they are", func(t *testing.T) {
+		p, err := f.Lookup("/robots.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "/robots.txt", p)
+	})
+
+	t.Run("Returns an error for a missing file", func(t *testing.T) {
+		_, err := f.Lookup("/missing.css")
+		assert.Error(t, err)
+	})
+
+	t.Run("Changes the fingerprint when the file changes", func(t *testing.T) {
+		file := filepath.Join(publicDir, "js", "app.js")
+		before, err := f.Lookup("/js/app.js")
+		assert.NoError(t, err)
+
+		assert.NoError(t, os.WriteFile(file, []byte("console.log('changed')"), 0644))
+		later := time.Now().Add(time.Second)
+		assert.NoError(t, os.Chtimes(file, later, later))
+
+		after, err := f.Lookup("/js/app.js")
+		assert.NoError(t, err)
+		assert.NotEqual(t, before, after)
+	})
+
+	t.Run("Resolves a fingerprinted path to its file", func(t *testing.T) {
+		hashed, err := f.Lookup("/styles.css")
+		assert.NoError(t, err)
+
+		p, ok := f.Resolve(hashed)
+		assert.True(t, ok)
+		assert.Equal(t, "/styles.css", p)
+
+		_, ok = f.Resolve("/styles.css")
+		assert.False(t, ok)
+		_, ok = f.Resolve("/missing.0123abcd.css")
+		assert.False(t, ok)
+		_, ok = f.Resolve("/robots.0123abcd.txt")
+		assert.False(t, ok)
+	})
+
+	t.Run("Creates a manifest of fingerprinted files", func(t *testing.T) {
+		manifest, err := f.Manifest()
+		assert.NoError(t, err)
+		assert.Len(t, manifest, 2)
+		assert.Regexp(t, `^/styles\.[0-9a-f]{8}\.css$`, manifest["/styles.css"])
+		assert.Regexp(t, `^/js/app\.[0-9a-f]{8}\.js$`, manifest["/js/app.js"])
+
+		data, err := manifest.JSON()
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), `"/styles.css": "`+manifest["/styles.css"]+`"`)
+	})
+}
+
+func TestIntegrity(t *testing.T) {
+	publicDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "styles.css"), []byte("body { color: red; }"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "app.js"), []byte("console.log('hi')"), 0644))
+
+	integrity := asset.NewIntegrity(os.DirFS(publicDir), nil, nil)
+	digest := func(contents string) string {
+		sum := sha512.Sum384([]byte(contents))
+		return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+	styles := digest("body { color: red; }")
+	app := digest("console.log('hi')")
+
+	t.Run("Computes the integrity of a file", func(t *testing.T) {
+		value, err := integrity.Lookup("/styles.css")
+		assert.NoError(t, err)
+		assert.Equal(t, styles, value)
+
+		_, err = integrity.Lookup("/missing.css")
+		assert.Error(t, err)
+	})
+
+	fingerprints := asset.NewFingerprinter(os.DirFS(publicDir), []string{".js"}, nil, nil)
+	hashedApp, err := fingerprints.Lookup("/app.js")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		basePath string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Adds integrity to scripts and stylesheets",
+			input:    `<link rel="stylesheet" href="/styles.css"><script src="/app.js"></script>`,
+			expected: `<link integrity="` + styles + `" rel="stylesheet" href="/styles.css"><script integrity="` + app + `" src="/app.js"></script>`,
+		},
+		{
+			name:     "Adds integrity to preloads",
+			input:    `<link rel="modulepreload" href="/app.js" /><LINK REL="Preload" href="/styles.css">`,
+			expected: `<link integrity="` + app + `" rel="modulepreload" href="/app.js" /><LINK integrity="` + styles + `" REL="Preload" href="/styles.css">`,
+		},
+		{
+			name:     "Resolves the base path and fingerprinted names",
+			basePath: "/base",
+			input:    `<script src="/base` + hashedApp + `?v=1"></script>`,
+			expected: `<script integrity="` + app + `" src="/base` + hashedApp + `?v=1"></script>`,
+		},
+		{
+			name:     "Leaves other tags and URLs as they are",
+			input:    `<link rel="icon" href="/styles.css"><script src="https://cdn.test/app.js"></script><script src="app.js"></script><script>inline()</script><img src="/app.js">`,
+			expected: `<link rel="icon" href="/styles.css"><script src="https://cdn.test/app.js"></script><script src="app.js"></script><script>inline()</script><img src="/app.js">`,
+		},
+		{
+			name:     "Leaves tags with integrity and missing files as they are",
+			input:    `<script integrity="sha256-abc" src="/app.js"></script><script src="/missing.js"></script>`,
+			expected: `<script integrity="sha256-abc" src="/app.js"></script><script src="/missing.js"></script>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transform := asset.IntegrityTransform(integrity, fingerprints, tt.basePath)
+			output, err := transform("/index.html", []byte(tt.input))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(output))
+		})
+	}
+
+	t.Run("Leaves pages that are not html as they are", func(t *testing.T) {
+		transform := asset.IntegrityTransform(integrity, nil, "")
+		input := `<script src="/app.js"></script>`
+		output, err := transform("/feed.xml", []byte(input))
+		assert.NoError(t, err)
+		assert.Equal(t, input, string(output))
+	})
+}
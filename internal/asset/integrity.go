@@ -0,0 +1,132 @@
+package asset
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"strings"
+
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/markup"
+	"github.com/man-on-box/litepage/internal/model"
+	"github.com/man-on-box/litepage/internal/rewrite"
+)
+
+// Integrity computes the Subresource Integrity digests of public files, which
+// browsers check before running a script or applying a stylesheet. Digests are
+// computed from files as they are shipped, once the transforms are applied, and
+// recomputed when the files listed by deps change.
+type Integrity struct {
+	hashes *hashCache
+}
+
+func NewIntegrity(public fs.FS, transforms []model.Transform, deps model.Deps) *Integrity {
+	return &Integrity{hashes: newHashCache(public, transforms, deps, sha384Base64)}
+}
+
+// Lookup returns the integrity of the public file, such as 'sha384-oqVuAfXR...'.
+func (i *Integrity) Lookup(filePath string) (string, error) {
+	digest, err := i.hashes.get(filePath)
+	if err != nil {
+		return "", fmt.Errorf("could not compute integrity of '%s': %w", filePath, err)
+	}
+	return "sha384-" + digest, nil
+}
+
+// integrityRels are the link relations that load a resource browsers check the integrity of.
+var integrityRels = map[string]bool{
+	"stylesheet":    true,
+	"preload":       true,
+	"modulepreload": true,
+}
+
+// IntegrityTransform returns a transform that adds an integrity attribute to the
+// script and link tags of html pages that load a public file. Fingerprinted URLs
+// are resolved with the fingerprinter, if set. Tags that already have an
+// integrity attribute are left as they are.
+func IntegrityTransform(integrity *Integrity, fingerprints *Fingerprinter, basePath string) model.Transform {
+	return func(pagePath string, contents []byte) ([]byte, error) {
+		if !file.IsHTML(pagePath) {
+			return contents, nil
+		}
+
+		var edits []rewrite.Edit
+		for _, tok := range markup.Tokenize(contents) {
+			if tok.Type != markup.StartTag {
+				continue
+			}
+			if _, ok := tok.Attr("integrity"); ok {
+				continue
+			}
+
+			var ref markup.Attr
+			var ok bool
+			switch tok.Tag {
+			case "script":
+				ref, ok = tok.Attr("src")
+			case "link":
+				ref, ok = tok.Attr("href")
+				rel, _ := tok.Attr("rel")
+				ok = ok && hasIntegrityRel(rel.Value)
+			}
+			if !ok {
+				continue
+			}
+
+			filePath, ok := PublicPath(ref.Value, basePath, fingerprints)
+			if !ok {
+				continue
+			}
+			value, err := integrity.Lookup(filePath)
+			if err != nil {
+				// links to missing files are reported by the link checks
+				continue
+			}
+			// insert after the tag name
+			at := tok.Start + 1 + len(tok.Tag)
+			edits = append(edits, rewrite.Edit{Start: at, End: at, Text: fmt.Sprintf(` integrity="%s"`, value)})
+		}
+		return rewrite.Apply(contents, edits), nil
+	}
+}
+
+func hasIntegrityRel(rel string) bool {
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if integrityRels[r] {
+			return true
+		}
+	}
+	return false
+}
+
+// PublicPath returns the path of the public file a root relative URL loads.
+func PublicPath(rawURL string, basePath string, fingerprints *Fingerprinter) (string, bool) {
+	if !rewrite.IsRootRelative(rawURL) {
+		return "", false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	p := u.Path
+	if basePath != "" && rewrite.HasBasePath(p, basePath) {
+		p = strings.TrimPrefix(p, basePath)
+	}
+	if fingerprints != nil {
+		if resolved, ok := fingerprints.Resolve(p); ok {
+			return resolved, true
+		}
+	}
+	return p, true
+}
+
+func sha384Base64(r io.Reader) (string, error) {
+	h := sha512.New384()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
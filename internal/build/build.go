@@ -1,10 +1,19 @@
 package build
 
 import (
+	"bytes"
 	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/man-on-box/litepage/internal/asset"
+	"github.com/man-on-box/litepage/internal/compress"
 	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/images"
 	"github.com/man-on-box/litepage/internal/model"
 	"github.com/man-on-box/litepage/internal/sitemap"
 )
@@ -14,12 +23,29 @@ type SiteBuilder interface {
 }
 
 type Config struct {
-	DistDir     string
-	PublicDir   string
+	DistDir string
+	// Public holds the public files copied to the dist directory.
+	Public fs.FS
+	// Copy configures how public files are copied, such as how symbolic links are handled.
+	Copy        file.CopyOptions
 	Pages       *[]model.Page
 	SiteDomain  string
 	BasePath    string
 	WithSitemap bool
+	Transforms  []model.Transform
+	// Assets, if set, also copies public files to names fingerprinted with a hash
+	// of their contents, and writes a manifest of them.
+	Assets *asset.Fingerprinter
+	// AssetTransforms are applied to the public files copied to the dist directory, in order.
+	AssetTransforms []model.Transform
+	// AssetExtensions are the extensions of the public files the asset transforms
+	// handle, such as '.css'. Other files are neither read nor transformed.
+	AssetExtensions []string
+	// Compress, if set, writes compressed copies of the built files next to them,
+	// such as '/index.html.gz', for hosts that serve them to browsers as they are.
+	Compress *compress.Config
+	// Variants, if set, writes the resized variants of images next to them.
+	Variants *images.Variants
 }
 
 type siteBuilder struct {
@@ -37,10 +63,37 @@ func (b *siteBuilder) Build() error {
 	fmt.Printf("LITEPAGE building site '%s'...\n", b.Config.SiteDomain)
 	startTime := time.Now()
 
-	err := file.CopyDir(b.Config.PublicDir, b.Config.DistDir)
+	copied, err := file.CopyFS(b.Config.Public, b.Config.DistDir, b.Config.Copy)
 	if err != nil {
 		return fmt.Errorf("Could not copy public directory: %w", err)
 	}
+	if copied.Linked > 0 {
+		fmt.Printf("- hard linked %d of %d public files\n", copied.Linked, copied.Files)
+	}
+	if copied.Symlinks > 0 {
+		fmt.Printf("- copied %d symbolic links\n", copied.Symlinks)
+	}
+
+	if len(b.Config.AssetTransforms) > 0 {
+		err = b.transformAssets()
+		if err != nil {
+			return fmt.Errorf("An error occurred while processing assets: %w", err)
+		}
+	}
+
+	if b.Config.Variants != nil {
+		err = b.writeVariants()
+		if err != nil {
+			return fmt.Errorf("An error occurred while resizing images: %w", err)
+		}
+	}
+
+	if b.Config.Assets != nil {
+		err = b.fingerprintAssets()
+		if err != nil {
+			return fmt.Errorf("An error occurred while fingerprinting assets: %w", err)
+		}
+	}
 
 	err = b.createPages()
 	if err != nil {
@@ -54,6 +107,13 @@ func (b *siteBuilder) Build() error {
 		}
 	}
 
+	if b.Config.Compress != nil {
+		err = b.compressFiles()
+		if err != nil {
+			return fmt.Errorf("An error occurred while compressing files: %w", err)
+		}
+	}
+
 	noOfPages := len(*b.Config.Pages)
 	pageStr := "page"
 	if noOfPages > 1 {
@@ -67,15 +127,137 @@ func (b *siteBuilder) Build() error {
 func (b *siteBuilder) createPages() error {
 	for _, p := range *b.Config.Pages {
 		fmt.Printf("- creating %s...\n", p.Path)
+		contents, err := p.Render(b.Config.Transforms)
+		if err != nil {
+			return fmt.Errorf("could not transform page '%s': %w", p.Path, err)
+		}
 		f, err := file.CreateFile(b.Config.DistDir + p.Path)
 		if err != nil {
 			return err
 		}
-		p.Handler(f)
+		_, err = f.Write(contents)
+		f.Close()
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// transformAssets applies the asset transforms to the public files copied to
+// the dist directory, and reports how much smaller they made them.
+func (b *siteBuilder) transformAssets() error {
+	extensions := map[string]bool{}
+	for _, ext := range b.Config.AssetExtensions {
+		extensions[strings.ToLower(ext)] = true
+	}
+	var changed, before, after int
+	err := file.WalkFiles(b.Config.Public, func(filePath string) error {
+		// large files such as videos are left as they were copied
+		if !extensions[strings.ToLower(path.Ext(filePath))] {
+			return nil
+		}
+		original, err := fs.ReadFile(b.Config.Public, file.FSPath(filePath))
+		if err != nil {
+			return err
+		}
+
+		contents := original
+		for _, t := range b.Config.AssetTransforms {
+			contents, err = t(filePath, contents)
+			if err != nil {
+				return fmt.Errorf("could not transform asset '%s': %w", filePath, err)
+			}
+		}
+		if bytes.Equal(contents, original) {
+			return nil
+		}
+		changed++
+		before += len(original)
+		after += len(contents)
+		// the file keeps the mode it was copied with, like the files that are not transformed
+		info, err := fs.Stat(b.Config.Public, file.FSPath(filePath))
+		if err != nil {
+			return err
+		}
+		return file.WriteFileMode(filepath.Join(b.Config.DistDir, filepath.FromSlash(filePath)), contents, info.Mode().Perm()|0600)
+	})
+	if err != nil {
+		return err
+	}
+
+	if changed > 0 {
+		fmt.Printf("- processed %d assets from %s to %s (%.0f%% smaller)\n", changed, formatSize(before), formatSize(after), 100*float64(before-after)/float64(before))
+	}
+	return nil
+}
+
+// compressFiles writes the compressed copies of the files in the dist directory,
+// and reports how much smaller each encoding made them.
+func (b *siteBuilder) compressFiles() error {
+	report, err := compress.WriteDir(b.Config.DistDir, *b.Config.Compress)
+	if err != nil {
+		return err
+	}
+	if report.Files == 0 {
+		return nil
+	}
+	for _, e := range b.Config.Compress.Encodings {
+		after := report.Compressed[e.Name]
+		fmt.Printf("- compressed %d files with %s from %s to %s (%.0f%% smaller)\n", report.Files, e.Name, formatSize(report.Size), formatSize(after), 100*float64(report.Size-after)/float64(report.Size))
+	}
+	return nil
+}
+
+// writeVariants writes the resized variants of images to the dist directory.
+func (b *siteBuilder) writeVariants() error {
+	report, err := b.Config.Variants.WriteDir(b.Config.DistDir)
+	if err != nil {
+		return err
+	}
+	if report.Variants > 0 {
+		fmt.Printf("- resized %d images to %d variants (%d cached)\n", report.Images, report.Variants, report.Cached)
+	}
+	return nil
+}
+
+func formatSize(size int) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f KB", float64(size)/1024)
+}
+
+func (b *siteBuilder) fingerprintAssets() error {
+	manifest, err := b.Config.Assets.Manifest()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("- fingerprinting %d assets...\n", len(manifest))
+	for filePath, hashed := range manifest {
+		// written as a new file, as the file at the hashed path may be hard linked to a public file
+		data, err := os.ReadFile(b.Config.DistDir + filePath)
+		if err != nil {
+			return err
+		}
+		if err := file.WriteFile(b.Config.DistDir+hashed, data); err != nil {
+			return err
+		}
+	}
+
+	data, err := manifest.JSON()
+	if err != nil {
+		return err
+	}
+	f, err := file.CreateFile(b.Config.DistDir + asset.ManifestPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return err
+}
+
 func (b *siteBuilder) createSitemap() error {
 	f, err := file.CreateFile(b.Config.DistDir + "/sitemap.xml")
 	if err != nil {
@@ -1,12 +1,18 @@
 package build_test
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/man-on-box/litepage/internal/asset"
 	"github.com/man-on-box/litepage/internal/build"
 	"github.com/man-on-box/litepage/internal/model"
 	"github.com/stretchr/testify/assert"
@@ -65,7 +71,7 @@ func TestSiteBuilder(t *testing.T) {
 
 	c := build.Config{
 		DistDir:     tmpDistDir,
-		PublicDir:   tmpPublicDir,
+		Public:      os.DirFS(tmpPublicDir),
 		Pages:       testPages,
 		SiteDomain:  "test.com",
 		WithSitemap: true,
@@ -110,3 +116,168 @@ func TestSiteBuilder(t *testing.T) {
 		})
 	}
 }
+
+func TestSiteBuilderWithTransforms(t *testing.T) {
+	testPages := &[]model.Page{
+		{
+			Path: "/index.html",
+			Handler: func(w io.Writer) {
+				w.Write([]byte("<h1>Index Page</h1>"))
+			},
+		},
+	}
+
+	tmpDistDir, err := os.MkdirTemp("", "dist")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDistDir)
+
+	tmpPublicDir, err := os.MkdirTemp("", "public")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpPublicDir)
+
+	upper := func(pagePath string, contents []byte) ([]byte, error) {
+		return []byte(strings.ToUpper(string(contents))), nil
+	}
+	wrap := func(pagePath string, contents []byte) ([]byte, error) {
+		return []byte(pagePath + ":" + string(contents)), nil
+	}
+
+	t.Run("Applies transforms to pages in order", func(t *testing.T) {
+		c := build.Config{
+			DistDir:    tmpDistDir,
+			Public:     os.DirFS(tmpPublicDir),
+			Pages:      testPages,
+			SiteDomain: "test.com",
+			Transforms: []model.Transform{upper, wrap},
+		}
+		err := build.New(c).Build()
+		assert.NoError(t, err)
+
+		content, err := os.ReadFile(tmpDistDir + "/index.html")
+		assert.NoError(t, err)
+		assert.Equal(t, "/index.html:<H1>INDEX PAGE</H1>", string(content))
+	})
+
+	t.Run("Returns error if a transform fails", func(t *testing.T) {
+		failing := func(pagePath string, contents []byte) ([]byte, error) {
+			return nil, errors.New("transform failed")
+		}
+		c := build.Config{
+			DistDir:    tmpDistDir,
+			Public:     os.DirFS(tmpPublicDir),
+			Pages:      testPages,
+			SiteDomain: "test.com",
+			Transforms: []model.Transform{failing},
+		}
+		err := build.New(c).Build()
+		assert.ErrorContains(t, err, "transform failed")
+	})
+}
+
+func TestSiteBuilderWithFingerprint(t *testing.T) {
+	tmpDistDir := t.TempDir()
+	tmpPublicDir := t.TempDir()
+	err := os.WriteFile(tmpPublicDir+"/styles.css", []byte("body { color: red; }"), 0644)
+	assert.NoError(t, err)
+
+	assets := asset.NewFingerprinter(os.DirFS(tmpPublicDir), []string{".css"}, nil, nil)
+	hashed, err := assets.Lookup("/styles.css")
+	assert.NoError(t, err)
+
+	c := build.Config{
+		DistDir:    tmpDistDir,
+		Public:     os.DirFS(tmpPublicDir),
+		Pages:      &[]model.Page{},
+		SiteDomain: "test.com",
+		Assets:     assets,
+	}
+	err = build.New(c).Build()
+	assert.NoError(t, err)
+
+	for _, p := range []string{"/styles.css", hashed} {
+		content, err := os.ReadFile(tmpDistDir + p)
+		assert.NoError(t, err)
+		assert.Equal(t, "body { color: red; }", string(content))
+	}
+
+	manifest, err := os.ReadFile(tmpDistDir + asset.ManifestPath)
+	assert.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{"/styles.css": "%s"}`, hashed), string(manifest))
+}
+
+func TestSiteBuilderWithAssetTransforms(t *testing.T) {
+	tmpDistDir := t.TempDir()
+	tmpPublicDir := t.TempDir()
+	err := os.WriteFile(tmpPublicDir+"/styles.css", []byte("body { color: red; }"), 0644)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chmod(tmpPublicDir+"/styles.css", 0640))
+	err = os.WriteFile(tmpPublicDir+"/robots.txt", []byte("User-agent: *"), 0644)
+	assert.NoError(t, err)
+
+	var transformed []string
+	upperCSS := func(filePath string, contents []byte) ([]byte, error) {
+		transformed = append(transformed, filePath)
+		return []byte(strings.ToUpper(string(contents))), nil
+	}
+	assets := asset.NewFingerprinter(os.DirFS(tmpPublicDir), []string{".css"}, nil, nil)
+	hashed, err := assets.Lookup("/styles.css")
+	assert.NoError(t, err)
+
+	c := build.Config{
+		DistDir:         tmpDistDir,
+		Public:          os.DirFS(tmpPublicDir),
+		Pages:           &[]model.Page{},
+		SiteDomain:      "test.com",
+		Assets:          assets,
+		AssetTransforms: []model.Transform{upperCSS},
+		AssetExtensions: []string{".css"},
+	}
+	err = build.New(c).Build()
+	assert.NoError(t, err)
+	// files with other extensions are not read
+	assert.Equal(t, []string{"/styles.css"}, transformed)
+
+	for p, expected := range map[string]string{"/styles.css": "BODY { COLOR: RED; }", hashed: "BODY { COLOR: RED; }", "/robots.txt": "User-agent: *"} {
+		content, err := os.ReadFile(tmpDistDir + p)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(content))
+	}
+
+	source, err := os.ReadFile(tmpPublicDir + "/styles.css")
+	assert.NoError(t, err)
+	assert.Equal(t, "body { color: red; }", string(source))
+
+	// transformed files keep the mode of their public file
+	info, err := os.Stat(tmpDistDir + "/styles.css")
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0640), info.Mode().Perm())
+}
+
+func TestSiteBuilderWithFS(t *testing.T) {
+	tmpDistDir := t.TempDir()
+	public := fstest.MapFS{
+		"robots.txt":              {Data: []byte("User-agent: *")},
+		"css/main.css":            {Data: []byte("body { color: red; }")},
+		"img/icons/nested/a.svg":  {Data: []byte("<svg></svg>")},
+		"img/icons/nested/b.svg":  {Data: []byte("<svg/>")},
+		"empty/directory/.keep":   {Data: []byte{}},
+		"fonts/inter/inter.woff2": {Data: []byte("wOF2")},
+	}
+
+	c := build.Config{
+		DistDir:    tmpDistDir,
+		Public:     public,
+		Pages:      &[]model.Page{},
+		SiteDomain: "test.com",
+	}
+	err := build.New(c).Build()
+	assert.NoError(t, err)
+
+	for name, f := range public {
+		t.Run(fmt.Sprintf("Copies '%s'", name), func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join(tmpDistDir, filepath.FromSlash(name)))
+			assert.NoError(t, err)
+			assert.Equal(t, string(f.Data), string(content))
+		})
+	}
+}
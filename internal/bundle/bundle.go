@@ -0,0 +1,342 @@
+// Package bundle inlines the @import rules of stylesheets, so that browsers load
+// a single file rather than a chain of them.
+package bundle
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/man-on-box/litepage/internal/css"
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/model"
+	"github.com/man-on-box/litepage/internal/rewrite"
+)
+
+// Bundler bundles the entry stylesheets of the public files. The files each
+// entry imported when it was last bundled are remembered, so that results
+// computed from a bundle can be recomputed when one of them changes.
+type Bundler struct {
+	files    fs.FS
+	basePath string
+	entries  map[string]bool
+
+	mu   sync.Mutex
+	deps map[string][]string
+}
+
+func New(public fs.FS, basePath string, entries []string) *Bundler {
+	e := map[string]bool{}
+	for _, entry := range entries {
+		e[entry] = true
+	}
+	return &Bundler{files: public, basePath: basePath, entries: e, deps: map[string][]string{}}
+}
+
+// IsEntry reports whether the public file is bundled.
+func (b *Bundler) IsEntry(filePath string) bool {
+	return b.entries[filePath]
+}
+
+// Extensions are the extensions of the entry stylesheets the transform bundles.
+var Extensions = []string{".css"}
+
+// Transform returns a transform that replaces entry stylesheets with their bundle.
+func (b *Bundler) Transform() model.Transform {
+	return func(filePath string, contents []byte) ([]byte, error) {
+		if !b.IsEntry(filePath) {
+			return contents, nil
+		}
+		return b.Bundle(filePath, contents)
+	}
+}
+
+// Deps returns the files the entry stylesheet imported when it was last bundled.
+func (b *Bundler) Deps(filePath string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.deps[filePath]
+}
+
+// Bundle returns the entry stylesheet with the public files it imports inlined,
+// recursively. Relative url() references of imported files are rewritten to be
+// relative to the entry, and import conditions are kept by wrapping the inlined
+// rules in @media, @supports and @layer blocks. Imports from other sites cannot
+// be inlined, so they are moved to the start of the bundle.
+func (b *Bundler) Bundle(entry string, src []byte) ([]byte, error) {
+	bd := &bundling{Bundler: b, entry: entry, seen: map[string]bool{}}
+	body, err := bd.inline(entry, src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not bundle '%s': %w", entry, err)
+	}
+
+	b.mu.Lock()
+	b.deps[entry] = bd.deps
+	b.mu.Unlock()
+
+	if len(bd.remote) == 0 {
+		return body, nil
+	}
+	// imports must come before any other rule, except @charset
+	charset := charsetEnd(body)
+	bundle := append([]byte{}, body[:charset]...)
+	if charset > 0 {
+		bundle = append(bundle, '\n')
+	}
+	bundle = append(bundle, strings.Join(bd.remote, "\n")...)
+	bundle = append(bundle, '\n')
+	return append(bundle, bytes.TrimLeft(body[charset:], "\r\n")...), nil
+}
+
+// bundling is the state of bundling one entry.
+type bundling struct {
+	*Bundler
+	entry  string
+	deps   []string
+	seen   map[string]bool
+	remote []string
+}
+
+// inline returns the stylesheet with its imports inlined. The stack holds the
+// files importing it, to report import cycles.
+func (bd *bundling) inline(filePath string, src []byte, stack []string) ([]byte, error) {
+	stack = append(stack[:len(stack):len(stack)], filePath)
+
+	var edits []rewrite.Edit
+	if filePath != bd.entry {
+		// only the first rule of the bundle may set the encoding
+		if end := charsetEnd(src); end > 0 {
+			edits = append(edits, rewrite.Edit{Start: 0, End: end})
+		}
+	}
+
+	for _, ref := range css.Refs(src) {
+		if !ref.Import {
+			if filePath != bd.entry {
+				if rebased, ok := bd.rebase(filePath, ref.URL); ok {
+					edits = append(edits, rewrite.Edit{Start: ref.Start, End: ref.End, Text: rebased})
+				}
+			}
+			continue
+		}
+
+		r := importRule(src, ref)
+		if isRemote(ref.URL) {
+			bd.remote = append(bd.remote, string(src[r.start:r.end]))
+			edits = append(edits, rewrite.Edit{Start: r.start, End: r.end})
+			continue
+		}
+
+		imported := bd.resolve(filePath, ref.URL)
+		for i, s := range stack {
+			if s == imported {
+				return nil, fmt.Errorf("import cycle %s", strings.Join(append(stack[i:], imported), " -> "))
+			}
+		}
+		contents, err := fs.ReadFile(bd.files, file.FSPath(imported))
+		if err != nil {
+			return nil, fmt.Errorf("could not read '%s' imported from '%s': %w", imported, filePath, err)
+		}
+		if !bd.seen[imported] {
+			bd.seen[imported] = true
+			bd.deps = append(bd.deps, imported)
+		}
+		inlined, err := bd.inline(imported, contents, stack)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, rewrite.Edit{Start: r.start, End: r.end, Text: wrap(inlined, r.condition)})
+	}
+	return rewrite.Apply(src, edits), nil
+}
+
+// resolve returns the path of the public file an import of the stylesheet loads.
+func (bd *bundling) resolve(filePath string, rawURL string) string {
+	p, _, _ := strings.Cut(rawURL, "?")
+	p, _, _ = strings.Cut(p, "#")
+	if strings.HasPrefix(p, "/") {
+		if bd.basePath != "" && rewrite.HasBasePath(p, bd.basePath) {
+			p = strings.TrimPrefix(p, bd.basePath)
+		}
+		return path.Clean(p)
+	}
+	return path.Join(path.Dir(filePath), p)
+}
+
+// rebase returns the relative URL of a file imported into the entry, rewritten
+// to be relative to the entry. Other URLs are left as they are.
+func (bd *bundling) rebase(filePath string, rawURL string) (string, bool) {
+	if rawURL == "" || strings.HasPrefix(rawURL, "/") || strings.HasPrefix(rawURL, "#") || isRemote(rawURL) {
+		return "", false
+	}
+	p := rawURL
+	suffix := ""
+	if i := strings.IndexAny(p, "?#"); i >= 0 {
+		p, suffix = p[:i], p[i:]
+	}
+	target := path.Join(path.Dir(filePath), p)
+	return relativePath(path.Dir(bd.entry), target) + suffix, true
+}
+
+// relativePath returns the path of the target relative to the directory.
+func relativePath(dir string, target string) string {
+	var from []string
+	if d := strings.Trim(dir, "/"); d != "" {
+		from = strings.Split(d, "/")
+	}
+	to := strings.Split(strings.Trim(target, "/"), "/")
+
+	i := 0
+	for i < len(from) && i < len(to)-1 && from[i] == to[i] {
+		i++
+	}
+	var parts []string
+	for range from[i:] {
+		parts = append(parts, "..")
+	}
+	return strings.Join(append(parts, to[i:]...), "/")
+}
+
+// isRemote reports whether the URL loads a file from another site, or is not a
+// path at all, such as a data URL.
+func isRemote(rawURL string) bool {
+	if strings.HasPrefix(rawURL, "//") {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	return err != nil || u.Scheme != ""
+}
+
+// rule is the extent of an @import rule, and its condition, such as 'screen'
+// in '@import "print.css" screen;'.
+type rule struct {
+	start     int
+	end       int
+	condition string
+}
+
+// importRule returns the @import rule the reference is the URL of.
+func importRule(src []byte, ref css.Ref) rule {
+	start := ref.Start
+	for start > 0 && !css.HasPrefixFold(src[start:], "@import") {
+		start--
+	}
+
+	// skip the closing quote and parenthesis of the URL
+	i := ref.End
+	if i < len(src) && (src[i] == '"' || src[i] == '\'') {
+		i++
+	}
+	if strings.Contains(strings.ToLower(string(src[start:ref.Start])), "url(") {
+		for i < len(src) && css.IsSpace(src[i]) {
+			i++
+		}
+		if i < len(src) && src[i] == ')' {
+			i++
+		}
+	}
+
+	condStart := i
+	depth := 0
+	for ; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '"' || c == '\'':
+			i = css.StringEnd(src, i)
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ';' && depth == 0:
+			return rule{start: start, end: i + 1, condition: strings.TrimSpace(string(src[condStart:i]))}
+		}
+	}
+	return rule{start: start, end: len(src), condition: strings.TrimSpace(string(src[condStart:]))}
+}
+
+// wrap wraps the inlined rules in the blocks applying the condition of the
+// import, in the order of the @import syntax: layer, supports, then media.
+func wrap(contents []byte, condition string) string {
+	text := strings.TrimSpace(string(contents))
+	if condition == "" {
+		return text
+	}
+
+	layer, hasLayer := "", false
+	if css.HasPrefixFold([]byte(condition), "layer(") {
+		layer, condition = parens(condition[len("layer"):])
+		hasLayer = true
+	} else if strings.EqualFold(condition, "layer") || css.HasPrefixFold([]byte(condition), "layer ") {
+		condition = strings.TrimSpace(condition[len("layer"):])
+		hasLayer = true
+	}
+	supports := ""
+	if css.HasPrefixFold([]byte(condition), "supports(") {
+		supports, condition = parens(condition[len("supports"):])
+		if isDeclaration(supports) {
+			supports = "(" + supports + ")"
+		}
+	}
+
+	if hasLayer {
+		name := layer
+		if name != "" {
+			name += " "
+		}
+		text = "@layer " + name + "{\n" + text + "\n}"
+	}
+	if supports != "" {
+		text = "@supports " + supports + " {\n" + text + "\n}"
+	}
+	if condition != "" {
+		text = "@media " + condition + " {\n" + text + "\n}"
+	}
+	return text
+}
+
+// parens returns the text inside the parentheses the string starts with, and
+// the text after them.
+func parens(s string) (string, string) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return strings.TrimSpace(s[1:i]), strings.TrimSpace(s[i+1:])
+			}
+		}
+	}
+	return strings.TrimSpace(strings.TrimPrefix(s, "(")), ""
+}
+
+// isDeclaration reports whether a supports condition is a bare declaration like
+// 'display: grid', which needs parentheses in an @supports rule.
+func isDeclaration(s string) bool {
+	i := 0
+	for i < len(s) && css.IsIdent(s[i]) {
+		i++
+	}
+	for i < len(s) && css.IsSpace(s[i]) {
+		i++
+	}
+	return i > 0 && i < len(s) && s[i] == ':'
+}
+
+// charsetEnd returns the offset after the @charset rule the stylesheet starts
+// with, or 0 if it has none.
+func charsetEnd(src []byte) int {
+	if !bytes.HasPrefix(src, []byte(`@charset "`)) {
+		return 0
+	}
+	end := bytes.IndexByte(src, ';')
+	if end < 0 {
+		return 0
+	}
+	return end + 1
+}
@@ -0,0 +1,74 @@
+package bundle_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/bundle"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for p, contents := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, p)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, p), []byte(contents), 0644))
+	}
+}
+
+func TestBundle(t *testing.T) {
+	publicDir := t.TempDir()
+	writeFiles(t, publicDir, map[string]string{
+		"/css/main.css": `@charset "utf-8";
+@import "base.css";
+@import url('/css/partials/card.css') screen and (min-width: 40em);
+@import "https://fonts.example.com/font.css";
+@import "/test/css/theme.css" layer(theme) supports(display: grid);
+.main { background: url(main.png) }`,
+		"/css/base.css":          `@charset "utf-8";` + "\n" + `body { margin: 0 }`,
+		"/css/partials/card.css": `@import "../base.css"; .card { background: url("../../img/card.png?v=1") }` + "\n" + `.logo { background: url(/img/logo.png), url(data:image/png;base64,AA==), url(icon.svg#a) }`,
+		"/css/theme.css":         `:root { --accent: red }`,
+	})
+
+	b := bundle.New(os.DirFS(publicDir), "/test", []string{"/css/main.css"})
+	src, err := os.ReadFile(filepath.Join(publicDir, "css", "main.css"))
+	assert.NoError(t, err)
+	bundled, err := b.Bundle("/css/main.css", src)
+	assert.NoError(t, err)
+
+	assert.Equal(t, `@charset "utf-8";
+@import "https://fonts.example.com/font.css";
+body { margin: 0 }
+@media screen and (min-width: 40em) {
+body { margin: 0 } .card { background: url("../img/card.png?v=1") }
+.logo { background: url(/img/logo.png), url(data:image/png;base64,AA==), url(partials/icon.svg#a) }
+}
+
+@supports (display: grid) {
+@layer theme {
+:root { --accent: red }
+}
+}
+.main { background: url(main.png) }`, string(bundled))
+	assert.Equal(t, []string{"/css/base.css", "/css/partials/card.css", "/css/theme.css"}, b.Deps("/css/main.css"))
+}
+
+func TestBundleErrors(t *testing.T) {
+	publicDir := t.TempDir()
+	writeFiles(t, publicDir, map[string]string{
+		"/a.css":       `@import "b.css";`,
+		"/b.css":       `@import "/a.css";`,
+		"/missing.css": `@import "nested/gone.css";`,
+	})
+	b := bundle.New(os.DirFS(publicDir), "", []string{"/a.css", "/missing.css"})
+
+	_, err := b.Transform()("/a.css", []byte(`@import "b.css";`))
+	assert.ErrorContains(t, err, "import cycle /a.css -> /b.css -> /a.css")
+
+	_, err = b.Transform()("/missing.css", []byte(`@import "nested/gone.css";`))
+	assert.ErrorContains(t, err, "could not read '/nested/gone.css' imported from '/missing.css'")
+
+	contents, err := b.Transform()("/b.css", []byte(`@import "/a.css";`))
+	assert.NoError(t, err)
+	assert.Equal(t, `@import "/a.css";`, string(contents), "files that are not entries are left as they are")
+}
@@ -0,0 +1,274 @@
+// Package compress writes compressed copies of the files of a site, and serves
+// them to browsers that accept their encoding.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/man-on-box/litepage/internal/file"
+)
+
+// DefaultMinSize is the size in bytes below which compressing a file is not worth
+// the time browsers spend decompressing it.
+const DefaultMinSize = 1024
+
+// DefaultExtensions are the extensions of text files, which compress well.
+var DefaultExtensions = []string{".html", ".htm", ".css", ".js", ".mjs", ".json", ".xml", ".svg", ".txt", ".map", ".webmanifest"}
+
+// Encoding is a Content-Encoding that files can be compressed with.
+type Encoding struct {
+	// Name is the value of the Content-Encoding header, such as 'gzip'.
+	Name string
+	// Extension is added to the name of compressed copies, such as '.gz'.
+	Extension string
+	// NewWriter returns a writer compressing what is written to w.
+	NewWriter func(w io.Writer) io.WriteCloser
+}
+
+// Gzip compresses files with gzip, at the best compression level.
+func Gzip() Encoding {
+	return Encoding{
+		Name:      "gzip",
+		Extension: ".gz",
+		NewWriter: func(w io.Writer) io.WriteCloser {
+			gw, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+			return gw
+		},
+	}
+}
+
+// Config is which files are compressed, and with which encodings.
+type Config struct {
+	// Encodings are the encodings files are compressed with, in order of preference.
+	Encodings []Encoding
+	// MinSize is the size in bytes below which files are not compressed.
+	MinSize int
+	// Extensions are the extensions of files that compress well.
+	Extensions []string
+}
+
+// Compressible reports whether a file of the size should be compressed, by its extension.
+func (c Config) Compressible(filePath string, size int) bool {
+	if size < c.MinSize {
+		return false
+	}
+	ext := path.Ext(filePath)
+	for _, e := range c.Extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// compressibleType reports whether a response of the content type should be
+// compressed, by matching it with the types of the compressible extensions.
+func (c Config) compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, ext := range c.Extensions {
+		t, _, err := mime.ParseMediaType(mime.TypeByExtension(ext))
+		if err == nil && t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// Compress returns the contents compressed with the encoding.
+func Compress(e Encoding, contents []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := e.NewWriter(&buf)
+	if _, err := w.Write(contents); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Negotiate returns the encoding preferred by the configuration out of those
+// accepted by the Accept-Encoding header of the request.
+func Negotiate(acceptEncoding string, encodings []Encoding) (Encoding, bool) {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name != "" {
+			accepted[strings.ToLower(name)] = q
+		}
+	}
+
+	for _, e := range encodings {
+		q, ok := accepted[e.Name]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > 0 {
+			return e, true
+		}
+	}
+	return Encoding{}, false
+}
+
+// Report is the result of compressing the files of a directory.
+type Report struct {
+	Files int
+	// Size is the total size of the files compressed.
+	Size int
+	// Compressed is the total size of the compressed copies, by encoding.
+	Compressed map[string]int
+}
+
+// WriteDir writes a compressed copy of every compressible file in the directory
+// next to it, for each encoding. Copies that are not smaller are not written, and
+// copies left from previous builds that would not be written are removed.
+func WriteDir(dir string, c Config) (Report, error) {
+	report := Report{Compressed: map[string]int{}}
+	// files are listed first, as stale copies are removed while compressing
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		// symbolic links are skipped, as the files they lead to in the directory are compressed themselves
+		if err == nil && !d.IsDir() && d.Type()&fs.ModeSymlink == 0 {
+			files = append(files, p)
+		}
+		return err
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for _, p := range files {
+		if err := c.compressFile(p, &report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (c Config) compressFile(p string, report *Report) error {
+	contents, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		// a stale copy removed while compressing the file it was made from
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !c.Compressible(p, len(contents)) {
+		if c.Compressible(p, c.MinSize) {
+			// the file shrank below the minimum size since it was last compressed
+			return c.removeCopies(p, c.Encodings)
+		}
+		return nil
+	}
+
+	report.Files++
+	report.Size += len(contents)
+	for _, e := range c.Encodings {
+		compressed, err := Compress(e, contents)
+		if err != nil {
+			return fmt.Errorf("could not compress '%s' with %s: %w", p, e.Name, err)
+		}
+		if len(compressed) >= len(contents) {
+			report.Compressed[e.Name] += len(contents)
+			if err := c.removeCopies(p, []Encoding{e}); err != nil {
+				return err
+			}
+			continue
+		}
+		report.Compressed[e.Name] += len(compressed)
+		if err := file.WriteFile(p+e.Extension, compressed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeCopies removes the compressed copies of the file left by a previous build.
+func (c Config) removeCopies(p string, encodings []Encoding) error {
+	for _, e := range encodings {
+		if err := os.Remove(p + e.Extension); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler compresses the responses of the handler on the fly, for browsers that
+// accept one of the encodings. Responses are buffered, so it is only meant for
+// the dev server.
+func Handler(next http.Handler, c Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		header := w.Header()
+		for name, values := range rec.header {
+			header[name] = values
+		}
+		body := rec.body.Bytes()
+		if header.Get("Content-Type") == "" && len(body) > 0 {
+			header.Set("Content-Type", http.DetectContentType(body))
+		}
+		compressible := rec.status == http.StatusOK && header.Get("Content-Encoding") == "" &&
+			c.compressibleType(header.Get("Content-Type"))
+		if compressible {
+			header.Add("Vary", "Accept-Encoding")
+		}
+		if e, ok := Negotiate(r.Header.Get("Accept-Encoding"), c.Encodings); ok && compressible && r.Method != http.MethodHead && len(body) >= c.MinSize {
+			compressed, err := Compress(e, body)
+			if err == nil && len(compressed) < len(body) {
+				body = compressed
+				header.Set("Content-Encoding", e.Name)
+				header.Set("Content-Length", strconv.Itoa(len(body)))
+				header.Del("Accept-Ranges")
+			}
+		}
+		w.WriteHeader(rec.status)
+		w.Write(body)
+	})
+}
+
+// bufferedResponse records a response, so that it can be compressed once complete.
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.status = status
+		b.wroteHeader = true
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(data)
+}
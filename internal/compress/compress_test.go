@@ -0,0 +1,151 @@
+package compress_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/compress"
+	"github.com/stretchr/testify/assert"
+)
+
+func gunzip(t *testing.T, data []byte) string {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	contents, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	return string(contents)
+}
+
+// fake is an encoding that does not compress, to tell encodings apart in tests.
+func fake(name string) compress.Encoding {
+	return compress.Encoding{Name: name, Extension: "." + name, NewWriter: func(w io.Writer) io.WriteCloser {
+		return nopCloser{w}
+	}}
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestNegotiate(t *testing.T) {
+	encodings := []compress.Encoding{fake("br"), compress.Gzip()}
+
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{accept: "gzip, deflate, br", expected: "br"},
+		{accept: "gzip", expected: "gzip"},
+		{accept: "GZIP", expected: "gzip"},
+		{accept: "br;q=0, gzip;q=0.5", expected: "gzip"},
+		{accept: "*", expected: "br"},
+		{accept: "br;q=0, *", expected: "gzip"},
+		{accept: "identity", expected: ""},
+		{accept: "", expected: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			e, ok := compress.Negotiate(tt.accept, encodings)
+			assert.Equal(t, tt.expected != "", ok)
+			assert.Equal(t, tt.expected, e.Name)
+		})
+	}
+}
+
+func TestWriteDir(t *testing.T) {
+	dir := t.TempDir()
+	large := strings.Repeat("<p>Hello</p>", 200)
+	files := map[string]string{
+		"/index.html":    large,
+		"/small.html":    "<p>Hi</p>",
+		"/nested/app.js": strings.Repeat("run();", 200),
+		"/image.png":     large,
+		"/stale.css":     "a{}",
+		"/stale.css.gz":  "left from a previous build",
+		"/random.txt":    "",
+		"/random.txt.gz": "left from a previous build",
+	}
+	for p, contents := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(dir+p), 0755))
+		assert.NoError(t, os.WriteFile(dir+p, []byte(contents), 0644))
+	}
+
+	c := compress.Config{Encodings: []compress.Encoding{compress.Gzip()}, MinSize: 100, Extensions: compress.DefaultExtensions}
+	report, err := compress.WriteDir(dir, c)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Files)
+	assert.Equal(t, len(large)+1200, report.Size)
+	assert.Less(t, report.Compressed["gzip"], report.Size)
+
+	for _, p := range []string{"/index.html", "/nested/app.js"} {
+		data, err := os.ReadFile(dir + p + ".gz")
+		assert.NoError(t, err)
+		assert.Equal(t, files[p], gunzip(t, data))
+	}
+	for _, p := range []string{"/small.html.gz", "/image.png.gz", "/stale.css.gz", "/random.txt.gz"} {
+		_, err := os.Stat(dir + p)
+		assert.True(t, os.IsNotExist(err), p)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	large := strings.Repeat("<p>Hello</p>", 200)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Write([]byte(large))
+		case "/small":
+			w.Write([]byte("<p>Hi</p>"))
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(large))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(large))
+		}
+	})
+	c := compress.Config{Encodings: []compress.Encoding{compress.Gzip()}, MinSize: 100, Extensions: compress.DefaultExtensions}
+	server := httptest.NewServer(compress.Handler(next, c))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		accept   string
+		encoding string
+		vary     bool
+	}{
+		{name: "Compresses a page", path: "/page", accept: "gzip", encoding: "gzip", vary: true},
+		{name: "Does not compress for browsers that do not accept the encoding", path: "/page", accept: "identity", vary: true},
+		{name: "Does not compress a response below the minimum size", path: "/small", accept: "gzip", vary: true},
+		{name: "Does not compress a type that does not compress well", path: "/image.png", accept: "gzip"},
+		{name: "Does not compress an error", path: "/missing", accept: "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+tt.path, nil)
+			assert.NoError(t, err)
+			// setting the header stops the client from decompressing the response itself
+			req.Header.Set("Accept-Encoding", tt.accept)
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.encoding, resp.Header.Get("Content-Encoding"))
+			assert.Equal(t, tt.vary, resp.Header.Get("Vary") == "Accept-Encoding")
+			if tt.encoding == "gzip" {
+				assert.Equal(t, large, gunzip(t, body))
+				assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
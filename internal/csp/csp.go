@@ -0,0 +1,222 @@
+// Package csp builds the Content-Security-Policy of pages, allowing their inline
+// scripts and styles by hash, since static pages cannot use nonces.
+package csp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/markup"
+	"github.com/man-on-box/litepage/internal/model"
+	"github.com/man-on-box/litepage/internal/rewrite"
+)
+
+const Header = "Content-Security-Policy"
+
+// DefaultPolicy only allows resources from the site itself.
+const DefaultPolicy = "default-src 'self'"
+
+// Hashes are the sources allowing the inline scripts and styles of a page.
+type Hashes struct {
+	Scripts []string
+	Styles  []string
+	// StyleAttrs are the hashes of style attributes, which also require 'unsafe-hashes'.
+	StyleAttrs []string
+}
+
+// Collect returns the hashes of the inline scripts, style elements and style
+// attributes of the page, in order and without duplicates.
+func Collect(src []byte) Hashes {
+	var h Hashes
+	seen := map[string]bool{}
+	add := func(list *[]string, content []byte) {
+		sum := sha256.Sum256(content)
+		source := "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+		if !seen[source] {
+			seen[source] = true
+			*list = append(*list, source)
+		}
+	}
+
+	var inScript, inStyle bool
+	for _, tok := range markup.Tokenize(src) {
+		switch tok.Type {
+		case markup.StartTag:
+			_, hasSrc := tok.Attr("src")
+			inScript = tok.Tag == "script" && !hasSrc
+			inStyle = tok.Tag == "style"
+			if a, ok := tok.Attr("style"); ok && a.ValueStart >= 0 {
+				add(&h.StyleAttrs, []byte(a.Value))
+			}
+		case markup.RawText:
+			if inScript {
+				add(&h.Scripts, src[tok.Start:tok.End])
+			} else if inStyle {
+				add(&h.Styles, src[tok.Start:tok.End])
+			}
+		}
+	}
+	return h
+}
+
+type directive struct {
+	name    string
+	sources []string
+}
+
+// Policy returns the policy with the hashes added to its script-src and style-src
+// directives. Directives that are missing are created from default-src. Hashes are
+// not added where inline code is already allowed, either because there is no
+// default-src, or because of 'unsafe-inline', which browsers ignore next to hashes.
+func Policy(policy string, h Hashes) string {
+	var directives []directive
+	for _, d := range strings.Split(policy, ";") {
+		fields := strings.Fields(d)
+		if len(fields) == 0 {
+			continue
+		}
+		directives = append(directives, directive{name: strings.ToLower(fields[0]), sources: fields[1:]})
+	}
+
+	find := func(name string) int {
+		for i, d := range directives {
+			if d.name == name {
+				return i
+			}
+		}
+		return -1
+	}
+	allow := func(name string, hashes []string) {
+		if len(hashes) == 0 {
+			return
+		}
+		i := find(name)
+		if i < 0 {
+			def := find("default-src")
+			if def < 0 {
+				return
+			}
+			directives = append(directives, directive{name: name, sources: append([]string{}, directives[def].sources...)})
+			i = len(directives) - 1
+		}
+		var sources []string
+		for _, s := range directives[i].sources {
+			switch strings.ToLower(s) {
+			case "'unsafe-inline'":
+				return
+			case "'none'":
+				continue
+			}
+			sources = append(sources, s)
+		}
+		for _, hash := range hashes {
+			if !contains(sources, hash) {
+				sources = append(sources, hash)
+			}
+		}
+		directives[i].sources = sources
+	}
+
+	allow("script-src", h.Scripts)
+	styles := append(append([]string{}, h.Styles...), h.StyleAttrs...)
+	if len(h.StyleAttrs) > 0 {
+		styles = append(styles, "'unsafe-hashes'")
+	}
+	allow("style-src", styles)
+
+	parts := make([]string, len(directives))
+	for i, d := range directives {
+		parts[i] = strings.Join(append([]string{d.name}, d.sources...), " ")
+	}
+	return strings.Join(parts, "; ")
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Headers returns a function giving the Content-Security-Policy header of html
+// pages, for the dev server to enforce the policy.
+func Headers(policy string) func(pagePath string, contents []byte) http.Header {
+	return func(pagePath string, contents []byte) http.Header {
+		if !file.IsHTML(pagePath) {
+			return nil
+		}
+		return http.Header{Header: []string{Policy(policy, Collect(contents))}}
+	}
+}
+
+// MetaTransform returns a transform that adds the policy of each html page to a
+// meta tag at the start of its head, before any script or style it allows.
+func MetaTransform(policy string) model.Transform {
+	return func(pagePath string, contents []byte) ([]byte, error) {
+		if !file.IsHTML(pagePath) {
+			return contents, nil
+		}
+		meta := fmt.Sprintf(`<meta http-equiv="%s" content="%s">`, Header, html.EscapeString(Policy(policy, Collect(contents))))
+		at := metaOffset(contents)
+		return rewrite.Apply(contents, []rewrite.Edit{{Start: at, End: at, Text: meta}}), nil
+	}
+}
+
+// metaOffset returns the offset after the head start tag, or after the html
+// start tag or doctype if there is no head.
+func metaOffset(src []byte) int {
+	at := 0
+	for _, tok := range markup.Tokenize(src) {
+		switch {
+		case tok.Type == markup.StartTag && tok.Tag == "head":
+			return tok.End
+		case tok.Type == markup.StartTag && tok.Tag == "html", tok.Type == markup.Doctype:
+			at = tok.End
+		case tok.Type == markup.StartTag, tok.Type == markup.RawText:
+			return at
+		}
+	}
+	return at
+}
+
+// HeaderRules returns the rules of a '_headers' file setting the policy of each
+// page, for every path the page can be requested at.
+func HeaderRules(policies map[string]string, pagePaths []string) string {
+	var b strings.Builder
+	for _, p := range pagePaths {
+		policy, ok := policies[p]
+		if !ok {
+			continue
+		}
+		for _, u := range urlPaths(p) {
+			fmt.Fprintf(&b, "%s\n  %s: %s\n", u, Header, policy)
+		}
+	}
+	return b.String()
+}
+
+// urlPaths returns the paths a page is requested at, with or without its
+// extension and index.
+func urlPaths(pagePath string) []string {
+	paths := []string{pagePath}
+	if !file.IsHTML(pagePath) {
+		return paths
+	}
+	withoutExt := strings.TrimSuffix(pagePath, path.Ext(pagePath))
+	if dir, ok := strings.CutSuffix(withoutExt, "/index"); ok {
+		paths = append(paths, dir+"/")
+		if dir != "" {
+			paths = append(paths, dir)
+		}
+		return paths
+	}
+	return append(paths, withoutExt)
+}
@@ -0,0 +1,141 @@
+package csp_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"html"
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/csp"
+	"github.com/stretchr/testify/assert"
+)
+
+func hash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+func TestCollect(t *testing.T) {
+	src := `<html><head><script src="/app.js"></script><script>run()</script><style>body{}</style></head>` +
+		`<body style="color: red"><p style="color: red">x</p><script>run()</script><textarea><script>no()</script></textarea></body></html>`
+
+	h := csp.Collect([]byte(src))
+	assert.Equal(t, []string{hash("run()")}, h.Scripts)
+	assert.Equal(t, []string{hash("body{}")}, h.Styles)
+	assert.Equal(t, []string{hash("color: red")}, h.StyleAttrs)
+}
+
+func TestPolicy(t *testing.T) {
+	h := csp.Hashes{Scripts: []string{"'sha256-a'"}, Styles: []string{"'sha256-b'"}}
+
+	tests := []struct {
+		name     string
+		policy   string
+		hashes   csp.Hashes
+		expected string
+	}{
+		{
+			name:     "Creates directives from default-src",
+			policy:   "default-src 'self'",
+			hashes:   h,
+			expected: "default-src 'self'; script-src 'self' 'sha256-a'; style-src 'self' 'sha256-b'",
+		},
+		{
+			name:     "Adds hashes to existing directives",
+			policy:   "default-src 'none'; SCRIPT-SRC 'self' https://cdn.test;img-src *",
+			hashes:   h,
+			expected: "default-src 'none'; script-src 'self' https://cdn.test 'sha256-a'; img-src *; style-src 'sha256-b'",
+		},
+		{
+			name:     "Adds unsafe-hashes for style attributes",
+			policy:   "style-src 'self'",
+			hashes:   csp.Hashes{StyleAttrs: []string{"'sha256-c'"}},
+			expected: "style-src 'self' 'sha256-c' 'unsafe-hashes'",
+		},
+		{
+			name:     "Leaves directives allowing unsafe-inline as they are",
+			policy:   "default-src 'self'; script-src 'self' 'unsafe-inline'",
+			hashes:   h,
+			expected: "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'sha256-b'",
+		},
+		{
+			name:     "Leaves policies without default-src as they are",
+			policy:   "img-src 'self'",
+			hashes:   h,
+			expected: "img-src 'self'",
+		},
+		{
+			name:     "Leaves policies of pages without inline code as they are",
+			policy:   "default-src 'self'",
+			expected: "default-src 'self'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, csp.Policy(tt.policy, tt.hashes))
+		})
+	}
+}
+
+func TestMetaTransform(t *testing.T) {
+	transform := csp.MetaTransform("default-src 'self'")
+	meta := `<meta http-equiv="Content-Security-Policy" content="` + html.EscapeString("default-src 'self'; script-src 'self' "+hash("run()")) + `">`
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Adds the policy at the start of the head",
+			input:    `<!DOCTYPE html><html><head><title>x</title><script>run()</script></head></html>`,
+			expected: `<!DOCTYPE html><html><head>` + meta + `<title>x</title><script>run()</script></head></html>`,
+		},
+		{
+			name:     "Adds the policy after the doctype without a head",
+			input:    `<!DOCTYPE html><script>run()</script>`,
+			expected: `<!DOCTYPE html>` + meta + `<script>run()</script>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := transform("/index.html", []byte(tt.input))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(output))
+		})
+	}
+
+	t.Run("Leaves pages that are not html as they are", func(t *testing.T) {
+		output, err := transform("/feed.xml", []byte("<script>run()</script>"))
+		assert.NoError(t, err)
+		assert.Equal(t, "<script>run()</script>", string(output))
+	})
+}
+
+func TestHeaders(t *testing.T) {
+	headers := csp.Headers("default-src 'self'")
+
+	h := headers("/index.html", []byte("<script>run()</script>"))
+	assert.Equal(t, "default-src 'self'; script-src 'self' "+hash("run()"), h.Get(csp.Header))
+	assert.Nil(t, headers("/feed.xml", []byte("<script>run()</script>")))
+}
+
+func TestHeaderRules(t *testing.T) {
+	policies := map[string]string{
+		"/index.html":      "default-src 'self'",
+		"/about.html":      "default-src 'none'",
+		"/blog/index.html": "img-src *",
+	}
+	rules := csp.HeaderRules(policies, []string{"/index.html", "/about.html", "/blog/index.html", "/feed.xml"})
+
+	expected := "/index.html\n  Content-Security-Policy: default-src 'self'\n" +
+		"/\n  Content-Security-Policy: default-src 'self'\n" +
+		"/about.html\n  Content-Security-Policy: default-src 'none'\n" +
+		"/about\n  Content-Security-Policy: default-src 'none'\n" +
+		"/blog/index.html\n  Content-Security-Policy: img-src *\n" +
+		"/blog/\n  Content-Security-Policy: img-src *\n" +
+		"/blog\n  Content-Security-Policy: img-src *\n"
+	assert.Equal(t, expected, rules)
+}
@@ -0,0 +1,132 @@
+// Package css finds the URLs referenced by a stylesheet, without parsing the
+// rest of it, so they can be inspected or rewritten in place. Its scanning
+// functions are shared by the other packages reading stylesheets, so they all
+// read strings and url() values the same way.
+package css
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Ref is a URL referenced from a url() function or an @import rule.
+type Ref struct {
+	URL    string
+	Import bool
+	Line   int
+	// Start and End are the offsets of the URL in the source, excluding quotes.
+	Start int
+	End   int
+}
+
+// Refs returns every URL referenced by the stylesheet, in order. URLs in
+// comments are ignored.
+func Refs(src []byte) []Ref {
+	var refs []Ref
+	line := 1
+	lineAt := 0
+	lineOf := func(offset int) int {
+		for ; lineAt < offset; lineAt++ {
+			if src[lineAt] == '\n' {
+				line++
+			}
+		}
+		return line
+	}
+
+	for i := 0; i < len(src); {
+		switch {
+		case bytes.HasPrefix(src[i:], []byte("/*")):
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return refs
+			}
+			i += 2 + end + 2
+		case src[i] == '"' || src[i] == '\'':
+			i = StringEnd(src, i) + 1
+		case HasPrefixFold(src[i:], "url(") && (i == 0 || !IsIdent(src[i-1])):
+			start, end, next := URLValue(src, i+4)
+			if end > start {
+				refs = append(refs, Ref{URL: string(src[start:end]), Line: lineOf(start), Start: start, End: end})
+			}
+			i = next
+		case HasPrefixFold(src[i:], "@import"):
+			j := i + len("@import")
+			for j < len(src) && IsSpace(src[j]) {
+				j++
+			}
+			if j < len(src) && (src[j] == '"' || src[j] == '\'') {
+				end := StringEnd(src, j)
+				refs = append(refs, Ref{URL: string(src[j+1 : end]), Import: true, Line: lineOf(j), Start: j + 1, End: end})
+				i = end + 1
+				continue
+			}
+			if HasPrefixFold(src[j:], "url(") {
+				start, end, next := URLValue(src, j+4)
+				refs = append(refs, Ref{URL: string(src[start:end]), Import: true, Line: lineOf(start), Start: start, End: end})
+				i = next
+				continue
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return refs
+}
+
+// URLValue reads the contents of url(), starting after the opening parenthesis.
+// It returns the offsets of the URL, and the offset after the closing parenthesis.
+func URLValue(src []byte, i int) (int, int, int) {
+	for i < len(src) && IsSpace(src[i]) {
+		i++
+	}
+	if i < len(src) && (src[i] == '"' || src[i] == '\'') {
+		end := StringEnd(src, i)
+		paren := bytes.IndexByte(src[end:], ')')
+		if paren < 0 {
+			return i + 1, end, len(src)
+		}
+		return i + 1, end, end + paren + 1
+	}
+
+	start := i
+	for i < len(src) && src[i] != ')' {
+		i++
+	}
+	end := i
+	for end > start && IsSpace(src[end-1]) {
+		end--
+	}
+	return start, end, min(i+1, len(src))
+}
+
+// StringEnd returns the offset of the quote closing the string starting at i,
+// or of the line break ending it early, or the length of the source.
+func StringEnd(src []byte, i int) int {
+	quote := src[i]
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case quote, '\n':
+			return j
+		}
+	}
+	return len(src)
+}
+
+// HasPrefixFold reports whether the bytes start with the prefix, ignoring case.
+func HasPrefixFold(b []byte, prefix string) bool {
+	return len(b) >= len(prefix) && strings.EqualFold(string(b[:len(prefix)]), prefix)
+}
+
+// IsIdent reports whether the byte can be part of a name, such as a property or a class.
+func IsIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+// IsSpace reports whether the byte is whitespace.
+func IsSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,52 @@
+package css_test
+
+import (
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/css"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefs(t *testing.T) {
+	src := []byte(`@import "base.css";
+@import url('theme.css') screen;
+/* background: url(/commented.png) */
+.a { background: url( /bg.png ) }
+.b { background: URL("/quoted.png"), url('') }
+.c { content: "url(/in-string.png)"; mask: image-url(/not-a-url.png) }`)
+
+	refs := css.Refs(src)
+
+	var urls []string
+	for _, r := range refs {
+		urls = append(urls, r.URL)
+		assert.Equal(t, r.URL, string(src[r.Start:r.End]))
+	}
+	assert.Equal(t, []string{"base.css", "theme.css", "/bg.png", "/quoted.png"}, urls)
+	assert.True(t, refs[0].Import)
+	assert.True(t, refs[1].Import)
+	assert.False(t, refs[2].Import)
+	assert.Equal(t, 4, refs[2].Line)
+	assert.Equal(t, 5, refs[3].Line)
+}
+
+func TestURLValue(t *testing.T) {
+	tests := []struct {
+		src   string
+		url   string
+		after string
+	}{
+		{src: "url( /bg.png ) b", url: "/bg.png", after: " b"},
+		{src: `url("a)b.png") b`, url: "a)b.png", after: " b"},
+		{src: `url('a\'b.png' ) b`, url: `a\'b.png`, after: " b"},
+		{src: "url(/open", url: "/open", after: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			src := []byte(tt.src)
+			start, end, next := css.URLValue(src, len("url("))
+			assert.Equal(t, tt.url, string(src[start:end]))
+			assert.Equal(t, tt.after, string(src[next:]))
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LinkFS is a file system on disk, whose symbolic links can be read rather than
+// followed, and whose files can be hard linked.
+type LinkFS interface {
+	fs.FS
+	// Lstat returns the file info of the name, without following it if it is a symbolic link.
+	Lstat(name string) (fs.FileInfo, error)
+	// ReadLink returns the destination of the symbolic link at the name.
+	ReadLink(name string) (string, error)
+	// OSPath returns the path of the name on disk, or "" if it cannot be linked to.
+	OSPath(name string) string
+}
+
+// DirFS is the file system of the directory on disk, like os.DirFS, which also
+// implements LinkFS.
+type DirFS string
+
+func (d DirFS) Open(name string) (fs.File, error) {
+	return os.DirFS(string(d)).Open(name)
+}
+
+func (d DirFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(os.DirFS(string(d)), name)
+}
+
+func (d DirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(os.DirFS(string(d)), name)
+}
+
+func (d DirFS) Lstat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Lstat(d.OSPath(name))
+}
+
+func (d DirFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(d.OSPath(name))
+}
+
+func (d DirFS) OSPath(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+// SymlinkPolicy is how symbolic links are copied.
+type SymlinkPolicy int
+
+const (
+	// FollowSymlinks copies the files and directories symbolic links point to.
+	FollowSymlinks SymlinkPolicy = iota
+	// CopySymlinks copies symbolic links as links with the same destination,
+	// which must be within the file system.
+	CopySymlinks
+	// RejectSymlinks fails the copy at every symbolic link.
+	RejectSymlinks
+)
+
+// CopyOptions configures how files are copied.
+type CopyOptions struct {
+	Symlinks SymlinkPolicy
+	// HardLinks links files to the ones they are copied from instead, when they
+	// are on disk and the same file system as the destination.
+	HardLinks bool
+}
+
+// CopyReport describes the files copied to a directory.
+type CopyReport struct {
+	Files int
+	// Linked are the files that were hard linked rather than copied.
+	Linked int
+	// Symlinks are the symbolic links copied as links.
+	Symlinks int
+}
+
+// CopyFS copies every file of the file system to the directory, creating the
+// directories they are nested in. Files keep their mode, along with write
+// permission for their owner so they can be replaced, and their modification
+// time. Failures do not stop the copy, so every one is returned, each with the
+// path of its file.
+func CopyFS(fsys fs.FS, dst string, opts CopyOptions) (CopyReport, error) {
+	c := &copier{fsys: fsys, dst: dst, opts: opts}
+	c.links, _ = fsys.(LinkFS)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return c.report, err
+	}
+	root, err := fs.Stat(fsys, ".")
+	if err != nil {
+		return c.report, err
+	}
+	c.copyDir(".", []fs.FileInfo{root})
+	return c.report, errors.Join(c.errs...)
+}
+
+type copier struct {
+	fsys   fs.FS
+	links  LinkFS
+	dst    string
+	opts   CopyOptions
+	report CopyReport
+	errs   []error
+}
+
+func (c *copier) fail(name string, err error) {
+	// the path of the file is reported instead of the path it was read or written at
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	if name == "." {
+		name = ""
+	}
+	c.errs = append(c.errs, fmt.Errorf("could not copy '/%s': %w", name, err))
+}
+
+// copyDir copies the entries of the directory, which is nested in the
+// directories of its parents, to detect symbolic links leading back to them.
+func (c *copier) copyDir(dir string, parents []fs.FileInfo) {
+	entries, err := fs.ReadDir(c.fsys, dir)
+	if err != nil {
+		c.fail(dir, err)
+		return
+	}
+	for _, e := range entries {
+		name := path.Join(dir, e.Name())
+		target := filepath.Join(c.dst, filepath.FromSlash(name))
+		switch {
+		case e.Type()&fs.ModeSymlink != 0:
+			c.copySymlink(name, target, parents)
+		case e.IsDir():
+			info, err := e.Info()
+			if err != nil {
+				c.fail(name, err)
+				continue
+			}
+			c.mkdir(name, target, info, parents)
+		case e.Type().IsRegular():
+			info, err := e.Info()
+			if err != nil {
+				c.fail(name, err)
+				continue
+			}
+			c.copyFile(name, target, info, true)
+		default:
+			c.fail(name, fmt.Errorf("%s is not a regular file", e.Type()))
+		}
+	}
+}
+
+func (c *copier) mkdir(name string, target string, info fs.FileInfo, parents []fs.FileInfo) {
+	if isParent(info, parents) {
+		c.fail(name, errors.New("symbolic link leads back to a parent directory"))
+		return
+	}
+	// a link copied by a previous copy is replaced, rather than copied through
+	if existing, err := os.Lstat(target); err == nil && !existing.IsDir() {
+		if err := remove(target); err != nil {
+			c.fail(name, err)
+			return
+		}
+	}
+	if err := os.MkdirAll(target, info.Mode().Perm()|0700); err != nil {
+		c.fail(name, err)
+		return
+	}
+	c.copyDir(name, append(parents[:len(parents):len(parents)], info))
+	// the time is set once the contents are copied, as copying them changes it
+	if !info.ModTime().IsZero() {
+		if err := os.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+			c.fail(name, err)
+		}
+	}
+}
+
+func (c *copier) copySymlink(name string, target string, parents []fs.FileInfo) {
+	switch c.opts.Symlinks {
+	case RejectSymlinks:
+		c.fail(name, errors.New("symbolic links are not allowed"))
+	case CopySymlinks:
+		if c.links == nil {
+			c.fail(name, errors.New("symbolic link cannot be read"))
+			return
+		}
+		dest, err := c.links.ReadLink(name)
+		if err != nil {
+			c.fail(name, err)
+			return
+		}
+		// files written to the dist directory through the link must stay in it
+		if resolved := path.Join(path.Dir(name), filepath.ToSlash(dest)); filepath.IsAbs(dest) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+			c.fail(name, fmt.Errorf("symbolic link to '%s' leads outside of the public directory", dest))
+			return
+		}
+		// a directory copied by a previous copy is replaced too
+		if err := os.RemoveAll(target); err != nil {
+			c.fail(name, err)
+			return
+		}
+		if err := os.Symlink(dest, target); err != nil {
+			c.fail(name, err)
+			return
+		}
+		c.report.Symlinks++
+	default:
+		info, err := fs.Stat(c.fsys, name)
+		if err != nil {
+			c.fail(name, err)
+			return
+		}
+		if info.IsDir() {
+			c.mkdir(name, target, info, parents)
+			return
+		}
+		// the link itself would be hard linked, rather than the file it points to
+		c.copyFile(name, target, info, false)
+	}
+}
+
+func (c *copier) copyFile(name string, target string, info fs.FileInfo, linkable bool) {
+	// a directory copied by a previous copy is replaced too, along with its contents
+	if err := os.RemoveAll(target); err != nil {
+		c.fail(name, err)
+		return
+	}
+	if linkable && c.opts.HardLinks && c.links != nil {
+		if src := c.links.OSPath(name); src != "" && os.Link(src, target) == nil {
+			c.report.Files++
+			c.report.Linked++
+			return
+		}
+		// not on the same file system, so it is copied
+	}
+
+	src, err := c.fsys.Open(name)
+	if err != nil {
+		c.fail(name, err)
+		return
+	}
+	defer src.Close()
+	perm := info.Mode().Perm() | 0600
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		c.fail(name, err)
+		return
+	}
+	_, err = io.Copy(f, src)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// the mode is set again, as it was narrowed by the umask
+		err = os.Chmod(target, perm)
+	}
+	if err == nil && !info.ModTime().IsZero() {
+		err = os.Chtimes(target, info.ModTime(), info.ModTime())
+	}
+	if err != nil {
+		c.fail(name, err)
+		return
+	}
+	c.report.Files++
+}
+
+// WriteFile writes the data to a new file at the path, replacing the file that
+// is there rather than writing through it, as it may be hard linked to a public file.
+func WriteFile(filePath string, data []byte) error {
+	return WriteFileMode(filePath, data, 0644)
+}
+
+// WriteFileMode writes the data to a new file at the path like WriteFile, with
+// the mode, such as the mode of the file the data was read from.
+func WriteFileMode(filePath string, data []byte, perm fs.FileMode) error {
+	if err := remove(filePath); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, data, perm); err != nil {
+		return err
+	}
+	// the mode is set again, as it was narrowed by the umask
+	return os.Chmod(filePath, perm)
+}
+
+// remove removes the file at the path if there is one, so that a file hard
+// linked by a previous copy is replaced rather than written through.
+func remove(filePath string) error {
+	err := os.Remove(filePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
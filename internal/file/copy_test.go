@@ -0,0 +1,223 @@
+package file_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		assert.NoError(t, os.WriteFile(name, []byte(contents), 0644))
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestCopyFS(t *testing.T) {
+	t.Run("Copies nested files with their mode and modification time", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		writeFiles(t, src, map[string]string{"robots.txt": "User-agent: *", "a/b/c.sh": "echo"})
+		modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		assert.NoError(t, os.Chmod(filepath.Join(src, "a/b/c.sh"), 0750))
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "robots.txt"), modTime, modTime))
+
+		report, err := file.CopyFS(file.DirFS(src), dst, file.CopyOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, file.CopyReport{Files: 2}, report)
+		assert.Equal(t, "echo", readFile(t, filepath.Join(dst, "a/b/c.sh")))
+
+		info, err := os.Stat(filepath.Join(dst, "a/b/c.sh"))
+		assert.NoError(t, err)
+		assert.Equal(t, fs.FileMode(0750), info.Mode().Perm())
+		info, err = os.Stat(filepath.Join(dst, "robots.txt"))
+		assert.NoError(t, err)
+		assert.True(t, modTime.Equal(info.ModTime()))
+	})
+
+	t.Run("Keeps the modification time of directories", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		writeFiles(t, src, map[string]string{"a/b/c.txt": "c"})
+		modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "a"), modTime, modTime))
+
+		_, err := file.CopyFS(file.DirFS(src), dst, file.CopyOptions{})
+		assert.NoError(t, err)
+		info, err := os.Stat(filepath.Join(dst, "a"))
+		assert.NoError(t, err)
+		assert.True(t, modTime.Equal(info.ModTime()))
+	})
+
+	t.Run("Replaces directories left by a previous copy with files", func(t *testing.T) {
+		dst := t.TempDir()
+		writeFiles(t, dst, map[string]string{"a.txt/nested/old.txt": "old"})
+
+		_, err := file.CopyFS(fstest.MapFS{"a.txt": {Data: []byte("a")}}, dst, file.CopyOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "a", readFile(t, filepath.Join(dst, "a.txt")))
+	})
+
+	t.Run("Keeps files writable by their owner", func(t *testing.T) {
+		dst := t.TempDir()
+		_, err := file.CopyFS(fstest.MapFS{"robots.txt": {Data: []byte("User-agent: *"), Mode: 0444}}, dst, file.CopyOptions{})
+		assert.NoError(t, err)
+		info, err := os.Stat(filepath.Join(dst, "robots.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, fs.FileMode(0644), info.Mode().Perm())
+	})
+
+	t.Run("Returns every failure with the path of its file", func(t *testing.T) {
+		dst := t.TempDir()
+		// named pipes cannot be copied
+		report, err := file.CopyFS(fstest.MapFS{
+			"a.txt":     {Mode: fs.ModeNamedPipe},
+			"css/b.css": {Mode: fs.ModeNamedPipe},
+			"ok.txt":    {Data: []byte("ok")},
+		}, dst, file.CopyOptions{})
+		assert.ErrorContains(t, err, "could not copy '/a.txt'")
+		assert.ErrorContains(t, err, "could not copy '/css/b.css'")
+		assert.Equal(t, 1, report.Files)
+		assert.Equal(t, "ok", readFile(t, filepath.Join(dst, "ok.txt")))
+	})
+
+	t.Run("Follows symbolic links", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		writeFiles(t, src, map[string]string{"docs/index.html": "docs", "robots.txt": "User-agent: *"})
+		assert.NoError(t, os.Symlink("docs", filepath.Join(src, "manual")))
+		assert.NoError(t, os.Symlink("robots.txt", filepath.Join(src, "robots-link.txt")))
+
+		report, err := file.CopyFS(file.DirFS(src), dst, file.CopyOptions{Symlinks: file.FollowSymlinks})
+		assert.NoError(t, err)
+		assert.Equal(t, 4, report.Files)
+		assert.Equal(t, "docs", readFile(t, filepath.Join(dst, "manual/index.html")))
+		info, err := os.Lstat(filepath.Join(dst, "robots-link.txt"))
+		assert.NoError(t, err)
+		assert.True(t, info.Mode().IsRegular())
+	})
+
+	t.Run("Detects symbolic links leading back to a parent directory", func(t *testing.T) {
+		src := t.TempDir()
+		writeFiles(t, src, map[string]string{"a/b/c.txt": "c"})
+		assert.NoError(t, os.Symlink("..", filepath.Join(src, "a/b/up")))
+
+		_, err := file.CopyFS(file.DirFS(src), t.TempDir(), file.CopyOptions{Symlinks: file.FollowSymlinks})
+		assert.ErrorContains(t, err, "could not copy '/a/b/up': symbolic link leads back to a parent directory")
+	})
+
+	t.Run("Reports broken symbolic links", func(t *testing.T) {
+		src := t.TempDir()
+		assert.NoError(t, os.Symlink("missing.txt", filepath.Join(src, "broken.txt")))
+
+		_, err := file.CopyFS(file.DirFS(src), t.TempDir(), file.CopyOptions{Symlinks: file.FollowSymlinks})
+		assert.ErrorContains(t, err, "could not copy '/broken.txt'")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("Copies symbolic links as links", func(t *testing.T) {
+		src := t.TempDir()
+		dst := t.TempDir()
+		writeFiles(t, src, map[string]string{"docs/index.html": "docs"})
+		assert.NoError(t, os.Symlink("docs", filepath.Join(src, "manual")))
+
+		report, err := file.CopyFS(file.DirFS(src), dst, file.CopyOptions{Symlinks: file.CopySymlinks})
+		assert.NoError(t, err)
+		assert.Equal(t, file.CopyReport{Files: 1, Symlinks: 1}, report)
+		dest, err := os.Readlink(filepath.Join(dst, "manual"))
+		assert.NoError(t, err)
+		assert.Equal(t, "docs", dest)
+
+		t.Run("Replaces them when following them later", func(t *testing.T) {
+			_, err := file.CopyFS(file.DirFS(src), dst, file.CopyOptions{Symlinks: file.FollowSymlinks})
+			assert.NoError(t, err)
+			info, err := os.Lstat(filepath.Join(dst, "manual"))
+			assert.NoError(t, err)
+			assert.True(t, info.IsDir())
+		})
+	})
+
+	t.Run("Does not copy symbolic links leading outside as links", func(t *testing.T) {
+		src := t.TempDir()
+		assert.NoError(t, os.MkdirAll(filepath.Join(src, "a"), 0755))
+		assert.NoError(t, os.Symlink("../../shared", filepath.Join(src, "a", "shared")))
+		assert.NoError(t, os.Symlink("/etc", filepath.Join(src, "etc")))
+
+		_, err := file.CopyFS(file.DirFS(src), t.TempDir(), file.CopyOptions{Symlinks: file.CopySymlinks})
+		assert.ErrorContains(t, err, "could not copy '/a/shared': symbolic link to '../../shared' leads outside of the public directory")
+		assert.ErrorContains(t, err, "could not copy '/etc': symbolic link to '/etc' leads outside of the public directory")
+	})
+
+	t.Run("Rejects symbolic links", func(t *testing.T) {
+		src := t.TempDir()
+		writeFiles(t, src, map[string]string{"robots.txt": "User-agent: *"})
+		assert.NoError(t, os.Symlink("robots.txt", filepath.Join(src, "a.txt")))
+		assert.NoError(t, os.Symlink("robots.txt", filepath.Join(src, "b.txt")))
+
+		_, err := file.CopyFS(file.DirFS(src), t.TempDir(), file.CopyOptions{Symlinks: file.RejectSymlinks})
+		assert.ErrorContains(t, err, "could not copy '/a.txt': symbolic links are not allowed")
+		assert.ErrorContains(t, err, "could not copy '/b.txt': symbolic links are not allowed")
+	})
+
+	t.Run("Hard links files", func(t *testing.T) {
+		root := t.TempDir()
+		src := filepath.Join(root, "public")
+		dst := filepath.Join(root, "dist")
+		writeFiles(t, src, map[string]string{"video.mp4": "video", "css/main.css": "css"})
+
+		report, err := file.CopyFS(file.DirFS(src), dst, file.CopyOptions{HardLinks: true})
+		assert.NoError(t, err)
+		assert.Equal(t, file.CopyReport{Files: 2, Linked: 2}, report)
+		srcInfo, err := os.Stat(filepath.Join(src, "video.mp4"))
+		assert.NoError(t, err)
+		dstInfo, err := os.Stat(filepath.Join(dst, "video.mp4"))
+		assert.NoError(t, err)
+		assert.True(t, os.SameFile(srcInfo, dstInfo))
+
+		t.Run("Writing them replaces the link", func(t *testing.T) {
+			assert.NoError(t, file.WriteFile(filepath.Join(dst, "css/main.css"), []byte("minified")))
+			assert.Equal(t, "css", readFile(t, filepath.Join(src, "css/main.css")))
+			f, err := file.CreateFile(filepath.Join(dst, "video.mp4"))
+			assert.NoError(t, err)
+			f.Close()
+			assert.Equal(t, "video", readFile(t, filepath.Join(src, "video.mp4")))
+		})
+	})
+
+	t.Run("Copies files that cannot be hard linked", func(t *testing.T) {
+		report, err := file.CopyFS(fstest.MapFS{"robots.txt": {Data: []byte("User-agent: *")}}, t.TempDir(), file.CopyOptions{HardLinks: true})
+		assert.NoError(t, err)
+		assert.Equal(t, file.CopyReport{Files: 1}, report)
+	})
+}
+
+func TestWalkFiles(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{"docs/index.html": "docs", "robots.txt": "User-agent: *"})
+	assert.NoError(t, os.Symlink("docs", filepath.Join(src, "manual")))
+	assert.NoError(t, os.Symlink("..", filepath.Join(src, "docs", "up")))
+	assert.NoError(t, os.Symlink("missing.txt", filepath.Join(src, "broken.txt")))
+
+	var files []string
+	err := file.WalkFiles(file.DirFS(src), func(filePath string) error {
+		files = append(files, filePath)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/docs/index.html", "/manual/index.html", "/robots.txt"}, files)
+}
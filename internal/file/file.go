@@ -1,9 +1,11 @@
 package file
 
 import (
-	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
 func CreateFile(fileName string) (*os.File, error) {
@@ -11,6 +13,10 @@ func CreateFile(fileName string) (*os.File, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, err
 	}
+	// the file may be hard linked to a public file, so it is replaced
+	if err := remove(fileName); err != nil {
+		return nil, err
+	}
 
 	f, err := os.Create(fileName)
 	if err != nil {
@@ -19,49 +25,96 @@ func CreateFile(fileName string) (*os.File, error) {
 	return f, nil
 }
 
-func CopyFile(src string, dst string) error {
-	srcFile, err := os.Open(src)
+// WalkFiles calls fn with the path of every file of the file system, such as
+// '/css/main.css', in lexical order. Symbolic links to directories are followed,
+// unless they lead back to one of their parents, and links leading nowhere are skipped.
+func WalkFiles(fsys fs.FS, fn func(filePath string) error) error {
+	root, err := fs.Stat(fsys, ".")
 	if err != nil {
 		return err
 	}
-	defer srcFile.Close()
+	return walkFiles(fsys, ".", []fs.FileInfo{root}, fn)
+}
 
-	dstFile, err := os.Create(dst)
+func walkFiles(fsys fs.FS, dir string, parents []fs.FileInfo, fn func(filePath string) error) error {
+	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
 		return err
 	}
-	defer dstFile.Close()
-
-	_, err = io.Copy(dstFile, srcFile)
-	if err != nil {
-		return err
+	for _, e := range entries {
+		name := path.Join(dir, e.Name())
+		if !e.IsDir() && e.Type()&fs.ModeSymlink == 0 {
+			if err := fn("/" + name); err != nil {
+				return err
+			}
+			continue
+		}
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			if e.Type()&fs.ModeSymlink != 0 {
+				continue
+			}
+			return err
+		}
+		if !info.IsDir() {
+			if err := fn("/" + name); err != nil {
+				return err
+			}
+			continue
+		}
+		if isParent(info, parents) {
+			continue
+		}
+		if err := walkFiles(fsys, name, append(parents[:len(parents):len(parents)], info), fn); err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
 
-func CopyDir(src string, dst string) error {
-	src = filepath.Clean(src)
-	dst = filepath.Clean(dst)
-
-	if err := os.MkdirAll(dst, 0755); err != nil {
-		return err
+// isParent reports whether the directory is one of the parents, which a
+// symbolic link can lead back to.
+func isParent(info fs.FileInfo, parents []fs.FileInfo) bool {
+	for _, p := range parents {
+		if os.SameFile(p, info) {
+			return true
+		}
 	}
+	return false
+}
 
-	entries, err := os.ReadDir(src)
-	if err != nil {
-		return err
+// FSPath returns the name of the file at the path in a file system, such as
+// 'css/main.css' for '/css/main.css'. Paths cannot lead outside of it.
+func FSPath(filePath string) string {
+	p := strings.TrimPrefix(path.Clean("/"+filePath), "/")
+	if p == "" {
+		return "."
 	}
+	return p
+}
 
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
+// IsFile reports whether the path is a file of the file system, rather than
+// a directory or nothing at all.
+func IsFile(fsys fs.FS, filePath string) bool {
+	info, err := fs.Stat(fsys, FSPath(filePath))
+	return err == nil && !info.IsDir()
+}
 
-		if entry.IsDir() {
-			CopyDir(srcPath, dstPath)
-		} else {
-			CopyFile(srcPath, dstPath)
-		}
+// Candidates returns the files that may be served for a URL path, in order of
+// preference. The extension and index of html pages can be left out of the path.
+func Candidates(urlPath string) []string {
+	if urlPath == "" || strings.HasSuffix(urlPath, "/") {
+		dir := strings.TrimSuffix(urlPath, "/")
+		return []string{dir + "/index.html", dir + "/index.htm"}
 	}
-	return nil
+	if path.Ext(urlPath) == "" {
+		return []string{urlPath, urlPath + ".html", urlPath + ".htm", urlPath + "/index.html", urlPath + "/index.htm"}
+	}
+	return []string{urlPath}
+}
+
+// IsHTML reports whether the file is an html page, by its extension.
+func IsHTML(filePath string) bool {
+	ext := filepath.Ext(filePath)
+	return ext == ".html" || ext == ".htm"
 }
@@ -0,0 +1,274 @@
+package host
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Site is the set of files a host would have been deployed with. Paths are
+// relative to the site root (without the base path) and always start with "/".
+type Site interface {
+	Exists(filePath string) bool
+	ReadFile(filePath string) ([]byte, error)
+	ServeFile(w http.ResponseWriter, r *http.Request, filePath string, status int)
+}
+
+// Host describes the routing rules of a static site hosting platform.
+type Host struct {
+	Name string
+	// ResolveExtensionless serves '/foo' from '/foo.html' when it exists.
+	ResolveExtensionless bool
+	// RedirectHTMLExtension redirects '/foo.html' to '/foo' and '/foo/index.html' to '/foo/'.
+	RedirectHTMLExtension bool
+	// RedirectToFile redirects '/foo/' to '/foo' when only '/foo.html' exists.
+	RedirectToFile bool
+	// RedirectStatus is the status code used for the host's own redirects.
+	RedirectStatus int
+	// NestedNotFound looks for the closest '404.html' walking up from the requested path,
+	// instead of only the one at the root of the site.
+	NestedNotFound bool
+	// Redirects and Headers enable support for '_redirects' and '_headers' files.
+	Redirects bool
+	Headers   bool
+	// RedirectsShadowed only applies redirect rules when no file matches the path,
+	// unless the rule is forced with a '!' suffix on its status.
+	RedirectsShadowed bool
+	AllowedMethods    []string
+}
+
+var hosts = map[string]*Host{
+	"github-pages": {
+		Name:                 "github-pages",
+		ResolveExtensionless: true,
+		RedirectStatus:       http.StatusMovedPermanently,
+		AllowedMethods:       []string{http.MethodGet, http.MethodHead},
+	},
+	"cloudflare-pages": {
+		Name:                  "cloudflare-pages",
+		ResolveExtensionless:  true,
+		RedirectHTMLExtension: true,
+		RedirectToFile:        true,
+		RedirectStatus:        http.StatusPermanentRedirect,
+		NestedNotFound:        true,
+		Redirects:             true,
+		Headers:               true,
+		AllowedMethods:        []string{http.MethodGet, http.MethodHead},
+	},
+	"netlify": {
+		Name:                 "netlify",
+		ResolveExtensionless: true,
+		RedirectStatus:       http.StatusMovedPermanently,
+		Redirects:            true,
+		Headers:              true,
+		RedirectsShadowed:    true,
+		AllowedMethods:       []string{http.MethodGet, http.MethodHead},
+	},
+}
+
+// Names returns the names of all hosts that can be emulated.
+func Names() []string {
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the host with the given name.
+func Lookup(name string) (*Host, error) {
+	h, ok := hosts[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown host '%s', must be one of: %s", name, strings.Join(Names(), ", "))
+	}
+	return h, nil
+}
+
+// Handler returns a handler serving the site under the base path the same way
+// the host would. Requests that do not resolve to any file, and for which the
+// site has no '404.html' page of its own, are passed to notFound.
+func (h *Host) Handler(site Site, basePath string, notFound http.HandlerFunc) http.Handler {
+	var redirects []rule
+	var headers []headerRule
+	var loadErr error
+	if h.Redirects && site.Exists("/_redirects") {
+		data, err := site.ReadFile("/_redirects")
+		if err == nil {
+			redirects, err = parseRedirects(string(data))
+		}
+		if err != nil {
+			loadErr = fmt.Errorf("could not load _redirects: %w", err)
+		}
+	}
+	if h.Headers && site.Exists("/_headers") {
+		data, err := site.ReadFile("/_headers")
+		if err == nil {
+			headers, err = parseHeaders(string(data))
+		}
+		if err != nil {
+			loadErr = fmt.Errorf("could not load _headers: %w", err)
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if loadErr != nil {
+			http.Error(w, loadErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !h.allowsMethod(r.Method) {
+			w.Header().Set("Allow", strings.Join(h.AllowedMethods, ", "))
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, basePath) {
+			notFound(w, r)
+			return
+		}
+		p := strings.TrimPrefix(r.URL.Path, basePath)
+		if p != "" && !strings.HasPrefix(p, "/") {
+			notFound(w, r)
+			return
+		}
+
+		for _, hr := range headers {
+			if _, ok := hr.From.match(p); ok {
+				hr.apply(w.Header())
+			}
+		}
+
+		redirect := func(to string, status int) {
+			if strings.HasPrefix(to, "/") {
+				to = basePath + to
+			}
+			if r.URL.RawQuery != "" && !strings.Contains(to, "?") {
+				to += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, to, status)
+		}
+
+		applyRedirects := func(p string, forcedOnly bool) bool {
+			for _, rl := range redirects {
+				if forcedOnly && !rl.Force {
+					continue
+				}
+				to, ok := rl.match(p)
+				if !ok {
+					continue
+				}
+				if rl.Status == http.StatusOK || rl.Status == http.StatusNotFound {
+					if site.Exists(to) {
+						site.ServeFile(w, r, to, rl.Status)
+						return true
+					}
+					continue
+				}
+				redirect(to, rl.Status)
+				return true
+			}
+			return false
+		}
+
+		if len(redirects) > 0 && applyRedirects(p, h.RedirectsShadowed) {
+			return
+		}
+
+		if p == "" {
+			if site.Exists("/index.html") {
+				redirect("/", h.RedirectStatus)
+				return
+			}
+		} else if !h.isConfigFile(p) {
+			file, to := h.resolve(site, p)
+			if to != "" {
+				redirect(to, h.RedirectStatus)
+				return
+			}
+			if file != "" {
+				site.ServeFile(w, r, file, http.StatusOK)
+				return
+			}
+		}
+
+		if h.RedirectsShadowed && applyRedirects(p, false) {
+			return
+		}
+
+		if page, ok := h.notFoundPage(site, p); ok {
+			site.ServeFile(w, r, page, http.StatusNotFound)
+			return
+		}
+		notFound(w, r)
+	})
+}
+
+func (h *Host) allowsMethod(method string) bool {
+	for _, m := range h.AllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// isConfigFile reports whether the path is a configuration file read by the
+// host, which is never served to visitors.
+func (h *Host) isConfigFile(p string) bool {
+	return h.Redirects && p == "/_redirects" || h.Headers && p == "/_headers"
+}
+
+// resolve returns either the file the host serves for the path, or the path
+// it redirects to. Both are empty when nothing matches.
+func (h *Host) resolve(site Site, p string) (file string, redirect string) {
+	if strings.HasSuffix(p, "/") {
+		if site.Exists(p + "index.html") {
+			return p + "index.html", ""
+		}
+		trimmed := strings.TrimSuffix(p, "/")
+		if h.RedirectToFile && trimmed != "" && site.Exists(trimmed+".html") {
+			return "", trimmed
+		}
+		return "", ""
+	}
+
+	if site.Exists(p) {
+		if h.RedirectHTMLExtension && strings.HasSuffix(p, ".html") {
+			to := strings.TrimSuffix(p, ".html")
+			if strings.HasSuffix(to, "/index") {
+				to = strings.TrimSuffix(to, "index")
+			}
+			return "", to
+		}
+		return p, ""
+	}
+
+	if path.Ext(p) != "" {
+		return "", ""
+	}
+	if site.Exists(p + "/index.html") {
+		return "", p + "/"
+	}
+	if h.RedirectHTMLExtension && strings.HasSuffix(p, "/index") && site.Exists(p+".html") {
+		return "", strings.TrimSuffix(p, "index")
+	}
+	if h.ResolveExtensionless && site.Exists(p+".html") {
+		return p + ".html", ""
+	}
+	return "", ""
+}
+
+func (h *Host) notFoundPage(site Site, p string) (string, bool) {
+	dir := path.Dir(p)
+	if strings.HasSuffix(p, "/") {
+		dir = strings.TrimSuffix(p, "/")
+	}
+	for h.NestedNotFound && dir != "/" && dir != "." && dir != "" {
+		if site.Exists(dir + "/404.html") {
+			return dir + "/404.html", true
+		}
+		dir = path.Dir(dir)
+	}
+	return "/404.html", site.Exists("/404.html")
+}
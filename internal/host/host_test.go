@@ -0,0 +1,146 @@
+package host_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/host"
+	"github.com/stretchr/testify/assert"
+)
+
+type mapSite map[string]string
+
+func (m mapSite) Exists(filePath string) bool {
+	_, ok := m[filePath]
+	return ok
+}
+
+func (m mapSite) ReadFile(filePath string) ([]byte, error) {
+	data, ok := m[filePath]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return []byte(data), nil
+}
+
+func (m mapSite) ServeFile(w http.ResponseWriter, r *http.Request, filePath string, status int) {
+	w.WriteHeader(status)
+	w.Write([]byte(m[filePath]))
+}
+
+func TestHost(t *testing.T) {
+	site := mapSite{
+		"/index.html":        "index",
+		"/foo.html":          "foo",
+		"/bar.htm":           "bar",
+		"/nested/index.html": "nested-index",
+		"/other/index.htm":   "other-index",
+		"/styles.css":        "styles",
+		"/404.html":          "custom-404",
+		"/blog/404.html":     "blog-404",
+		"/_redirects":        "# comment\n/old /foo 302\n/posts/:slug /blog/:slug\n/app/* /index.html 200\n/foo /nested/ 301!\n",
+		"/_headers":          "/*\n  X-Frame-Options: DENY\n/styles.css\n  Cache-Control: max-age=3600\n",
+	}
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("dev-404"))
+	}
+
+	tests := []struct {
+		host             string
+		method           string
+		path             string
+		expectedStatus   int
+		expectedBody     string
+		expectedLocation string
+		expectedHeader   [2]string
+	}{
+		{host: "github-pages", path: "/", expectedStatus: http.StatusOK, expectedBody: "index"},
+		{host: "github-pages", path: "/foo", expectedStatus: http.StatusOK, expectedBody: "foo"},
+		{host: "github-pages", path: "/foo.html", expectedStatus: http.StatusOK, expectedBody: "foo"},
+		{host: "github-pages", path: "/bar", expectedStatus: http.StatusNotFound, expectedBody: "custom-404"},
+		{host: "github-pages", path: "/nested", expectedStatus: http.StatusMovedPermanently, expectedLocation: "/nested/"},
+		{host: "github-pages", path: "/nested/", expectedStatus: http.StatusOK, expectedBody: "nested-index"},
+		{host: "github-pages", path: "/other/", expectedStatus: http.StatusNotFound, expectedBody: "custom-404"},
+		{host: "github-pages", path: "/blog/nope", expectedStatus: http.StatusNotFound, expectedBody: "custom-404"},
+		{host: "github-pages", path: "/_redirects", expectedStatus: http.StatusOK},
+		{host: "github-pages", path: "/old", expectedStatus: http.StatusNotFound},
+		{host: "github-pages", method: http.MethodPost, path: "/", expectedStatus: http.StatusMethodNotAllowed},
+		{host: "cloudflare-pages", path: "/foo.html", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "/foo"},
+		{host: "cloudflare-pages", path: "/nested/index.html", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "/nested/"},
+		{host: "cloudflare-pages", path: "/nested/index", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "/nested/"},
+		{host: "cloudflare-pages", path: "/foo/", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "/foo"},
+		{host: "cloudflare-pages", path: "/blog/nope", expectedStatus: http.StatusNotFound, expectedBody: "blog-404"},
+		{host: "cloudflare-pages", path: "/old?a=b", expectedStatus: http.StatusFound, expectedLocation: "/foo?a=b"},
+		{host: "cloudflare-pages", path: "/posts/hello", expectedStatus: http.StatusMovedPermanently, expectedLocation: "/blog/hello"},
+		{host: "cloudflare-pages", path: "/app/some/route", expectedStatus: http.StatusOK, expectedBody: "index"},
+		{host: "cloudflare-pages", path: "/_headers", expectedStatus: http.StatusNotFound},
+		{host: "cloudflare-pages", path: "/styles.css", expectedStatus: http.StatusOK, expectedHeader: [2]string{"Cache-Control", "max-age=3600"}},
+		{host: "cloudflare-pages", path: "/styles.css", expectedStatus: http.StatusOK, expectedHeader: [2]string{"X-Frame-Options", "DENY"}},
+		{host: "cloudflare-pages", path: "/foo", expectedStatus: http.StatusMovedPermanently, expectedLocation: "/nested/"},
+		{host: "netlify", path: "/foo", expectedStatus: http.StatusMovedPermanently, expectedLocation: "/nested/"},
+		{host: "netlify", path: "/foo.html", expectedStatus: http.StatusOK, expectedBody: "foo"},
+		{host: "netlify", path: "/old", expectedStatus: http.StatusFound, expectedLocation: "/foo"},
+		{host: "netlify", path: "/blog/nope", expectedStatus: http.StatusNotFound, expectedBody: "custom-404"},
+	}
+
+	for _, tt := range tests {
+		method := tt.method
+		if method == "" {
+			method = http.MethodGet
+		}
+		t.Run(tt.host+" "+method+" "+tt.path, func(t *testing.T) {
+			h, err := host.Lookup(tt.host)
+			assert.NoError(t, err)
+
+			for _, basePath := range []string{"", "/base"} {
+				rec := httptest.NewRecorder()
+				req := httptest.NewRequest(method, basePath+tt.path, nil)
+				h.Handler(site, basePath, notFound).ServeHTTP(rec, req)
+
+				body, err := io.ReadAll(rec.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedStatus, rec.Code)
+				if tt.expectedBody != "" {
+					assert.Equal(t, tt.expectedBody, string(body))
+				}
+				if tt.expectedLocation != "" {
+					assert.Equal(t, basePath+tt.expectedLocation, rec.Header().Get("Location"))
+				}
+				if tt.expectedHeader[0] != "" {
+					assert.Equal(t, tt.expectedHeader[1], rec.Header().Get(tt.expectedHeader[0]))
+				}
+			}
+		})
+	}
+
+	t.Run("Requests outside of the base path are not found", func(t *testing.T) {
+		h, err := host.Lookup("github-pages")
+		assert.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		h.Handler(site, "/base", notFound).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/foo", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Equal(t, "dev-404", rec.Body.String())
+	})
+
+	t.Run("Errors for unknown host", func(t *testing.T) {
+		_, err := host.Lookup("geocities")
+		assert.Error(t, err)
+		assert.ErrorContains(t, err, "github-pages")
+	})
+
+	t.Run("Invalid _redirects file results in an error response", func(t *testing.T) {
+		h, err := host.Lookup("netlify")
+		assert.NoError(t, err)
+
+		invalid := mapSite{"/index.html": "index", "/_redirects": "/only-source"}
+		rec := httptest.NewRecorder()
+		h.Handler(invalid, "", notFound).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Contains(t, rec.Body.String(), "line 1")
+	})
+}
@@ -0,0 +1,150 @@
+package host
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// pattern matches site paths against a rule source such as '/blog/:slug' or
+// '/docs/*', collecting the placeholder values and the splat.
+type pattern string
+
+func (pt pattern) match(p string) (map[string]string, bool) {
+	params := map[string]string{}
+	srcSegments := strings.Split(string(pt), "/")
+	pathSegments := strings.Split(p, "/")
+
+	if srcSegments[len(srcSegments)-1] == "*" {
+		srcSegments = srcSegments[:len(srcSegments)-1]
+		if len(pathSegments) < len(srcSegments) {
+			return nil, false
+		}
+		params["splat"] = strings.Join(pathSegments[len(srcSegments):], "/")
+		pathSegments = pathSegments[:len(srcSegments)]
+	} else if len(srcSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	for i, seg := range srcSegments {
+		if strings.HasPrefix(seg, ":") && pathSegments[i] != "" {
+			params[seg[1:]] = pathSegments[i]
+			continue
+		}
+		if seg != pathSegments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+type rule struct {
+	From   pattern
+	To     string
+	Status int
+	Force  bool
+}
+
+// match returns the destination of the rule for the path, with any
+// placeholders and splat substituted.
+func (rl rule) match(p string) (string, bool) {
+	params, ok := rl.From.match(p)
+	if !ok {
+		return "", false
+	}
+	to := rl.To
+	for name, value := range params {
+		to = strings.ReplaceAll(to, ":"+name, value)
+	}
+	return to, true
+}
+
+// parseRedirects parses the contents of a '_redirects' file, where each line
+// is a rule of the form 'from to [status]'.
+func parseRedirects(contents string) ([]rule, error) {
+	var rules []rule
+	for i, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected 'from to [status]', got '%s'", i+1, line)
+		}
+		if !strings.HasPrefix(fields[0], "/") {
+			return nil, fmt.Errorf("line %d: source '%s' must start with '/'", i+1, fields[0])
+		}
+
+		rl := rule{From: pattern(fields[0]), To: fields[1], Status: http.StatusMovedPermanently}
+		if len(fields) == 3 {
+			status := fields[2]
+			if strings.HasSuffix(status, "!") {
+				rl.Force = true
+				status = strings.TrimSuffix(status, "!")
+			}
+			code, err := strconv.Atoi(status)
+			if err != nil || code < 200 || code > 599 {
+				return nil, fmt.Errorf("line %d: invalid status '%s'", i+1, fields[2])
+			}
+			rl.Status = code
+		}
+		rules = append(rules, rl)
+	}
+	return rules, nil
+}
+
+type headerRule struct {
+	From   pattern
+	Set    http.Header
+	Detach []string
+}
+
+func (hr headerRule) apply(h http.Header) {
+	for _, name := range hr.Detach {
+		h.Del(name)
+	}
+	for name, values := range hr.Set {
+		for _, v := range values {
+			h.Add(name, v)
+		}
+	}
+}
+
+// parseHeaders parses the contents of a '_headers' file, made of path patterns
+// followed by indented 'Name: value' lines. A '! Name' line removes a header
+// set by an earlier matching rule.
+func parseHeaders(contents string) ([]headerRule, error) {
+	var rules []headerRule
+	for i, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		indented := strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+		if !indented {
+			if !strings.HasPrefix(trimmed, "/") {
+				return nil, fmt.Errorf("line %d: path '%s' must start with '/'", i+1, trimmed)
+			}
+			rules = append(rules, headerRule{From: pattern(trimmed), Set: http.Header{}})
+			continue
+		}
+
+		if len(rules) == 0 {
+			return nil, fmt.Errorf("line %d: header '%s' is not under any path", i+1, trimmed)
+		}
+		current := &rules[len(rules)-1]
+		if strings.HasPrefix(trimmed, "!") {
+			current.Detach = append(current.Detach, strings.TrimSpace(strings.TrimPrefix(trimmed, "!")))
+			continue
+		}
+		name, value, ok := strings.Cut(trimmed, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("line %d: expected 'Name: value', got '%s'", i+1, trimmed)
+		}
+		current.Set.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return rules, nil
+}
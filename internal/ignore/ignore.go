@@ -0,0 +1,322 @@
+// Package ignore hides the files of a file system matching gitignore style
+// patterns, such as editor swap files or source files of assets, so they are
+// neither built nor served.
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/man-on-box/litepage/internal/file"
+)
+
+// FileName is the name of the file listing the patterns of a public directory, at its root.
+const FileName = ".litepageignore"
+
+// Matcher matches paths against gitignore style patterns, where the last
+// pattern matching a path decides whether it is ignored.
+type Matcher struct {
+	patterns []pattern
+}
+
+type pattern struct {
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// Parse returns the patterns of the lines of an ignore file. Blank lines and
+// lines starting with '#' are skipped.
+func Parse(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// New compiles the patterns, which follow the syntax of .gitignore files:
+//   - a pattern without a slash matches a file or directory at any depth, such as '.DS_Store'
+//   - a pattern with a slash at its start or middle matches from the root, such as '/drafts' or 'img/src'
+//   - a pattern ending with a slash only matches directories, such as 'src/'
+//   - '*' and '?' match anything but a slash, '[a-z]' matches a range, and '**' matches any number of directories
+//   - a pattern starting with '!' includes again what an earlier pattern ignored, unless its directory is ignored
+func New(patterns ...string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, source := range patterns {
+		p, err := compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern '%s': %w", source, err)
+		}
+		if p != nil {
+			m.patterns = append(m.patterns, *p)
+		}
+	}
+	return m, nil
+}
+
+func compile(source string) (*pattern, error) {
+	p := &pattern{}
+	s := strings.TrimRight(source, " \t")
+	if strings.HasSuffix(s, "\\") && len(s) < len(source) {
+		// an escaped trailing space is kept
+		s += " "
+	}
+	switch {
+	case strings.HasPrefix(s, "!"):
+		p.negate = true
+		s = s[1:]
+	case strings.HasPrefix(s, `\!`), strings.HasPrefix(s, `\#`):
+		s = s[1:]
+	}
+	if strings.HasSuffix(s, "/") {
+		p.dirOnly = true
+		s = strings.TrimRight(s, "/")
+	}
+	if s == "" {
+		return nil, nil
+	}
+
+	anchored := strings.Contains(s, "/")
+	s = strings.TrimPrefix(s, "/")
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '*' && strings.HasPrefix(s[i:], "**") && (i == 0 || s[i-1] == '/') && (i+2 == len(s) || s[i+2] == '/'):
+			switch {
+			case i+2 == len(s):
+				// trailing '/**' matches everything inside
+				re.WriteString(".*")
+			default:
+				// leading '**/' and '/**/' match zero or more directories
+				re.WriteString("(?:.*/)?")
+				i++
+			}
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(s[i+1:], ']')
+			if end < 0 {
+				return nil, errors.New("unclosed '['")
+			}
+			class := s[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(s):
+			i++
+			re.WriteString(regexp.QuoteMeta(string(s[i])))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, err
+	}
+	p.re = compiled
+	return p, nil
+}
+
+// Ignored reports whether the file or directory at the name, such as
+// 'css/main.css', is ignored, either by a pattern or because one of the
+// directories it is in is ignored.
+func (m *Matcher) Ignored(name string, isDir bool) bool {
+	if name == "." || name == "" {
+		return false
+	}
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if m.match(dir, true) {
+			return true
+		}
+	}
+	return m.match(name, isDir)
+}
+
+// match reports whether the last pattern matching the name ignores it.
+func (m *Matcher) match(name string, isDir bool) bool {
+	ignored := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(name) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// FS is a file system without the files and directories its matcher ignores,
+// which are reported as not existing.
+type FS struct {
+	fsys    fs.FS
+	matcher *Matcher
+}
+
+func NewFS(fsys fs.FS, matcher *Matcher) *FS {
+	return &FS{fsys: fsys, matcher: matcher}
+}
+
+// Open opens the file or directory at the name, unless it is ignored.
+func (f *FS) Open(name string) (fs.File, error) {
+	info, err := f.Stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errors.Unwrap(err)}
+	}
+	file, err := f.fsys.Open(name)
+	if err != nil || !info.IsDir() {
+		// files are returned as they are, so they can still be seeked when served
+		return file, err
+	}
+	return &filtered{File: file, fs: f, name: name}, nil
+}
+
+// Stat returns the file info of the name, unless it is ignored.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	info, err := fs.Stat(f.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if f.matcher.Ignored(name, info.IsDir()) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return info, nil
+}
+
+// ReadDir returns the entries of the directory that are not ignored.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if _, err := f.Stat(name); err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.Unwrap(err)}
+	}
+	entries, err := fs.ReadDir(f.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return f.filter(name, entries), nil
+}
+
+// Lstat returns the file info of the name without following it if it is a
+// symbolic link, unless it is ignored.
+func (f *FS) Lstat(name string) (fs.FileInfo, error) {
+	links, ok := f.fsys.(file.LinkFS)
+	if !ok {
+		return f.Stat(name)
+	}
+	if f.ignored(name) {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+	}
+	return links.Lstat(name)
+}
+
+// ReadLink returns the destination of the symbolic link at the name, unless it is ignored.
+func (f *FS) ReadLink(name string) (string, error) {
+	links, ok := f.fsys.(file.LinkFS)
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	if f.ignored(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+	}
+	return links.ReadLink(name)
+}
+
+// OSPath returns the path on disk of the name, or "" if it is ignored or not on disk.
+func (f *FS) OSPath(name string) string {
+	links, ok := f.fsys.(file.LinkFS)
+	if !ok || f.ignored(name) {
+		return ""
+	}
+	return links.OSPath(name)
+}
+
+// ignored reports whether the name is ignored, including symbolic links that
+// lead nowhere, which are matched as files.
+func (f *FS) ignored(name string) bool {
+	if !fs.ValidPath(name) {
+		return true
+	}
+	info, err := fs.Stat(f.fsys, name)
+	return f.matcher.Ignored(name, err == nil && info.IsDir())
+}
+
+func (f *FS) filter(dir string, entries []fs.DirEntry) []fs.DirEntry {
+	kept := entries[:0:0]
+	for _, e := range entries {
+		name := path.Join(dir, e.Name())
+		isDir := e.IsDir()
+		if e.Type()&fs.ModeSymlink != 0 {
+			// links to directories are matched as directories, like Stat does
+			info, err := fs.Stat(f.fsys, name)
+			isDir = err == nil && info.IsDir()
+		}
+		if !f.matcher.match(name, isDir) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// filtered is a file opened from the file system, whose directory entries are
+// filtered like the ones returned by ReadDir.
+type filtered struct {
+	fs.File
+	fs      *FS
+	name    string
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *filtered) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		dir, ok := d.File.(fs.ReadDirFile)
+		if !ok {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: errors.New("not a directory")}
+		}
+		entries, err := dir.ReadDir(-1)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = d.fs.filter(d.name, entries)
+		d.read = true
+	}
+	if n <= 0 {
+		rest := d.entries
+		d.entries = nil
+		return rest, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	rest := d.entries[:n]
+	d.entries = d.entries[n:]
+	return rest, nil
+}
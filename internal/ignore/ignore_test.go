@@ -0,0 +1,144 @@
+package ignore_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/ignore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		ignored  bool
+	}{
+		{name: "Name at the root", patterns: []string{".DS_Store"}, path: ".DS_Store", ignored: true},
+		{name: "Name at any depth", patterns: []string{".DS_Store"}, path: "img/icons/.DS_Store", ignored: true},
+		{name: "Other name", patterns: []string{".DS_Store"}, path: "img/DS_Store", ignored: false},
+		{name: "Extension", patterns: []string{"*.psd"}, path: "img/hero.psd", ignored: true},
+		{name: "Star does not match slashes", patterns: []string{"img/*.psd"}, path: "img/src/hero.psd", ignored: false},
+		{name: "Swap files", patterns: []string{"*.sw?"}, path: "css/.main.css.swp", ignored: true},
+		{name: "Range", patterns: []string{"*.[ot]tf"}, path: "fonts/a.ttf", ignored: true},
+		{name: "Negated range", patterns: []string{"file[!0-9]"}, path: "file1", ignored: false},
+		{name: "Anchored at the root", patterns: []string{"/drafts"}, path: "drafts", isDir: true, ignored: true},
+		{name: "Anchored is not matched deeper", patterns: []string{"/drafts"}, path: "blog/drafts", isDir: true, ignored: false},
+		{name: "Slash in the middle is anchored", patterns: []string{"img/src"}, path: "assets/img/src", isDir: true, ignored: false},
+		{name: "Files in an ignored directory", patterns: []string{"src/"}, path: "img/src/hero.png", ignored: true},
+		{name: "Directory pattern does not match files", patterns: []string{"src/"}, path: "img/src", ignored: false},
+		{name: "Leading double star", patterns: []string{"**/cache"}, path: "a/b/cache", isDir: true, ignored: true},
+		{name: "Trailing double star", patterns: []string{"raw/**"}, path: "raw/a/b.png", ignored: true},
+		{name: "Middle double star", patterns: []string{"a/**/b.txt"}, path: "a/b.txt", ignored: true},
+		{name: "Middle double star with directories", patterns: []string{"a/**/b.txt"}, path: "a/x/y/b.txt", ignored: true},
+		{name: "Negation", patterns: []string{"*.txt", "!robots.txt"}, path: "robots.txt", ignored: false},
+		{name: "Last pattern wins", patterns: []string{"!robots.txt", "*.txt"}, path: "robots.txt", ignored: true},
+		{name: "Negation cannot include a file of an ignored directory", patterns: []string{"drafts/", "!drafts/keep.html"}, path: "drafts/keep.html", ignored: true},
+		{name: "Escaped hash", patterns: []string{`\#notes`}, path: "#notes", ignored: true},
+		{name: "Escaped bang", patterns: []string{`\!important`}, path: "!important", ignored: true},
+		{name: "Trailing spaces are trimmed", patterns: []string{"*.log  "}, path: "debug.log", ignored: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ignore.New(tt.patterns...)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.ignored, m.Ignored(tt.path, tt.isDir))
+		})
+	}
+
+	t.Run("Never ignores the root", func(t *testing.T) {
+		m, err := ignore.New("*")
+		assert.NoError(t, err)
+		assert.False(t, m.Ignored(".", true))
+	})
+
+	t.Run("Rejects invalid patterns", func(t *testing.T) {
+		_, err := ignore.New("img/[a-z")
+		assert.ErrorContains(t, err, "invalid ignore pattern 'img/[a-z'")
+	})
+}
+
+func TestParse(t *testing.T) {
+	data := []byte("# editor files\r\n*.swp\n\n   \n.DS_Store\n!keep.swp\n")
+	assert.Equal(t, []string{"*.swp", ".DS_Store", "!keep.swp"}, ignore.Parse(data))
+}
+
+func TestFS(t *testing.T) {
+	m, err := ignore.New(".DS_Store", "*.psd", "src/")
+	assert.NoError(t, err)
+	f := ignore.NewFS(fstest.MapFS{
+		"index.css":          {Data: []byte("css")},
+		".DS_Store":          {Data: []byte("finder")},
+		"img/logo.png":       {Data: []byte("png")},
+		"img/logo.psd":       {Data: []byte("psd")},
+		"img/.DS_Store":      {Data: []byte("finder")},
+		"img/src/logo.png":   {Data: []byte("source")},
+		"img/src/nested/a.b": {Data: []byte("source")},
+	}, m)
+
+	t.Run("Passes the file system checks", func(t *testing.T) {
+		assert.NoError(t, fstest.TestFS(f, "index.css", "img/logo.png"))
+	})
+
+	t.Run("Hides ignored files", func(t *testing.T) {
+		for _, name := range []string{".DS_Store", "img/logo.psd", "img/.DS_Store", "img/src", "img/src/logo.png", "img/src/nested/a.b"} {
+			_, err := fs.Stat(f, name)
+			assert.ErrorIs(t, err, fs.ErrNotExist, name)
+			_, err = f.Open(name)
+			assert.ErrorIs(t, err, fs.ErrNotExist, name)
+			_, err = fs.ReadFile(f, name)
+			assert.ErrorIs(t, err, fs.ErrNotExist, name)
+		}
+	})
+
+	t.Run("Lists the files that are not ignored", func(t *testing.T) {
+		var files []string
+		err := fs.WalkDir(f, ".", func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				files = append(files, p)
+			}
+			return err
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"img/logo.png", "index.css"}, files)
+	})
+
+	t.Run("Reads the files that are not ignored", func(t *testing.T) {
+		data, err := fs.ReadFile(f, "img/logo.png")
+		assert.NoError(t, err)
+		assert.Equal(t, "png", string(data))
+	})
+
+	t.Run("Rejects invalid paths", func(t *testing.T) {
+		_, err := f.Open("../secret")
+		assert.ErrorIs(t, err, fs.ErrInvalid)
+	})
+}
+
+func TestFSWithSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "img", "sources"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "img", "sources", "logo.psd"), []byte("psd"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "img", "logo.png"), []byte("png"), 0644))
+	assert.NoError(t, os.Symlink("sources", filepath.Join(dir, "img", "src")))
+
+	m, err := ignore.New("src/", "sources/")
+	assert.NoError(t, err)
+	f := ignore.NewFS(file.DirFS(dir), m)
+
+	_, err = fs.Stat(f, "img/src")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	entries, err := fs.ReadDir(f, "img")
+	assert.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"logo.png"}, names)
+}
@@ -0,0 +1,249 @@
+// Package images reads the dimensions of the images of a public directory, so
+// that pages can reserve their space before they load.
+package images
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"math"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/man-on-box/litepage/internal/asset"
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/markup"
+	"github.com/man-on-box/litepage/internal/model"
+	"github.com/man-on-box/litepage/internal/rewrite"
+)
+
+// ErrUnsupported is returned for files that are not images of a supported format.
+var ErrUnsupported = errors.New("unsupported image format")
+
+// Size is the intrinsic width and height of an image, in pixels.
+type Size struct {
+	Width  int
+	Height int
+}
+
+// Decode reads the size of an image from its header. PNG, JPEG and GIF images
+// are read with the standard decoders, SVG images from the width and height or
+// viewBox of their root element. Images whose EXIF orientation turns them by a
+// quarter have their width and height swapped, as browsers display them.
+func Decode(r io.Reader, ext string) (Size, error) {
+	switch strings.ToLower(ext) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return Size{}, err
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return Size{}, err
+		}
+		// photos are displayed rotated by their orientation, so their width and height are swapped
+		if transposed(orientation(data, ext)) {
+			return Size{Width: config.Height, Height: config.Width}, nil
+		}
+		return Size{Width: config.Width, Height: config.Height}, nil
+	case ".svg":
+		return decodeSVG(r)
+	}
+	return Size{}, ErrUnsupported
+}
+
+func decodeSVG(r io.Reader) (Size, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return Size{}, fmt.Errorf("no svg element found")
+		}
+		if err != nil {
+			return Size{}, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "svg" {
+			return Size{}, fmt.Errorf("root element is '%s', not svg", start.Name.Local)
+		}
+
+		var width, height, viewBox string
+		for _, a := range start.Attr {
+			switch a.Name.Local {
+			case "width":
+				width = a.Value
+			case "height":
+				height = a.Value
+			case "viewBox":
+				viewBox = a.Value
+			}
+		}
+		return svgSize(width, height, viewBox)
+	}
+}
+
+// svgSize returns the size of an svg element from its attributes. Lengths that
+// are not in pixels, such as '100%', are left for the viewBox to set.
+func svgSize(width string, height string, viewBox string) (Size, error) {
+	w, wOK := pixels(width)
+	h, hOK := pixels(height)
+	if wOK && hOK {
+		return Size{Width: round(w), Height: round(h)}, nil
+	}
+
+	fields := strings.FieldsFunc(viewBox, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' || r == '\n' })
+	if len(fields) != 4 {
+		return Size{}, fmt.Errorf("svg has neither a width and height in pixels nor a viewBox")
+	}
+	vw, err1 := strconv.ParseFloat(fields[2], 64)
+	vh, err2 := strconv.ParseFloat(fields[3], 64)
+	if err1 != nil || err2 != nil || vw <= 0 || vh <= 0 {
+		return Size{}, fmt.Errorf("svg viewBox is not valid '%s'", viewBox)
+	}
+	switch {
+	case wOK:
+		return Size{Width: round(w), Height: round(w * vh / vw)}, nil
+	case hOK:
+		return Size{Width: round(h * vw / vh), Height: round(h)}, nil
+	}
+	return Size{Width: round(vw), Height: round(vh)}, nil
+}
+
+// pixels parses a length in pixels, such as '24' or '24px'.
+func pixels(length string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(length), "px"), 64)
+	return v, err == nil && v > 0
+}
+
+func round(v float64) int {
+	return int(math.Round(v))
+}
+
+type cached struct {
+	modTime time.Time
+	size    int64
+	dims    Size
+}
+
+// Sizes reads the size of the public images, and remembers each until the size
+// or modification time of the file changes.
+type Sizes struct {
+	files fs.FS
+
+	mu      sync.Mutex
+	entries map[string]cached
+}
+
+func NewSizes(public fs.FS) *Sizes {
+	return &Sizes{files: public, entries: map[string]cached{}}
+}
+
+// Lookup returns the size of the public image.
+func (s *Sizes) Lookup(filePath string) (Size, error) {
+	name := file.FSPath(filePath)
+	info, err := fs.Stat(s.files, name)
+	if err != nil {
+		return Size{}, fmt.Errorf("could not read size of image '%s': %w", filePath, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[filePath]; ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+		return e.dims, nil
+	}
+
+	f, err := s.files.Open(name)
+	if err != nil {
+		return Size{}, fmt.Errorf("could not read size of image '%s': %w", filePath, err)
+	}
+	defer f.Close()
+	dims, err := Decode(f, path.Ext(filePath))
+	if err != nil {
+		return Size{}, fmt.Errorf("could not read size of image '%s': %w", filePath, err)
+	}
+	s.entries[filePath] = cached{modTime: info.ModTime(), size: info.Size(), dims: dims}
+	return dims, nil
+}
+
+// SizeTransform returns a transform that adds the missing width and height
+// attributes of the img tags of html pages that load a public image. When only
+// one of them is set, the other is computed from the aspect ratio of the image.
+// Images that cannot be read are left as they are.
+func SizeTransform(sizes *Sizes, fingerprints *asset.Fingerprinter, basePath string) model.Transform {
+	return func(pagePath string, contents []byte) ([]byte, error) {
+		if !file.IsHTML(pagePath) {
+			return contents, nil
+		}
+
+		var edits []rewrite.Edit
+		for _, tok := range markup.Tokenize(contents) {
+			if tok.Type != markup.StartTag || tok.Tag != "img" {
+				continue
+			}
+			width, hasWidth := tok.Attr("width")
+			height, hasHeight := tok.Attr("height")
+			src, ok := tok.Attr("src")
+			if hasWidth && hasHeight || !ok {
+				continue
+			}
+			filePath, ok := imagePath(src.Value, pagePath, basePath, fingerprints)
+			if !ok {
+				continue
+			}
+			dims, err := sizes.Lookup(filePath)
+			if err != nil {
+				continue
+			}
+
+			var attrs string
+			switch {
+			case hasWidth:
+				w, err := strconv.Atoi(strings.TrimSpace(width.Value))
+				if err != nil || dims.Width == 0 {
+					continue
+				}
+				attrs = fmt.Sprintf(` height="%d"`, round(float64(w*dims.Height)/float64(dims.Width)))
+			case hasHeight:
+				h, err := strconv.Atoi(strings.TrimSpace(height.Value))
+				if err != nil || dims.Height == 0 {
+					continue
+				}
+				attrs = fmt.Sprintf(` width="%d"`, round(float64(h*dims.Width)/float64(dims.Height)))
+			default:
+				attrs = fmt.Sprintf(` width="%d" height="%d"`, dims.Width, dims.Height)
+			}
+			// insert after the tag name
+			at := tok.Start + 1 + len(tok.Tag)
+			edits = append(edits, rewrite.Edit{Start: at, End: at, Text: attrs})
+		}
+		return rewrite.Apply(contents, edits), nil
+	}
+}
+
+// imagePath returns the path of the public file the src of an image loads, from
+// a root relative URL, or a URL relative to the page.
+func imagePath(rawURL string, pagePath string, basePath string, fingerprints *asset.Fingerprinter) (string, bool) {
+	if rewrite.IsRootRelative(rawURL) {
+		return asset.PublicPath(rawURL, basePath, fingerprints)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	return asset.PublicPath(path.Join(path.Dir(pagePath), u.Path), "", fingerprints)
+}
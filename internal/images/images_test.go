@@ -0,0 +1,387 @@
+package images_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/asset"
+	"github.com/man-on-box/litepage/internal/images"
+	"github.com/stretchr/testify/assert"
+)
+
+func encode(t *testing.T, ext string, width int, height int) []byte {
+	var buf bytes.Buffer
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	var err error
+	switch ext {
+	case ".png":
+		err = png.Encode(&buf, img)
+	case ".jpg":
+		err = jpeg.Encode(&buf, img, nil)
+	case ".gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	assert.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	for _, ext := range []string{".png", ".jpg", ".gif"} {
+		t.Run("Reads the size of "+ext+" images", func(t *testing.T) {
+			size, err := images.Decode(bytes.NewReader(encode(t, ext, 30, 20)), ext)
+			assert.NoError(t, err)
+			assert.Equal(t, images.Size{Width: 30, Height: 20}, size)
+		})
+	}
+
+	t.Run("Swaps the size of images turned by their orientation", func(t *testing.T) {
+		for o, expected := range map[uint16]images.Size{
+			1: {Width: 30, Height: 20},
+			3: {Width: 30, Height: 20},
+			6: {Width: 20, Height: 30},
+			8: {Width: 20, Height: 30},
+		} {
+			size, err := images.Decode(bytes.NewReader(withOrientation(encode(t, ".jpg", 30, 20), o)), ".jpg")
+			assert.NoError(t, err)
+			assert.Equal(t, expected, size, "orientation %d", o)
+		}
+
+		png := encode(t, ".png", 30, 20)
+		png = append(append(append([]byte{}, png[:33]...), pngChunk("eXIf", exifWithGPS(6))...), png[33:]...)
+		size, err := images.Decode(bytes.NewReader(png), ".png")
+		assert.NoError(t, err)
+		assert.Equal(t, images.Size{Width: 20, Height: 30}, size)
+	})
+
+	tests := []struct {
+		name     string
+		svg      string
+		expected images.Size
+		err      string
+	}{
+		{name: "Reads width and height", svg: `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" width="24px" height="16" viewBox="0 0 48 32"></svg>`, expected: images.Size{Width: 24, Height: 16}},
+		{name: "Falls back to the viewBox", svg: `<svg width="100%" viewBox="0,0,48.4,32"/>`, expected: images.Size{Width: 48, Height: 32}},
+		{name: "Keeps the aspect ratio of the viewBox", svg: `<svg width="24" viewBox="0 0 48 32"/>`, expected: images.Size{Width: 24, Height: 16}},
+		{name: "Errors without a size", svg: `<svg></svg>`, err: "neither a width and height"},
+		{name: "Errors if the root is not svg", svg: `<html></html>`, err: "root element is 'html'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, err := images.Decode(strings.NewReader(tt.svg), ".svg")
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, size)
+		})
+	}
+
+	_, err := images.Decode(strings.NewReader(""), ".webp")
+	assert.ErrorIs(t, err, images.ErrUnsupported)
+}
+
+func TestSizes(t *testing.T) {
+	publicDir := t.TempDir()
+	imagePath := filepath.Join(publicDir, "photo.png")
+	assert.NoError(t, os.WriteFile(imagePath, encode(t, ".png", 30, 20), 0644))
+
+	sizes := images.NewSizes(os.DirFS(publicDir))
+	size, err := sizes.Lookup("/photo.png")
+	assert.NoError(t, err)
+	assert.Equal(t, images.Size{Width: 30, Height: 20}, size)
+
+	assert.NoError(t, os.WriteFile(imagePath, encode(t, ".png", 300, 200), 0644))
+	size, err = sizes.Lookup("/photo.png")
+	assert.NoError(t, err)
+	assert.Equal(t, images.Size{Width: 300, Height: 200}, size)
+
+	_, err = sizes.Lookup("/missing.png")
+	assert.Error(t, err)
+}
+
+func TestSizeTransform(t *testing.T) {
+	publicDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(publicDir, "img"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "img", "photo.png"), encode(t, ".png", 300, 200), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "img", "photo.webp"), []byte("RIFF"), 0644))
+
+	fingerprints := asset.NewFingerprinter(os.DirFS(publicDir), []string{".png"}, nil, nil)
+	transform := images.SizeTransform(images.NewSizes(os.DirFS(publicDir)), fingerprints, "/base")
+
+	tests := []struct {
+		name     string
+		page     string
+		expected string
+	}{
+		{name: "Adds width and height", page: `<img src="/img/photo.png" alt="">`, expected: `<img width="300" height="200" src="/img/photo.png" alt="">`},
+		{name: "Resolves the base path and fingerprints", page: `<img src="/base/img/photo.0123abcd.png">`, expected: `<img width="300" height="200" src="/base/img/photo.0123abcd.png">`},
+		{name: "Resolves URLs relative to the page", page: `<img src="../img/photo.png">`, expected: `<img width="300" height="200" src="../img/photo.png">`},
+		{name: "Keeps the aspect ratio from the width", page: `<img width="150" src="/img/photo.png">`, expected: `<img height="100" width="150" src="/img/photo.png">`},
+		{name: "Keeps the aspect ratio from the height", page: `<img height="50" src="/img/photo.png">`, expected: `<img width="75" height="50" src="/img/photo.png">`},
+		{name: "Leaves images with both attributes", page: `<img width="1" height="1" src="/img/photo.png">`, expected: `<img width="1" height="1" src="/img/photo.png">`},
+		{name: "Leaves relative widths", page: `<img width="50%" src="/img/photo.png">`, expected: `<img width="50%" src="/img/photo.png">`},
+		{name: "Leaves unsupported, missing and remote images", page: `<img src="/img/photo.webp"><img src="/missing.png"><img src="https://example.com/a.png">`, expected: `<img src="/img/photo.webp"><img src="/missing.png"><img src="https://example.com/a.png">`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents, err := transform("/blog/post.html", []byte(tt.page))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(contents))
+		})
+	}
+}
+
+func TestVariants(t *testing.T) {
+	publicDir := t.TempDir()
+	cacheDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(publicDir, "photos"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "photos", "cat.jpg"), encode(t, ".jpg", 400, 200), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "photos", "dog.png"), encode(t, ".png", 150, 100), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "logo.png"), encode(t, ".png", 400, 200), 0644))
+
+	variants := images.NewVariants(os.DirFS(publicDir), images.VariantConfig{Dirs: []string{"/photos"}, Widths: []int{300, 100, 200}, CacheDir: cacheDir})
+
+	t.Run("Only resizes images of the directories", func(t *testing.T) {
+		assert.True(t, variants.Applies("/photos/cat.jpg"))
+		assert.False(t, variants.Applies("/logo.png"))
+		assert.False(t, variants.Applies("/photos/cat.gif"))
+		assert.False(t, variants.Applies("/photos/cat-480w.jpg"))
+	})
+
+	t.Run("Lists the widths narrower than each image", func(t *testing.T) {
+		paths, err := variants.Paths()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/photos/cat-100w.jpg", "/photos/cat-200w.jpg", "/photos/cat-300w.jpg", "/photos/dog-100w.png"}, paths)
+	})
+
+	t.Run("Resolves variant paths", func(t *testing.T) {
+		filePath, width, ok := variants.Resolve("/photos/cat-200w.jpg")
+		assert.True(t, ok)
+		assert.Equal(t, "/photos/cat.jpg", filePath)
+		assert.Equal(t, 200, width)
+
+		for _, p := range []string{"/photos/cat-250w.jpg", "/photos/dog-200w.png", "/logo-100w.png", "/photos/cat.jpg"} {
+			_, _, ok := variants.Resolve(p)
+			assert.False(t, ok, p)
+		}
+	})
+
+	t.Run("Writes variants, then reads them from the cache", func(t *testing.T) {
+		distDir := t.TempDir()
+		assert.NoError(t, os.MkdirAll(filepath.Join(distDir, "photos"), 0755))
+		report, err := variants.WriteDir(distDir)
+		assert.NoError(t, err)
+		assert.Equal(t, images.Report{Images: 2, Variants: 4}, report)
+
+		data, err := os.ReadFile(filepath.Join(distDir, "photos", "cat-200w.jpg"))
+		assert.NoError(t, err)
+		size, err := images.Decode(bytes.NewReader(data), ".jpg")
+		assert.NoError(t, err)
+		assert.Equal(t, images.Size{Width: 200, Height: 100}, size)
+
+		data, err = os.ReadFile(filepath.Join(distDir, "photos", "dog-100w.png"))
+		assert.NoError(t, err)
+		size, err = images.Decode(bytes.NewReader(data), ".png")
+		assert.NoError(t, err)
+		assert.Equal(t, images.Size{Width: 100, Height: 67}, size)
+
+		report, err = variants.WriteDir(distDir)
+		assert.NoError(t, err)
+		assert.Equal(t, images.Report{Images: 2, Variants: 4, Cached: 4}, report)
+	})
+
+	t.Run("Renders srcset and sizes", func(t *testing.T) {
+		url := func(p string) (string, error) { return "/base" + p, nil }
+		attrs, err := variants.Srcset("/photos/dog.png", "50vw", url)
+		assert.NoError(t, err)
+		assert.Equal(t, `srcset="/base/photos/dog-100w.png 100w, /base/photos/dog.png 150w" sizes="50vw"`, attrs)
+
+		_, err = variants.Srcset("/logo.png", "", url)
+		assert.ErrorContains(t, err, "does not have variants")
+	})
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 2; y++ {
+			if x < 2 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	publicDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(publicDir, "img"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "img", "split.png"), buf.Bytes(), 0644))
+
+	variants := images.NewVariants(os.DirFS(publicDir), images.VariantConfig{Dirs: []string{"/img"}, Widths: []int{2}})
+	data, cached, err := variants.Generate("/img/split.png", 2)
+	assert.NoError(t, err)
+	assert.False(t, cached)
+
+	resized, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 2, 1), resized.Bounds())
+	r, _, _, _ := resized.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+	r, _, _, _ = resized.At(1, 0).RGBA()
+	assert.Equal(t, uint32(0), r)
+
+	t.Run("Turns photos according to their orientation", func(t *testing.T) {
+		// the left half is white, and is displayed at the top once rotated clockwise
+		img := image.NewRGBA(image.Rect(0, 0, 80, 40))
+		for x := 0; x < 80; x++ {
+			for y := 0; y < 40; y++ {
+				if x < 40 {
+					img.Set(x, y, color.White)
+				} else {
+					img.Set(x, y, color.Black)
+				}
+			}
+		}
+		var buf bytes.Buffer
+		assert.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}))
+		assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "img", "rotated.jpg"), withOrientation(buf.Bytes(), 6), 0644))
+
+		variants := images.NewVariants(os.DirFS(publicDir), images.VariantConfig{Dirs: []string{"/img"}, Widths: []int{20}})
+		data, _, err := variants.Generate("/img/rotated.jpg", 20)
+		assert.NoError(t, err)
+		resized, err := jpeg.Decode(bytes.NewReader(data))
+		assert.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, 20, 40), resized.Bounds())
+		r, _, _, _ := resized.At(10, 5).RGBA()
+		assert.Greater(t, r, uint32(0xf000))
+		r, _, _, _ = resized.At(10, 35).RGBA()
+		assert.Less(t, r, uint32(0x1000))
+
+		srcset, err := variants.Srcset("/img/rotated.jpg", "", func(filePath string) (string, error) { return filePath, nil })
+		assert.NoError(t, err)
+		assert.Equal(t, `srcset="/img/rotated-20w.jpg 20w, /img/rotated.jpg 40w"`, srcset)
+	})
+}
+
+// exifWithGPS returns little endian EXIF data with the orientation and a GPS
+// directory holding a latitude.
+func exifWithGPS(orientation uint16) []byte {
+	le := binary.LittleEndian
+	b := []byte("II\x2a\x00\x08\x00\x00\x00")
+	b = le.AppendUint16(b, 2)
+	b = le.AppendUint16(b, 0x0112)
+	b = le.AppendUint16(b, 3)
+	b = le.AppendUint32(b, 1)
+	b = le.AppendUint32(b, uint32(orientation))
+	b = le.AppendUint16(b, 0x8825)
+	b = le.AppendUint16(b, 4)
+	b = le.AppendUint32(b, 1)
+	b = le.AppendUint32(b, 38)
+	b = le.AppendUint32(b, 0)
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, 0x0002)
+	b = le.AppendUint16(b, 5)
+	b = le.AppendUint32(b, 3)
+	b = le.AppendUint32(b, 0)
+	return le.AppendUint32(b, 0)
+}
+
+// withOrientation returns the JPEG image with EXIF data holding the orientation.
+func withOrientation(jpg []byte, orientation uint16) []byte {
+	exif := jpegSegment(0xe1, append([]byte("Exif\x00\x00"), exifWithGPS(orientation)...))
+	return append(append(append([]byte{}, jpg[:2]...), exif...), jpg[2:]...)
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	s := []byte{0xff, marker}
+	s = binary.BigEndian.AppendUint16(s, uint16(len(payload)+2))
+	return append(s, payload...)
+}
+
+func pngChunk(typ string, data []byte) []byte {
+	c := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	c = append(c, typ...)
+	c = append(c, data...)
+	return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+}
+
+func TestStripMetadata(t *testing.T) {
+	t.Run("Strips EXIF, XMP and comments from JPEGs", func(t *testing.T) {
+		original := encode(t, ".jpg", 30, 20)
+		var src []byte
+		src = append(src, original[:2]...)
+		src = append(src, jpegSegment(0xe1, append([]byte("Exif\x00\x00"), exifWithGPS(6)...))...)
+		src = append(src, jpegSegment(0xe1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta><exif:GPSLatitude>51,30N</exif:GPSLatitude></x:xmpmeta>"))...)
+		src = append(src, jpegSegment(0xfe, []byte("Shot on a camera"))...)
+		src = append(src, original[2:]...)
+
+		stripped, meta, err := images.StripMetadata(src, ".jpg")
+		assert.NoError(t, err)
+		assert.Equal(t, images.Metadata{Removed: 3, Location: true}, meta)
+		assert.NotContains(t, string(stripped), "GPSLatitude")
+		assert.NotContains(t, string(stripped), "Shot on a camera")
+
+		// only the orientation is kept
+		exif := append([]byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00"), 0, 0, 0, 0)
+		assert.Equal(t, append(append(original[:2:2], jpegSegment(0xe1, exif)...), original[2:]...), stripped)
+		_, err = jpeg.Decode(bytes.NewReader(stripped))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Strips text and EXIF chunks from PNGs", func(t *testing.T) {
+		original := encode(t, ".png", 30, 20)
+		// the IHDR chunk ends 33 bytes in
+		var src []byte
+		src = append(src, original[:33]...)
+		src = append(src, pngChunk("tEXt", []byte("Author\x00Someone"))...)
+		src = append(src, pngChunk("eXIf", exifWithGPS(1))...)
+		src = append(src, original[33:]...)
+
+		stripped, meta, err := images.StripMetadata(src, ".png")
+		assert.NoError(t, err)
+		assert.Equal(t, images.Metadata{Removed: 2, Location: true}, meta)
+		assert.Equal(t, original, stripped)
+	})
+
+	t.Run("Leaves images without metadata", func(t *testing.T) {
+		original := encode(t, ".png", 30, 20)
+		stripped, meta, err := images.StripMetadata(original, ".png")
+		assert.NoError(t, err)
+		assert.Equal(t, images.Metadata{}, meta)
+		assert.Equal(t, original, stripped)
+	})
+
+	t.Run("Errors on images that cannot be read", func(t *testing.T) {
+		_, _, err := images.StripMetadata([]byte("GIF89a"), ".jpg")
+		assert.ErrorContains(t, err, "not a JPEG image")
+	})
+}
+
+func TestStripper(t *testing.T) {
+	original := encode(t, ".png", 30, 20)
+	located := append(append(original[:33:33], pngChunk("eXIf", exifWithGPS(1))...), original[33:]...)
+
+	stripper := images.NewStripper()
+	transform := stripper.Transform()
+	for filePath, contents := range map[string][]byte{"/b.png": located, "/a.png": located, "/c.png": original} {
+		stripped, err := transform(filePath, contents)
+		assert.NoError(t, err)
+		assert.Equal(t, original, stripped)
+	}
+	css, err := transform("/styles.css", []byte("body{}"))
+	assert.NoError(t, err)
+	assert.Equal(t, "body{}", string(css))
+	assert.Equal(t, []string{"/a.png", "/b.png"}, stripper.Located())
+}
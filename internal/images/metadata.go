@@ -0,0 +1,326 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/man-on-box/litepage/internal/model"
+)
+
+// Metadata describes what was removed from an image.
+type Metadata struct {
+	// Removed is the number of segments or chunks removed.
+	Removed int
+	// Location reports whether the image contained GPS coordinates.
+	Location bool
+}
+
+// StripMetadata returns the JPEG or PNG image without its metadata: the EXIF,
+// XMP, IPTC and comment segments of JPEGs, and the text and EXIF chunks of PNGs.
+// Pixel data and the segments that change how it is displayed, such as color
+// profiles, are copied as they are. The orientation of the EXIF data is kept,
+// so that rotated photos are still displayed the right way up.
+func StripMetadata(data []byte, ext string) ([]byte, Metadata, error) {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return stripJPEG(data)
+	case ".png":
+		return stripPNG(data)
+	}
+	return nil, Metadata{}, ErrUnsupported
+}
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	pngHeader  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+func stripJPEG(data []byte) ([]byte, Metadata, error) {
+	meta := Metadata{}
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return nil, meta, fmt.Errorf("not a JPEG image")
+	}
+	out := append(make([]byte, 0, len(data)), data[:2]...)
+	orientationKept := false
+	for i := 2; i < len(data); {
+		if data[i] != 0xff {
+			return nil, meta, fmt.Errorf("expected a marker at byte %d", i)
+		}
+		// markers may be preceded by fill bytes
+		for i+1 < len(data) && data[i+1] == 0xff {
+			i++
+		}
+		if i+1 >= len(data) {
+			return nil, meta, fmt.Errorf("unexpected end of image")
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xd9 || marker == 0xda:
+			// the image data starts at the start of scan, so the rest is copied as it is
+			return append(out, data[i:]...), meta, nil
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7:
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return nil, meta, fmt.Errorf("unexpected end of image")
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) || end < i+4 {
+			return nil, meta, fmt.Errorf("segment at byte %d is longer than the image", i)
+		}
+		payload := data[i+4 : end]
+
+		switch marker {
+		case 0xe1: // APP1, EXIF or XMP
+			if bytes.HasPrefix(payload, exifHeader) {
+				orientation, location := readTIFF(payload[len(exifHeader):])
+				meta.Location = meta.Location || location
+				if orientation > 1 && !orientationKept {
+					orientationKept = true
+					exif := append(append([]byte{}, exifHeader...), orientationTIFF(orientation)...)
+					out = append(out, 0xff, 0xe1)
+					out = binary.BigEndian.AppendUint16(out, uint16(len(exif)+2))
+					out = append(out, exif...)
+				}
+			} else if hasXMPLocation(payload) {
+				meta.Location = true
+			}
+			meta.Removed++
+		case 0xed, 0xfe: // APP13 with IPTC, and comments
+			meta.Removed++
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, meta, nil
+}
+
+func stripPNG(data []byte) ([]byte, Metadata, error) {
+	meta := Metadata{}
+	if !bytes.HasPrefix(data, pngHeader) {
+		return nil, meta, fmt.Errorf("not a PNG image")
+	}
+	out := append(make([]byte, 0, len(data)), pngHeader...)
+	for i := len(pngHeader); i < len(data); {
+		if i+12 > len(data) {
+			return nil, meta, fmt.Errorf("unexpected end of image")
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if end > len(data) {
+			return nil, meta, fmt.Errorf("chunk at byte %d is longer than the image", i)
+		}
+		typ := string(data[i+4 : i+8])
+		chunk := data[i+8 : i+8+length]
+
+		switch typ {
+		case "tEXt", "zTXt", "iTXt":
+			meta.Location = meta.Location || hasXMPLocation(chunk)
+			meta.Removed++
+		case "eXIf":
+			orientation, location := readTIFF(chunk)
+			meta.Location = meta.Location || location
+			if orientation > 1 {
+				out = appendChunk(out, "eXIf", orientationTIFF(orientation))
+			}
+			meta.Removed++
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, meta, nil
+}
+
+func appendChunk(out []byte, typ string, chunk []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(chunk)))
+	start := len(out)
+	out = append(out, typ...)
+	out = append(out, chunk...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[start:]))
+}
+
+// hasXMPLocation reports whether XMP metadata has GPS coordinates.
+func hasXMPLocation(b []byte) bool {
+	return bytes.Contains(b, []byte("GPSLatitude")) || bytes.Contains(b, []byte("GPSLongitude"))
+}
+
+const (
+	tagOrientation  = 0x0112
+	tagGPSInfo      = 0x8825
+	tagGPSLatitude  = 0x0002
+	tagGPSLongitude = 0x0004
+)
+
+// readTIFF returns the orientation of the EXIF data, and whether its GPS
+// directory has coordinates. Data that cannot be read has neither.
+func readTIFF(b []byte) (orientation int, location bool) {
+	if len(b) < 8 {
+		return 0, false
+	}
+	var order binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, false
+	}
+	entries := func(offset uint32) [][]byte {
+		if int64(offset)+2 > int64(len(b)) {
+			return nil
+		}
+		count := int(order.Uint16(b[offset:]))
+		var list [][]byte
+		for i := 0; i < count; i++ {
+			start := int(offset) + 2 + i*12
+			if start+12 > len(b) {
+				break
+			}
+			list = append(list, b[start:start+12])
+		}
+		return list
+	}
+
+	for _, e := range entries(order.Uint32(b[4:])) {
+		switch order.Uint16(e) {
+		case tagOrientation:
+			orientation = int(order.Uint16(e[8:]))
+		case tagGPSInfo:
+			for _, g := range entries(order.Uint32(e[8:])) {
+				if tag := order.Uint16(g); tag == tagGPSLatitude || tag == tagGPSLongitude {
+					location = true
+				}
+			}
+		}
+	}
+	return orientation, location
+}
+
+// orientation returns the EXIF orientation of the JPEG or PNG image, from 1 to
+// 8, or 0 if it has none. Browsers rotate and flip images according to it.
+func orientation(data []byte, ext string) int {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+			return 0
+		}
+		for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+			marker := data[i+1]
+			switch {
+			case marker == 0xff:
+				// fill byte
+				i++
+				continue
+			case marker == 0xd9 || marker == 0xda:
+				return 0
+			case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7:
+				i += 2
+				continue
+			}
+			end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+			if end > len(data) || end < i+4 {
+				return 0
+			}
+			if payload := data[i+4 : end]; marker == 0xe1 && bytes.HasPrefix(payload, exifHeader) {
+				o, _ := readTIFF(payload[len(exifHeader):])
+				return o
+			}
+			i = end
+		}
+	case ".png":
+		if !bytes.HasPrefix(data, pngHeader) {
+			return 0
+		}
+		for i := len(pngHeader); i+12 <= len(data); {
+			end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+			if end > len(data) || end < i+12 {
+				return 0
+			}
+			if string(data[i+4:i+8]) == "eXIf" {
+				o, _ := readTIFF(data[i+8 : end-4])
+				return o
+			}
+			i = end
+		}
+	}
+	return 0
+}
+
+// transposed reports whether the orientation swaps the width and height of the image.
+func transposed(orientation int) bool {
+	return orientation >= 5 && orientation <= 8
+}
+
+// orientationTIFF returns EXIF data with only the orientation.
+func orientationTIFF(orientation int) []byte {
+	b := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	b = binary.BigEndian.AppendUint16(b, 1)
+	b = binary.BigEndian.AppendUint16(b, tagOrientation)
+	b = binary.BigEndian.AppendUint16(b, 3) // SHORT
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(orientation))
+	b = append(b, 0, 0)
+	// no next directory
+	return binary.BigEndian.AppendUint32(b, 0)
+}
+
+// Stripper removes the metadata of the JPEG and PNG images of a public
+// directory, and remembers the images that contained GPS coordinates.
+type Stripper struct {
+	mu       sync.Mutex
+	location map[string]bool
+}
+
+// StripExtensions are the extensions of the images a Stripper removes the metadata of.
+var StripExtensions = []string{".jpg", ".jpeg", ".png"}
+
+func NewStripper() *Stripper {
+	return &Stripper{location: map[string]bool{}}
+}
+
+// Transform returns a transform that removes the metadata of images.
+func (s *Stripper) Transform() model.Transform {
+	return func(filePath string, contents []byte) ([]byte, error) {
+		switch strings.ToLower(path.Ext(filePath)) {
+		case ".jpg", ".jpeg", ".png":
+		default:
+			return contents, nil
+		}
+		stripped, meta, err := StripMetadata(contents, path.Ext(filePath))
+		if err != nil {
+			return nil, fmt.Errorf("could not strip metadata of image '%s': %w", filePath, err)
+		}
+		if meta.Location {
+			s.mu.Lock()
+			s.location[filePath] = true
+			s.mu.Unlock()
+		}
+		if meta.Removed == 0 {
+			return contents, nil
+		}
+		return stripped, nil
+	}
+}
+
+// Located returns the images that contained GPS coordinates, sorted.
+func (s *Stripper) Located() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var files []string
+	for f := range s.location {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,393 @@
+package images
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/man-on-box/litepage/internal/file"
+)
+
+// DefaultQuality is the JPEG quality variants are encoded with, from 1 to 100.
+const DefaultQuality = 80
+
+// VariantConfig configures the resized variants of the images of a public directory.
+type VariantConfig struct {
+	// Dirs are the directories of the public directory whose images get variants, such as '/photos'.
+	Dirs []string
+	// Widths are the widths in pixels of the variants of each image. Images only
+	// get the variants narrower than themselves.
+	Widths []int
+	// Quality is the JPEG quality variants are encoded with.
+	Quality int
+	// CacheDir, if set, is where variants are kept between builds, named after
+	// the hash of the image they are resized from.
+	CacheDir string
+}
+
+// Variants generates the resized variants of the JPEG and PNG images of some
+// public directories. The variant of '/photos/cat.jpg' that is 480 pixels wide
+// is '/photos/cat-480w.jpg'.
+type Variants struct {
+	files  fs.FS
+	config VariantConfig
+	sizes  *Sizes
+}
+
+func NewVariants(public fs.FS, config VariantConfig) *Variants {
+	widths := append([]int{}, config.Widths...)
+	sort.Ints(widths)
+	config.Widths = widths
+	if config.Quality == 0 {
+		config.Quality = DefaultQuality
+	}
+	return &Variants{files: public, config: config, sizes: NewSizes(public)}
+}
+
+// Applies reports whether the public file is an image that gets variants.
+func (v *Variants) Applies(filePath string) bool {
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".jpg", ".jpeg", ".png":
+	default:
+		return false
+	}
+	if variantSuffix.MatchString(filePath) {
+		// variants exported by hand are not resized again
+		return false
+	}
+	for _, dir := range v.config.Dirs {
+		if strings.HasPrefix(filePath, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Widths returns the widths of the variants of the public image, which are the
+// configured widths narrower than the image, along with its size.
+func (v *Variants) Widths(filePath string) ([]int, Size, error) {
+	size, err := v.sizes.Lookup(filePath)
+	if err != nil {
+		return nil, Size{}, err
+	}
+	var widths []int
+	for _, w := range v.config.Widths {
+		if w < size.Width {
+			widths = append(widths, w)
+		}
+	}
+	return widths, size, nil
+}
+
+// Path returns the path of the variant of the image at the width.
+func Path(filePath string, width int) string {
+	ext := path.Ext(filePath)
+	return fmt.Sprintf("%s-%dw%s", strings.TrimSuffix(filePath, ext), width, ext)
+}
+
+// variantSuffix matches the width a variant path ends with, before its extension.
+var variantSuffix = regexp.MustCompile(`-([0-9]+)w(\.[^./]+)$`)
+
+// Resolve returns the image and the width of the variant at the path, if it is
+// the path of a variant.
+func (v *Variants) Resolve(variantPath string) (string, int, bool) {
+	m := variantSuffix.FindStringSubmatchIndex(variantPath)
+	if m == nil {
+		return "", 0, false
+	}
+	width, err := strconv.Atoi(variantPath[m[2]:m[3]])
+	if err != nil {
+		return "", 0, false
+	}
+	filePath := variantPath[:m[0]] + variantPath[m[4]:m[5]]
+	if !v.Applies(filePath) {
+		return "", 0, false
+	}
+	widths, _, err := v.Widths(filePath)
+	if err != nil {
+		return "", 0, false
+	}
+	for _, w := range widths {
+		if w == width {
+			return filePath, width, true
+		}
+	}
+	return "", 0, false
+}
+
+// Images returns the path of every image that gets variants, sorted.
+func (v *Variants) Images() ([]string, error) {
+	var files []string
+	err := file.WalkFiles(v.files, func(filePath string) error {
+		if v.Applies(filePath) {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// Paths returns the path of every variant, sorted by image then width.
+func (v *Variants) Paths() ([]string, error) {
+	files, err := v.Images()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, f := range files {
+		widths, _, err := v.Widths(f)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range widths {
+			paths = append(paths, Path(f, w))
+		}
+	}
+	return paths, nil
+}
+
+// Generate returns the variant of the public image resized to the width, from
+// the cache directory if it was generated from the same image before.
+func (v *Variants) Generate(filePath string, width int) (data []byte, cached bool, err error) {
+	src, err := fs.ReadFile(v.files, file.FSPath(filePath))
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read image '%s': %w", filePath, err)
+	}
+
+	var cacheFile string
+	if v.config.CacheDir != "" {
+		sum := sha256.Sum256(src)
+		name := fmt.Sprintf("%s-%dw-q%d%s", hex.EncodeToString(sum[:]), width, v.config.Quality, strings.ToLower(path.Ext(filePath)))
+		cacheFile = filepath.Join(v.config.CacheDir, name)
+		if data, err := os.ReadFile(cacheFile); err == nil {
+			return data, true, nil
+		}
+	}
+
+	data, err = resizeImage(src, path.Ext(filePath), width, v.config.Quality)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not resize image '%s': %w", filePath, err)
+	}
+	if cacheFile != "" {
+		if err := os.MkdirAll(v.config.CacheDir, 0755); err != nil {
+			return nil, false, fmt.Errorf("could not create image cache directory: %w", err)
+		}
+		if err := os.WriteFile(cacheFile, data, 0644); err != nil {
+			return nil, false, fmt.Errorf("could not write image cache: %w", err)
+		}
+	}
+	return data, false, nil
+}
+
+// Report describes the variants written to a directory.
+type Report struct {
+	Images   int
+	Variants int
+	// Cached are the variants that were read from the cache directory.
+	Cached int
+}
+
+// WriteDir writes the variants of every image to the directory, at the same
+// path as they are served.
+func (v *Variants) WriteDir(dir string) (Report, error) {
+	report := Report{}
+	files, err := v.Images()
+	if err != nil {
+		return report, err
+	}
+	for _, f := range files {
+		widths, _, err := v.Widths(f)
+		if err != nil {
+			return report, err
+		}
+		if len(widths) > 0 {
+			report.Images++
+		}
+		for _, w := range widths {
+			data, cached, err := v.Generate(f, w)
+			if err != nil {
+				return report, err
+			}
+			if cached {
+				report.Cached++
+			}
+			report.Variants++
+			if err := file.WriteFile(filepath.Join(dir, filepath.FromSlash(Path(f, w))), data); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// Srcset returns the srcset attribute listing the variants of the public image
+// along with the image itself, each with its width, and the sizes attribute if
+// it is set. The url function returns the URL a public file is loaded from.
+func (v *Variants) Srcset(filePath string, sizes string, url func(filePath string) (string, error)) (string, error) {
+	if !v.Applies(filePath) {
+		return "", fmt.Errorf("image '%s' does not have variants, it must be a JPEG or PNG image in one of %s", filePath, strings.Join(v.config.Dirs, ", "))
+	}
+	widths, size, err := v.Widths(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	var candidates []string
+	for _, w := range widths {
+		u, err := url(Path(filePath, w))
+		if err != nil {
+			return "", err
+		}
+		candidates = append(candidates, fmt.Sprintf("%s %dw", u, w))
+	}
+	u, err := url(filePath)
+	if err != nil {
+		return "", err
+	}
+	candidates = append(candidates, fmt.Sprintf("%s %dw", u, size.Width))
+
+	attrs := fmt.Sprintf(`srcset="%s"`, html.EscapeString(strings.Join(candidates, ", ")))
+	if sizes != "" {
+		attrs += fmt.Sprintf(` sizes="%s"`, html.EscapeString(sizes))
+	}
+	return attrs, nil
+}
+
+// resizeImage decodes the JPEG or PNG image, turns it according to its EXIF
+// orientation, scales it down to the width keeping its aspect ratio, and
+// encodes it in the same format.
+func resizeImage(src []byte, ext string, width int, quality int) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	// variants have no EXIF data, so they are turned the way the image is displayed
+	rgba = orient(rgba, orientation(src, ext))
+	height := max(1, round(float64(width*rgba.Bounds().Dy())/float64(rgba.Bounds().Dx())))
+	resized := resize(rgba, width, height)
+
+	var buf bytes.Buffer
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: quality})
+	default:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, resized)
+	}
+	return buf.Bytes(), err
+}
+
+// orient rotates and flips the image according to the EXIF orientation, from 2
+// to 8, so that it is the right way up without it.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if transposed(orientation) {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated by 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored along the top left diagonal
+				dx, dy = y, x
+			case 6: // rotated by 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirrored along the top right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated by 90° counterclockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:])
+		}
+	}
+	return dst
+}
+
+// resize scales the image down to the width and height, averaging the pixels
+// each pixel of the result covers, one direction at a time.
+func resize(src *image.RGBA, width int, height int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// horizontally, into rows of the source height
+	tmp := make([]float32, width*sh*4)
+	xw := weights(sw, width)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, ws := range xw {
+			var c [4]float32
+			for _, w := range ws {
+				for i := 0; i < 4; i++ {
+					c[i] += float32(row[w.index*4+i]) * w.weight
+				}
+			}
+			copy(tmp[(y*width+x)*4:], c[:])
+		}
+	}
+
+	// then vertically
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	yw := weights(sh, height)
+	for y, ws := range yw {
+		for x := 0; x < width; x++ {
+			var c [4]float32
+			for _, w := range ws {
+				for i := 0; i < 4; i++ {
+					c[i] += tmp[(w.index*width+x)*4+i] * w.weight
+				}
+			}
+			for i := 0; i < 4; i++ {
+				dst.Pix[y*dst.Stride+x*4+i] = uint8(min(255, c[i]+0.5))
+			}
+		}
+	}
+	return dst
+}
+
+type weight struct {
+	index  int
+	weight float32
+}
+
+// weights returns, for each of the n pixels of the result, the source pixels it
+// covers and how much of each, adding up to 1.
+func weights(size int, n int) [][]weight {
+	scale := float64(size) / float64(n)
+	all := make([][]weight, n)
+	for i := range all {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < size && float64(j) < end; j++ {
+			overlap := min(end, float64(j+1)) - max(start, float64(j))
+			if overlap > 0 {
+				all[i] = append(all[i], weight{index: j, weight: float32(overlap / scale)})
+			}
+		}
+	}
+	return all
+}
@@ -0,0 +1,300 @@
+// Package importmap generates the import map of the ES modules of a public
+// directory, and the modulepreload hints of the modules each page loads.
+package importmap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/man-on-box/litepage/internal/asset"
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/markup"
+	"github.com/man-on-box/litepage/internal/model"
+	"github.com/man-on-box/litepage/internal/rewrite"
+)
+
+// Map is an import map, as rendered in a script tag of type 'importmap'.
+type Map struct {
+	Imports map[string]string `json:"imports"`
+}
+
+// Tag returns the script tag declaring the import map.
+func (m Map) Tag() (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return `<script type="importmap">` + string(data) + `</script>`, nil
+}
+
+// Modules are the ES modules of a public directory, such as '/js'. Modules are read again every time, so changes show up when serving.
+type Modules struct {
+	Public   fs.FS
+	Dir      string
+	BasePath string
+	// URL returns the URL a public file is loaded from, including the base path.
+	URL func(filePath string) (string, error)
+}
+
+// Files returns the path of every module, sorted.
+func (m Modules) Files() ([]string, error) {
+	root := file.FSPath(m.Dir)
+	var files []string
+	err := fs.WalkDir(m.Public, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == root {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !isModule(p) {
+			return nil
+		}
+		files = append(files, "/"+p)
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// Map returns the import map of the modules. Each module can be imported by its
+// path in the directory without the extension, such as 'components/card' for
+// '/js/components/card.js'. When the URL of a module differs from its path, such
+// as when it is fingerprinted, its path is also mapped to the URL, so that
+// relative imports between modules load the right file.
+func (m Modules) Map() (Map, error) {
+	files, err := m.Files()
+	if err != nil {
+		return Map{}, err
+	}
+	imports := map[string]string{}
+	for _, f := range files {
+		u, err := m.URL(f)
+		if err != nil {
+			return Map{}, err
+		}
+		imports[m.name(f)] = u
+		if plain := m.BasePath + f; plain != u {
+			imports[plain] = u
+		}
+	}
+	return Map{Imports: imports}, nil
+}
+
+// name returns the bare specifier the module is mapped to.
+func (m Modules) name(filePath string) string {
+	rel := strings.TrimPrefix(strings.TrimPrefix(filePath, m.Dir), "/")
+	return strings.TrimSuffix(rel, path.Ext(rel))
+}
+
+// Deps returns the modules the entry module imports statically, directly or
+// not, in the order they are first imported. The entry is not included.
+func (m Modules) Deps(entry string) ([]string, error) {
+	files, err := m.Files()
+	if err != nil {
+		return nil, err
+	}
+	modules := map[string]bool{}
+	names := map[string]string{}
+	for _, f := range files {
+		modules[f] = true
+		names[m.name(f)] = f
+	}
+
+	var deps []string
+	seen := map[string]bool{entry: true}
+	var visit func(filePath string) error
+	visit = func(filePath string) error {
+		src, err := fs.ReadFile(m.Public, file.FSPath(filePath))
+		if err != nil {
+			return fmt.Errorf("could not read module '%s': %w", filePath, err)
+		}
+		for _, spec := range Imports(src) {
+			dep, ok := m.resolve(filePath, spec, names)
+			if !ok || !modules[dep] || seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			deps = append(deps, dep)
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(entry); err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
+
+// resolve returns the public file an import specifier of the module loads.
+func (m Modules) resolve(filePath string, spec string, names map[string]string) (string, bool) {
+	switch {
+	case strings.HasPrefix(spec, "./") || strings.HasPrefix(spec, "../"):
+		return path.Join(path.Dir(filePath), spec), true
+	case strings.HasPrefix(spec, "/") && !strings.HasPrefix(spec, "//"):
+		return asset.PublicPath(spec, m.BasePath, nil)
+	}
+	f, ok := names[spec]
+	return f, ok
+}
+
+// importStart matches what follows an import or export keyword up to the quote
+// of a module specifier, such as ' { a, b as c } from "'.
+var importStart = regexp.MustCompile(`^(?:[\w$\s{},*]*[\s}*]from)?\s*["']`)
+
+// Imports returns the specifiers of the static imports and exports of a module,
+// in order. Comments and strings are skipped, dynamic imports are ignored.
+func Imports(src []byte) []string {
+	var specs []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			end := strings.IndexByte(string(src[i:]), '\n')
+			if end < 0 {
+				return specs
+			}
+			i += end
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(string(src[i+2:]), "*/")
+			if end < 0 {
+				return specs
+			}
+			i += 2 + end + 2
+		case c == '"' || c == '\'' || c == '`':
+			i = stringEnd(src, i)
+		case isKeywordAt(src, i, "import") || isKeywordAt(src, i, "export"):
+			rest := src[i+len("import"):]
+			loc := importStart.FindIndex(rest)
+			if loc == nil {
+				i += len("import")
+				continue
+			}
+			start := i + len("import") + loc[1]
+			end := stringEnd(src, start-1)
+			specs = append(specs, string(src[start:end-1]))
+			i = end
+		default:
+			i++
+		}
+	}
+	return specs
+}
+
+// isKeywordAt reports whether the keyword starts at i as a whole word, not as
+// part of an identifier or a property such as 'import.meta'.
+func isKeywordAt(src []byte, i int, keyword string) bool {
+	if !strings.HasPrefix(string(src[i:min(len(src), i+len(keyword))]), keyword) {
+		return false
+	}
+	if i > 0 && (isIdent(src[i-1]) || src[i-1] == '.') {
+		return false
+	}
+	next := i + len(keyword)
+	return next == len(src) || !isIdent(src[next])
+}
+
+// stringEnd returns the offset after the string starting at i.
+func stringEnd(src []byte, i int) int {
+	quote := src[i]
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case quote:
+			return j + 1
+		case '\n':
+			if quote != '`' {
+				return j + 1
+			}
+		}
+	}
+	return len(src)
+}
+
+// PreloadTransform returns a transform that adds a modulepreload link for every
+// module that the module scripts of html pages import, directly or not, so that
+// browsers fetch them all at once rather than one level of imports at a time.
+// The links are added at the end of the head, after the import map, which must
+// come first. Modules already preloaded by the page are left out.
+func PreloadTransform(modules Modules, fingerprints *asset.Fingerprinter) model.Transform {
+	return func(pagePath string, contents []byte) ([]byte, error) {
+		if !file.IsHTML(pagePath) {
+			return contents, nil
+		}
+
+		var entries []string
+		loaded := map[string]bool{}
+		at := -1
+		for _, tok := range markup.Tokenize(contents) {
+			switch {
+			case tok.Type == markup.StartTag && tok.Tag == "script":
+				typ, _ := tok.Attr("type")
+				src, ok := tok.Attr("src")
+				if !ok || !strings.EqualFold(typ.Value, "module") {
+					continue
+				}
+				if filePath, ok := asset.PublicPath(src.Value, modules.BasePath, fingerprints); ok && isModule(filePath) {
+					entries = append(entries, filePath)
+					loaded[filePath] = true
+				}
+				if at < 0 {
+					at = tok.Start
+				}
+			case tok.Type == markup.StartTag && tok.Tag == "link":
+				rel, _ := tok.Attr("rel")
+				href, ok := tok.Attr("href")
+				if !ok || !strings.EqualFold(rel.Value, "modulepreload") {
+					continue
+				}
+				if filePath, ok := asset.PublicPath(href.Value, modules.BasePath, fingerprints); ok {
+					loaded[filePath] = true
+				}
+			case tok.Type == markup.EndTag && tok.Tag == "head":
+				at = tok.Start
+			}
+		}
+
+		var links strings.Builder
+		for _, entry := range entries {
+			deps, err := modules.Deps(entry)
+			if err != nil {
+				// scripts that are not modules of the directory are left to the link checks
+				continue
+			}
+			for _, dep := range deps {
+				if loaded[dep] {
+					continue
+				}
+				loaded[dep] = true
+				u, err := modules.URL(dep)
+				if err != nil {
+					return nil, err
+				}
+				fmt.Fprintf(&links, `<link rel="modulepreload" href="%s">`, html.EscapeString(u))
+			}
+		}
+		if links.Len() == 0 {
+			return contents, nil
+		}
+		return rewrite.Apply(contents, []rewrite.Edit{{Start: at, End: at, Text: links.String()}}), nil
+	}
+}
+
+func isModule(filePath string) bool {
+	ext := path.Ext(filePath)
+	return ext == ".js" || ext == ".mjs"
+}
+
+func isIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
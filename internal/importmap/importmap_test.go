@@ -0,0 +1,123 @@
+package importmap_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/importmap"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for p, contents := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, p)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, p), []byte(contents), 0644))
+	}
+}
+
+func TestImports(t *testing.T) {
+	src := `import "./side-effect.js";
+import app, { a, b as c } from './app.js';
+import * as ns from"utils"
+export { d } from "../d.mjs";
+export * from '/js/e.js';
+// import "./commented.js";
+/* export * from "./block.js" */
+const s = "import './in-string.js'";
+const lazy = import("./lazy.js");
+const url = import.meta.url;
+export const x = "not-a-module";
+reimport("./not-an-import.js");`
+
+	assert.Equal(t, []string{"./side-effect.js", "./app.js", "utils", "../d.mjs", "/js/e.js"}, importmap.Imports([]byte(src)))
+}
+
+func TestModules(t *testing.T) {
+	publicDir := t.TempDir()
+	writeFiles(t, publicDir, map[string]string{
+		"/js/app.js":             `import { card } from "components/card"; import "./lib/util.js";`,
+		"/js/components/card.js": `import "../lib/util.js"; import "https://cdn.example.com/x.js";`,
+		"/js/lib/util.js":        `export const util = 1; import("./lazy.js");`,
+		"/js/lib/lazy.js":        ``,
+		"/js/readme.txt":         ``,
+		"/other.js":              ``,
+	})
+
+	m := importmap.Modules{Public: os.DirFS(publicDir), Dir: "/js", BasePath: "/base", URL: func(filePath string) (string, error) {
+		if filePath == "/js/app.js" {
+			return "/base/js/app.0123abcd.js", nil
+		}
+		return "/base" + filePath, nil
+	}}
+
+	files, err := m.Files()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/js/app.js", "/js/components/card.js", "/js/lib/lazy.js", "/js/lib/util.js"}, files)
+
+	imports, err := m.Map()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"app":             "/base/js/app.0123abcd.js",
+		"/base/js/app.js": "/base/js/app.0123abcd.js",
+		"components/card": "/base/js/components/card.js",
+		"lib/lazy":        "/base/js/lib/lazy.js",
+		"lib/util":        "/base/js/lib/util.js",
+	}, imports.Imports)
+
+	tag, err := imports.Tag()
+	assert.NoError(t, err)
+	assert.Contains(t, tag, `<script type="importmap">{"imports":{"/base/js/app.js":"/base/js/app.0123abcd.js",`)
+
+	deps, err := m.Deps("/js/app.js")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/js/components/card.js", "/js/lib/util.js"}, deps)
+}
+
+func TestPreloadTransform(t *testing.T) {
+	publicDir := t.TempDir()
+	writeFiles(t, publicDir, map[string]string{
+		"/js/app.js":  `import "./a.js"; import "./b.js";`,
+		"/js/a.js":    `import "./b.js";`,
+		"/js/b.js":    ``,
+		"/js/solo.js": ``,
+	})
+	m := importmap.Modules{Public: os.DirFS(publicDir), Dir: "/js", URL: func(filePath string) (string, error) {
+		return filePath, nil
+	}}
+	transform := importmap.PreloadTransform(m, nil)
+
+	tests := []struct {
+		name     string
+		page     string
+		expected string
+	}{
+		{
+			name:     "Adds preloads at the end of the head",
+			page:     `<head><script type="importmap">{}</script></head><body><script type="module" src="/js/app.js"></script></body>`,
+			expected: `<head><script type="importmap">{}</script><link rel="modulepreload" href="/js/a.js"><link rel="modulepreload" href="/js/b.js"></head><body><script type="module" src="/js/app.js"></script></body>`,
+		},
+		{
+			name:     "Adds preloads before the first module script without a head",
+			page:     `<p>Hi</p><script type="module" src="/js/app.js"></script>`,
+			expected: `<p>Hi</p><link rel="modulepreload" href="/js/a.js"><link rel="modulepreload" href="/js/b.js"><script type="module" src="/js/app.js"></script>`,
+		},
+		{
+			name:     "Leaves out modules already preloaded",
+			page:     `<head><link rel="modulepreload" href="/js/b.js"></head><script type="module" src="/js/app.js"></script>`,
+			expected: `<head><link rel="modulepreload" href="/js/b.js"><link rel="modulepreload" href="/js/a.js"></head><script type="module" src="/js/app.js"></script>`,
+		},
+		{
+			name:     "Leaves pages without module imports as they are",
+			page:     `<head></head><script type="module" src="/js/solo.js"></script><script src="/js/app.js"></script>`,
+			expected: `<head></head><script type="module" src="/js/solo.js"></script><script src="/js/app.js"></script>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents, err := transform("/index.html", []byte(tt.page))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(contents))
+		})
+	}
+}
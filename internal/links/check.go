@@ -0,0 +1,120 @@
+package links
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/markup"
+)
+
+type CheckConfig struct {
+	DistDir  string
+	BasePath string
+}
+
+type CheckReport struct {
+	Checked int
+	Broken  []BrokenLink
+}
+
+type page struct {
+	tokens []markup.Token
+	src    []byte
+	ids    map[string]bool
+}
+
+// Check parses every html page of the built site, and reports the links that do
+// not resolve to a file, or to an element of the page for links with a fragment.
+func Check(config CheckConfig) (CheckReport, error) {
+	report := CheckReport{}
+	pages := map[string]*page{}
+
+	load := func(p string) (*page, error) {
+		if pg, ok := pages[p]; ok {
+			return pg, nil
+		}
+		src, err := os.ReadFile(filepath.Join(config.DistDir, filepath.FromSlash(p)))
+		if err != nil {
+			return nil, err
+		}
+		tokens := markup.Tokenize(src)
+		pg := &page{tokens: tokens, src: src, ids: markup.IDs(tokens)}
+		pages[p] = pg
+		return pg, nil
+	}
+
+	exists := func(p string) bool {
+		info, err := os.Stat(filepath.Join(config.DistDir, filepath.FromSlash(p)))
+		return err == nil && !info.IsDir()
+	}
+
+	var paths []string
+	err := filepath.WalkDir(config.DistDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !file.IsHTML(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(config.DistDir, path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, "/"+filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("could not read dist directory: %w", err)
+	}
+
+	for _, pagePath := range paths {
+		pg, err := load(pagePath)
+		if err != nil {
+			return report, fmt.Errorf("could not read page '%s': %w", pagePath, err)
+		}
+		report.Checked++
+
+		for _, ref := range markup.Refs(pg.src, pg.tokens) {
+			broken := func(reason string) {
+				report.Broken = append(report.Broken, BrokenLink{Page: pagePath, Line: ref.Line, Link: ref.URL, Reason: reason})
+			}
+
+			target, internal, err := Resolve(config.BasePath, pagePath, ref.URL)
+			if !internal {
+				continue
+			}
+			if err != nil {
+				broken(reason(err))
+				continue
+			}
+
+			found := ""
+			for _, c := range file.Candidates(target.Path) {
+				if exists(c) {
+					found = c
+					break
+				}
+			}
+			if found == "" {
+				broken("does not exist")
+				continue
+			}
+
+			// an empty fragment or '#top' always scrolls to the top of the page
+			if target.Fragment == "" || target.Fragment == "top" || !file.IsHTML(found) {
+				continue
+			}
+			targetPage, err := load(found)
+			if err != nil {
+				return report, fmt.Errorf("could not read page '%s': %w", found, err)
+			}
+			if !targetPage.ids[target.Fragment] {
+				broken(fmt.Sprintf("has no element with id '%s'", target.Fragment))
+			}
+		}
+	}
+	return report, nil
+}
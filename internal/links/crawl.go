@@ -0,0 +1,160 @@
+package links
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/man-on-box/litepage/internal/asset"
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/images"
+	"github.com/man-on-box/litepage/internal/markup"
+	"github.com/man-on-box/litepage/internal/model"
+)
+
+type CrawlConfig struct {
+	// Public holds the public files links may resolve to.
+	Public      fs.FS
+	Pages       *[]model.Page
+	BasePath    string
+	WithSitemap bool
+	// EntryPages are the paths of the registered pages the crawl starts from.
+	EntryPages []string
+	Transforms []model.Transform
+	// Assets, if set, resolves links to fingerprinted public files.
+	Assets *asset.Fingerprinter
+	// Variants, if set, resolves links to the resized variants of images.
+	Variants *images.Variants
+}
+
+// BrokenLink is a link that does not resolve to any page or file of the site.
+type BrokenLink struct {
+	Page   string
+	Line   int
+	Link   string
+	Reason string
+}
+
+func (b BrokenLink) String() string {
+	return fmt.Sprintf("%s:%d links to '%s' which %s", b.Page, b.Line, b.Link, b.Reason)
+}
+
+type CrawlReport struct {
+	// Crawled are the pages reached from the entry pages, in the order they were crawled.
+	Crawled []string
+	Broken  []BrokenLink
+	// Unreachable are the registered html pages that no crawled page links to.
+	// Pages nothing links to by design, such as 404 pages, are left out, as are
+	// pages that are not html, such as feeds.
+	Unreachable []string
+}
+
+// Crawl renders the entry pages and follows their links to other pages of the
+// site, reporting links that resolve to neither a registered page nor a public file.
+func Crawl(config CrawlConfig) (CrawlReport, error) {
+	report := CrawlReport{}
+	pages := map[string]model.Page{}
+	for _, p := range *config.Pages {
+		pages[p.Path] = p
+	}
+
+	exists := func(p string) bool {
+		if _, ok := pages[p]; ok {
+			return true
+		}
+		if config.WithSitemap && p == "/sitemap.xml" {
+			return true
+		}
+		if file.IsFile(config.Public, p) {
+			return true
+		}
+		if config.Assets != nil {
+			if p == asset.ManifestPath {
+				return true
+			}
+			if _, ok := config.Assets.Resolve(p); ok {
+				return true
+			}
+		}
+		if config.Variants != nil {
+			_, _, ok := config.Variants.Resolve(p)
+			return ok
+		}
+		return false
+	}
+
+	visited := map[string]bool{}
+	var queue []string
+	for _, entry := range config.EntryPages {
+		if _, ok := pages[entry]; !ok {
+			return report, fmt.Errorf("entry page '%s' is not a registered page", entry)
+		}
+		if !visited[entry] {
+			visited[entry] = true
+			queue = append(queue, entry)
+		}
+	}
+
+	for len(queue) > 0 {
+		pagePath := queue[0]
+		queue = queue[1:]
+		report.Crawled = append(report.Crawled, pagePath)
+		if !file.IsHTML(pagePath) {
+			continue
+		}
+
+		src, err := pages[pagePath].Render(config.Transforms)
+		if err != nil {
+			return report, fmt.Errorf("could not transform page '%s': %w", pagePath, err)
+		}
+
+		for _, ref := range markup.Refs(src, markup.Tokenize(src)) {
+			target, internal, err := Resolve(config.BasePath, pagePath, ref.URL)
+			if !internal {
+				continue
+			}
+			if err != nil {
+				report.Broken = append(report.Broken, BrokenLink{Page: pagePath, Line: ref.Line, Link: ref.URL, Reason: reason(err)})
+				continue
+			}
+
+			found := ""
+			for _, c := range file.Candidates(target.Path) {
+				if exists(c) {
+					found = c
+					break
+				}
+			}
+			if found == "" {
+				report.Broken = append(report.Broken, BrokenLink{Page: pagePath, Line: ref.Line, Link: ref.URL, Reason: "is not a page or public file"})
+				continue
+			}
+			if _, isPage := pages[found]; isPage && !visited[found] {
+				visited[found] = true
+				queue = append(queue, found)
+			}
+		}
+	}
+
+	for _, p := range *config.Pages {
+		if !visited[p.Path] && file.IsHTML(p.Path) && !isNotFoundPage(p.Path) {
+			report.Unreachable = append(report.Unreachable, p.Path)
+		}
+	}
+	return report, nil
+}
+
+// isNotFoundPage reports whether the page is served by hosts for missing files,
+// such as '/404.html' or '/docs/404.html'.
+func isNotFoundPage(pagePath string) bool {
+	name := path.Base(pagePath)
+	return name == "404.html" || name == "404.htm"
+}
+
+func reason(err error) string {
+	if errors.Is(err, ErrOutsideBasePath) {
+		return "is outside of the base path"
+	}
+	return fmt.Sprintf("is not valid (%v)", err)
+}
@@ -0,0 +1,334 @@
+package links
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/markup"
+)
+
+type ExternalConfig struct {
+	DistDir string
+	// Concurrency is the number of links checked at the same time.
+	Concurrency int
+	// Timeout is the time allowed for each request.
+	Timeout time.Duration
+	// HostInterval is the minimum time between two requests to the same host.
+	HostInterval time.Duration
+	// CacheFile stores the links that resolved, so they are not checked again
+	// until CacheTTL has passed. No cache is used if it is empty.
+	CacheFile string
+	CacheTTL  time.Duration
+	// StandIns maps hosts to the base URL of a server that answers in their place,
+	// such as a local test server. The path of the link is appended to the path of
+	// the base URL, so 'http://localhost:8080/mock' receives '/mock/page'.
+	StandIns map[string]string
+	// Transport is used to send requests, http.DefaultTransport if nil.
+	Transport http.RoundTripper
+}
+
+// LinkSource is where a link was found in the site.
+type LinkSource struct {
+	Page string
+	Line int
+}
+
+// ExternalLink is an external URL that could not be reached.
+type ExternalLink struct {
+	URL     string
+	Status  int
+	Err     string
+	Sources []LinkSource
+}
+
+func (e ExternalLink) String() string {
+	reason := fmt.Sprintf("status %d", e.Status)
+	if e.Err != "" {
+		reason = e.Err
+	}
+	s := fmt.Sprintf("%s (%s), linked from", e.URL, reason)
+	for i, src := range e.Sources {
+		if i > 0 {
+			s += ","
+		}
+		s += fmt.Sprintf(" %s:%d", src.Page, src.Line)
+	}
+	return s
+}
+
+type ExternalReport struct {
+	Checked int
+	Cached  int
+	Broken  []ExternalLink
+}
+
+type cacheEntry struct {
+	Status    int       `json:"status"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// CheckExternal collects the absolute http and https URLs linked from every html
+// page of the built site, and requests each of them to find the ones that are broken.
+func CheckExternal(config ExternalConfig) (ExternalReport, error) {
+	report := ExternalReport{}
+	sources, err := externalLinks(config.DistDir)
+	if err != nil {
+		return report, err
+	}
+
+	cache := map[string]cacheEntry{}
+	if config.CacheFile != "" {
+		cache, err = readCache(config.CacheFile, config.CacheTTL)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	var toCheck []string
+	for link := range sources {
+		if _, ok := cache[link]; ok {
+			report.Cached++
+			continue
+		}
+		toCheck = append(toCheck, link)
+	}
+	sort.Strings(toCheck)
+	report.Checked = len(toCheck)
+
+	checker := newExternalChecker(config)
+	results := make([]ExternalLink, len(toCheck))
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for i := 0; i < max(config.Concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results[j] = checker.check(toCheck[j])
+			}
+		}()
+	}
+	for j := range toCheck {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, res := range results {
+		if res.Err == "" && res.Status < 400 {
+			cache[res.URL] = cacheEntry{Status: res.Status, CheckedAt: time.Now()}
+			continue
+		}
+		res.Sources = sources[res.URL]
+		report.Broken = append(report.Broken, res)
+	}
+
+	if config.CacheFile != "" {
+		if err := writeCache(config.CacheFile, cache); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// externalLinks returns every absolute http and https URL linked from the html
+// pages in the directory, without fragments, along with where they were found.
+func externalLinks(dir string) (map[string][]LinkSource, error) {
+	sources := map[string][]LinkSource{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !file.IsHTML(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range markup.Refs(src, markup.Tokenize(src)) {
+			u, err := url.Parse(ref.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				continue
+			}
+			u.Fragment = ""
+			link := u.String()
+			sources[link] = append(sources[link], LinkSource{Page: "/" + filepath.ToSlash(rel), Line: ref.Line})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read dist directory: %w", err)
+	}
+	return sources, nil
+}
+
+type externalChecker struct {
+	config ExternalConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlot
+}
+
+// hostSlot schedules the requests to a single host.
+type hostSlot struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+func newExternalChecker(config ExternalConfig) *externalChecker {
+	transport := config.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	c := &externalChecker{
+		config: config,
+		hosts:  map[string]*hostSlot{},
+	}
+	c.client = &http.Client{
+		Timeout:   config.Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return c.standIn(req)
+		},
+	}
+	return c
+}
+
+// wait blocks until a request to the host is allowed by the host interval.
+func (c *externalChecker) wait(host string) {
+	c.mu.Lock()
+	slot, ok := c.hosts[host]
+	if !ok {
+		slot = &hostSlot{}
+		c.hosts[host] = slot
+	}
+	c.mu.Unlock()
+
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+	time.Sleep(time.Until(slot.next))
+	slot.next = time.Now().Add(c.config.HostInterval)
+}
+
+func (c *externalChecker) check(link string) ExternalLink {
+	result := ExternalLink{URL: link}
+	u, err := url.Parse(link)
+	if err != nil {
+		result.Err = err.Error()
+		return result
+	}
+
+	c.wait(u.Host)
+	status, err := c.request(http.MethodHead, u)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented || status == http.StatusForbidden) {
+		// some servers do not answer HEAD requests properly
+		c.wait(u.Host)
+		status, err = c.request(http.MethodGet, u)
+	}
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		result.Err = err.Error()
+		return result
+	}
+	result.Status = status
+	return result
+}
+
+func (c *externalChecker) request(method string, u *url.URL) (int, error) {
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.standIn(req); err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "litepage-link-checker")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// standIn sends the request to the stand-in of its host, if there is one, under
+// the path of the stand-in, while keeping the original host in the Host header.
+func (c *externalChecker) standIn(req *http.Request) error {
+	standIn, ok := c.config.StandIns[req.URL.Host]
+	if !ok {
+		return nil
+	}
+	base, err := url.Parse(standIn)
+	if err != nil {
+		return fmt.Errorf("invalid stand-in for '%s': %w", req.URL.Host, err)
+	}
+	req.Host = req.URL.Host
+	req.URL.Scheme = base.Scheme
+	req.URL.Host = base.Host
+	if prefix := strings.TrimSuffix(base.Path, "/"); prefix != "" {
+		req.URL.Path = prefix + req.URL.Path
+		if req.URL.RawPath != "" {
+			req.URL.RawPath = strings.TrimSuffix(base.EscapedPath(), "/") + req.URL.RawPath
+		}
+	}
+	return nil
+}
+
+// readCache returns the cached links that were checked within the ttl.
+func readCache(cacheFile string, ttl time.Duration) (map[string]cacheEntry, error) {
+	cache := map[string]cacheEntry{}
+	data, err := os.ReadFile(cacheFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read link cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("could not parse link cache '%s': %w", cacheFile, err)
+	}
+	for link, entry := range cache {
+		if time.Since(entry.CheckedAt) >= ttl {
+			delete(cache, link)
+		}
+	}
+	return cache, nil
+}
+
+func writeCache(cacheFile string, cache map[string]cacheEntry) error {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := file.CreateFile(cacheFile)
+	if err != nil {
+		return fmt.Errorf("could not write link cache: %w", err)
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return err
+}
@@ -0,0 +1,50 @@
+package links
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+var ErrOutsideBasePath = errors.New("link is outside of the base path")
+
+// Target is the page or file of the site a link points to.
+type Target struct {
+	// Path is relative to the site root, without the base path.
+	Path     string
+	Fragment string
+}
+
+// Resolve resolves a link found on the page at pagePath, the same way a browser
+// would once the site is deployed under the base path. It reports false for
+// links that point outside of the site, such as other domains or mailto links.
+func Resolve(basePath string, pagePath string, link string) (Target, bool, error) {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return Target{}, false, nil
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return Target{}, true, fmt.Errorf("link is not a valid URL: %w", err)
+	}
+	if u.Scheme != "" || u.Host != "" || u.Opaque != "" {
+		return Target{}, false, nil
+	}
+
+	page := &url.URL{Path: basePath + pagePath}
+	resolved := page.ResolveReference(u)
+
+	p := resolved.Path
+	if basePath != "" {
+		if p != basePath && !strings.HasPrefix(p, basePath+"/") {
+			return Target{}, true, ErrOutsideBasePath
+		}
+		p = strings.TrimPrefix(p, basePath)
+	}
+	if p == "" {
+		p = "/"
+	}
+	return Target{Path: p, Fragment: u.Fragment}, true, nil
+}
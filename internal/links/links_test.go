@@ -0,0 +1,243 @@
+package links_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/man-on-box/litepage/internal/links"
+	"github.com/man-on-box/litepage/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		basePath         string
+		pagePath         string
+		link             string
+		expectedTarget   links.Target
+		expectedInternal bool
+		expectedError    error
+	}{
+		{pagePath: "/index.html", link: "/foo", expectedTarget: links.Target{Path: "/foo"}, expectedInternal: true},
+		{pagePath: "/nested/index.html", link: "foo.html#top", expectedTarget: links.Target{Path: "/nested/foo.html", Fragment: "top"}, expectedInternal: true},
+		{pagePath: "/nested/index.html", link: "../", expectedTarget: links.Target{Path: "/"}, expectedInternal: true},
+		{pagePath: "/nested/foo.html", link: "#bar", expectedTarget: links.Target{Path: "/nested/foo.html", Fragment: "bar"}, expectedInternal: true},
+		{pagePath: "/index.html", link: "https://example.com/foo"},
+		{pagePath: "/index.html", link: "//example.com/foo"},
+		{pagePath: "/index.html", link: "mailto:cat@example.com"},
+		{pagePath: "/index.html", link: ""},
+		{basePath: "/test", pagePath: "/index.html", link: "/test/foo?a=b", expectedTarget: links.Target{Path: "/foo"}, expectedInternal: true},
+		{basePath: "/test", pagePath: "/index.html", link: "/test", expectedTarget: links.Target{Path: "/"}, expectedInternal: true},
+		{basePath: "/test", pagePath: "/index.html", link: "foo", expectedTarget: links.Target{Path: "/foo"}, expectedInternal: true},
+		{basePath: "/test", pagePath: "/index.html", link: "/foo", expectedInternal: true, expectedError: links.ErrOutsideBasePath},
+		{basePath: "/test", pagePath: "/index.html", link: "/testing", expectedInternal: true, expectedError: links.ErrOutsideBasePath},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("resolves '%s' from '%s' with base path '%s'", tt.link, tt.pagePath, tt.basePath), func(t *testing.T) {
+			target, internal, err := links.Resolve(tt.basePath, tt.pagePath, tt.link)
+			assert.Equal(t, tt.expectedInternal, internal)
+			assert.ErrorIs(t, err, tt.expectedError)
+			assert.Equal(t, tt.expectedTarget, target)
+		})
+	}
+}
+
+func TestCrawl(t *testing.T) {
+	page := func(html string) func(w io.Writer) {
+		return func(w io.Writer) {
+			w.Write([]byte(html))
+		}
+	}
+	testPages := &[]model.Page{
+		{Path: "/index.html", Handler: page(`<a href="/test/about">About</a>
+<a href="/test/missing">Missing</a>
+<img src="/test/logo.svg">`)},
+		{Path: "/about.html", Handler: page(`<a href="nested/">Nested</a><a href="/test/sitemap.xml">Sitemap</a>`)},
+		{Path: "/nested/index.htm", Handler: page(`<a href="/about">Outside</a><a href="https://example.com">Other</a>`)},
+		{Path: "/orphan.html", Handler: page(`<a href="/test/missing">Missing</a>`)},
+		{Path: "/404.html", Handler: page(`<a href="/test/">Home</a>`)},
+		{Path: "/docs/404.html", Handler: page(`<a href="/test/">Home</a>`)},
+		{Path: "/feed.xml", Handler: page(`<rss></rss>`)},
+	}
+
+	tmpPublicDir, err := os.MkdirTemp("", "public")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpPublicDir)
+
+	err = os.WriteFile(tmpPublicDir+"/logo.svg", []byte("<svg></svg>"), 0644)
+	assert.NoError(t, err)
+
+	t.Run("reports broken links and unreachable pages", func(t *testing.T) {
+		report, err := links.Crawl(links.CrawlConfig{
+			Public:      os.DirFS(tmpPublicDir),
+			Pages:       testPages,
+			BasePath:    "/test",
+			WithSitemap: true,
+			EntryPages:  []string{"/index.html"},
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"/index.html", "/about.html", "/nested/index.htm"}, report.Crawled)
+		assert.Equal(t, []string{"/orphan.html"}, report.Unreachable)
+		assert.Equal(t, []links.BrokenLink{
+			{Page: "/index.html", Line: 2, Link: "/test/missing", Reason: "is not a page or public file"},
+			{Page: "/nested/index.htm", Line: 1, Link: "/about", Reason: "is outside of the base path"},
+		}, report.Broken)
+		assert.Equal(t, "/index.html:2 links to '/test/missing' which is not a page or public file", report.Broken[0].String())
+	})
+
+	t.Run("errors if entry page is not registered", func(t *testing.T) {
+		_, err := links.Crawl(links.CrawlConfig{
+			Public:     os.DirFS(tmpPublicDir),
+			Pages:      testPages,
+			EntryPages: []string{"/nope.html"},
+		})
+		assert.ErrorContains(t, err, "is not a registered page")
+	})
+}
+
+func TestCheck(t *testing.T) {
+	tmpDistDir, err := os.MkdirTemp("", "dist")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDistDir)
+
+	files := map[string]string{
+		"/index.html": `<a href="/test/about#team">Team</a>
+<a href="/test/about#nope">Nope</a>
+<a href="#top">Top</a>
+<img src="logo.svg" srcset="/test/logo.svg 1x, /test/logo@2x.svg 2x">`,
+		"/about.html":     `<h2 id="team">Team</h2><a href="nested/">Nested</a><a href="/about">Outside</a>`,
+		"/nested/foo.htm": `<a href="../index.html#missing">Index</a><a href="https://example.com#nope">Other</a>`,
+		"/logo.svg":       `<svg></svg>`,
+	}
+	for path, content := range files {
+		err := os.MkdirAll(filepath.Dir(tmpDistDir+path), 0755)
+		assert.NoError(t, err)
+		err = os.WriteFile(tmpDistDir+path, []byte(content), 0644)
+		assert.NoError(t, err)
+	}
+
+	report, err := links.Check(links.CheckConfig{DistDir: tmpDistDir, BasePath: "/test"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, report.Checked)
+	assert.ElementsMatch(t, []links.BrokenLink{
+		{Page: "/index.html", Line: 2, Link: "/test/about#nope", Reason: "has no element with id 'nope'"},
+		{Page: "/index.html", Line: 4, Link: "/test/logo@2x.svg", Reason: "does not exist"},
+		{Page: "/about.html", Line: 1, Link: "nested/", Reason: "does not exist"},
+		{Page: "/about.html", Line: 1, Link: "/about", Reason: "is outside of the base path"},
+		{Page: "/nested/foo.htm", Line: 1, Link: "../index.html#missing", Reason: "has no element with id 'missing'"},
+	}, report.Broken)
+}
+
+func TestCheckExternal(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.Host + r.URL.Path {
+		case "example.com/ok", "other.org/ok":
+			w.WriteHeader(http.StatusOK)
+		case "example.com/get-only":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		case "example.com/moved":
+			http.Redirect(w, r, "https://other.org/ok", http.StatusMovedPermanently)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tmpDistDir, err := os.MkdirTemp("", "dist")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDistDir)
+
+	err = os.WriteFile(tmpDistDir+"/index.html", []byte(`<a href="https://example.com/ok#intro">OK</a>
+<a href="https://example.com/gone">Gone</a>
+<a href="https://example.com/get-only">Get only</a>
+<a href="http://example.com/moved">Moved</a>
+<a href="/internal">Internal</a>
+<a href="mailto:cat@example.com">Mail</a>`), 0644)
+	assert.NoError(t, err)
+	err = os.WriteFile(tmpDistDir+"/about.html", []byte(`<a href="https://example.com/gone">Gone</a>`), 0644)
+	assert.NoError(t, err)
+
+	c := links.ExternalConfig{
+		DistDir:      tmpDistDir,
+		Concurrency:  2,
+		Timeout:      time.Second,
+		HostInterval: time.Millisecond,
+		CacheFile:    filepath.Join(tmpDistDir, "cache", "links.json"),
+		CacheTTL:     time.Hour,
+		StandIns: map[string]string{
+			"example.com": server.URL,
+			"other.org":   server.URL,
+		},
+	}
+
+	t.Run("reports links that cannot be reached", func(t *testing.T) {
+		report, err := links.CheckExternal(c)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 4, report.Checked)
+		assert.Equal(t, 0, report.Cached)
+		assert.Len(t, report.Broken, 1)
+		assert.Equal(t, "https://example.com/gone", report.Broken[0].URL)
+		assert.Equal(t, http.StatusNotFound, report.Broken[0].Status)
+		assert.ElementsMatch(t, []links.LinkSource{{Page: "/index.html", Line: 2}, {Page: "/about.html", Line: 1}}, report.Broken[0].Sources)
+	})
+
+	t.Run("does not request cached links again", func(t *testing.T) {
+		requests.Store(0)
+		report, err := links.CheckExternal(c)
+		assert.NoError(t, err)
+
+		assert.Equal(t, 1, report.Checked)
+		assert.Equal(t, 3, report.Cached)
+		assert.Len(t, report.Broken, 1)
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("keeps the path of stand-ins", func(t *testing.T) {
+		var mu sync.Mutex
+		var paths []string
+		mock := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			paths = append(paths, r.Host+r.URL.Path)
+			mu.Unlock()
+		}))
+		defer mock.Close()
+
+		c := c
+		c.CacheFile = ""
+		c.StandIns = map[string]string{"example.com": mock.URL + "/mock/", "other.org": mock.URL + "/mock"}
+		report, err := links.CheckExternal(c)
+		assert.NoError(t, err)
+
+		assert.Empty(t, report.Broken)
+		assert.ElementsMatch(t, []string{"example.com/mock/ok", "example.com/mock/gone", "example.com/mock/get-only", "example.com/mock/moved"}, paths)
+	})
+
+	t.Run("reports unreachable hosts", func(t *testing.T) {
+		c := c
+		c.CacheFile = ""
+		c.StandIns = map[string]string{"example.com": "http://127.0.0.1:1", "other.org": server.URL}
+		report, err := links.CheckExternal(c)
+		assert.NoError(t, err)
+
+		assert.Len(t, report.Broken, 4)
+		assert.NotEmpty(t, report.Broken[0].Err)
+	})
+}
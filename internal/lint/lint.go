@@ -0,0 +1,78 @@
+package lint
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/man-on-box/litepage/internal/css"
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/markup"
+	"github.com/man-on-box/litepage/internal/rewrite"
+)
+
+type Config struct {
+	DistDir  string
+	BasePath string
+	// Files are the paths of the files written by the build, such as '/index.html'.
+	// Only they are scanned, so fingerprinted copies of files and files left from
+	// earlier builds are not reported twice.
+	Files []string
+}
+
+// Problem is a URL found in a file of the built site that will not work once deployed.
+type Problem struct {
+	File    string
+	Line    int
+	URL     string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d '%s' %s", p.File, p.Line, p.URL, p.Message)
+}
+
+// BasePath scans the html pages and stylesheets of the built site for root
+// relative URLs that do not start with the base path. They point outside of the
+// site once it is deployed under the base path.
+func BasePath(config Config) ([]Problem, error) {
+	var problems []Problem
+	if config.BasePath == "" {
+		return problems, nil
+	}
+
+	message := fmt.Sprintf("is missing the base path '%s'", config.BasePath)
+	check := func(filePath string, url string, line int) {
+		if rewrite.IsRootRelative(url) && !rewrite.HasBasePath(url, config.BasePath) {
+			problems = append(problems, Problem{File: filePath, Line: line, URL: url, Message: message})
+		}
+	}
+
+	for _, filePath := range config.Files {
+		isCSS := path.Ext(filePath) == ".css"
+		if !file.IsHTML(filePath) && !isCSS {
+			continue
+		}
+		src, err := os.ReadFile(filepath.Join(config.DistDir, filepath.FromSlash(filePath)))
+		if err != nil {
+			return nil, fmt.Errorf("could not read built file: %w", err)
+		}
+
+		if isCSS {
+			for _, ref := range css.Refs(src) {
+				check(filePath, ref.URL, ref.Line)
+			}
+			continue
+		}
+
+		tokens := markup.Tokenize(src)
+		for _, ref := range markup.Refs(src, tokens) {
+			check(filePath, ref.URL, ref.Line)
+		}
+		for _, ref := range rewrite.StyleRefs(src, tokens) {
+			check(filePath, ref.URL, ref.Line)
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,56 @@
+package lint_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/lint"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasePath(t *testing.T) {
+	tmpDistDir, err := os.MkdirTemp("", "dist")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDistDir)
+
+	files := map[string]string{
+		"/index.html": `<link href="/test/styles.css" rel="stylesheet">
+<a href="/about">About</a>
+<style>
+  body { background: url(/bg.png) }
+</style>
+<a href="about">Relative</a><a href="https://example.com/">External</a>`,
+		"/css/styles.css": `.logo { background: url("/test/logo.svg") }
+.bg { background: url('/bg.png') }`,
+		"/notes.txt": `<a href="/about">Not html</a>`,
+		// a fingerprinted copy, which is not a file of the build
+		"/css/styles.3f2a9c1b.css": `.bg { background: url('/bg.png') }`,
+	}
+	built := []string{"/css/styles.css", "/index.html", "/notes.txt"}
+	for path, content := range files {
+		err := os.MkdirAll(filepath.Dir(tmpDistDir+path), 0755)
+		assert.NoError(t, err)
+		err = os.WriteFile(tmpDistDir+path, []byte(content), 0644)
+		assert.NoError(t, err)
+	}
+
+	t.Run("reports root relative urls missing the base path", func(t *testing.T) {
+		problems, err := lint.BasePath(lint.Config{DistDir: tmpDistDir, BasePath: "/test", Files: built})
+		assert.NoError(t, err)
+
+		message := "is missing the base path '/test'"
+		assert.ElementsMatch(t, []lint.Problem{
+			{File: "/index.html", Line: 2, URL: "/about", Message: message},
+			{File: "/index.html", Line: 4, URL: "/bg.png", Message: message},
+			{File: "/css/styles.css", Line: 2, URL: "/bg.png", Message: message},
+		}, problems)
+		assert.Equal(t, "/css/styles.css:2 '/bg.png' is missing the base path '/test'", problems[0].String())
+	})
+
+	t.Run("reports nothing without a base path", func(t *testing.T) {
+		problems, err := lint.BasePath(lint.Config{DistDir: tmpDistDir, Files: built})
+		assert.NoError(t, err)
+		assert.Empty(t, problems)
+	})
+}
@@ -0,0 +1,274 @@
+// Package markup is a small, lenient HTML tokenizer. It does not build a tree,
+// it only splits a document into tokens that keep their position in the
+// source, so that they can be inspected or rewritten in place.
+package markup
+
+import (
+	"bytes"
+	"html"
+	"strings"
+)
+
+type TokenType int
+
+const (
+	Text TokenType = iota
+	StartTag
+	EndTag
+	Comment
+	Doctype
+	// RawText is the content of a script or style element.
+	RawText
+)
+
+type Attr struct {
+	Name  string
+	Value string
+	// ValueStart and ValueEnd are the offsets of the raw value in the source,
+	// excluding any quotes. Both are -1 for attributes without a value.
+	ValueStart int
+	ValueEnd   int
+	Quote      byte
+}
+
+type Token struct {
+	Type TokenType
+	// Tag is the lowercase tag name of start and end tags.
+	Tag         string
+	Attrs       []Attr
+	SelfClosing bool
+	// Start and End are the offsets of the whole token in the source.
+	Start int
+	End   int
+	Line  int
+}
+
+// Attr returns the attribute with the given name, if the token has it.
+func (t Token) Attr(name string) (Attr, bool) {
+	for _, a := range t.Attrs {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Attr{}, false
+}
+
+// rawTextTags contain text that is never parsed for tags.
+var rawTextTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"textarea": true,
+	"title":    true,
+}
+
+// Tokenize splits the HTML source into tokens. Every byte of the source
+// belongs to exactly one token, in order.
+func Tokenize(src []byte) []Token {
+	z := tokenizer{src: src, line: 1}
+	return z.run()
+}
+
+type tokenizer struct {
+	src    []byte
+	pos    int
+	line   int
+	lineAt int
+	tokens []Token
+}
+
+func (z *tokenizer) run() []Token {
+	textStart := 0
+	for z.pos < len(z.src) {
+		if z.src[z.pos] != '<' {
+			z.pos++
+			continue
+		}
+		start := z.pos
+		tok, ok := z.tag()
+		if !ok {
+			z.pos = start + 1
+			continue
+		}
+		z.emit(Text, textStart, start)
+		tok.Start = start
+		tok.End = z.pos
+		tok.Line = z.lineOf(start)
+		z.tokens = append(z.tokens, tok)
+		textStart = z.pos
+
+		if tok.Type == StartTag && rawTextTags[tok.Tag] && !tok.SelfClosing {
+			end := z.closingTag(tok.Tag)
+			typ := RawText
+			if tok.Tag == "textarea" || tok.Tag == "title" {
+				typ = Text
+			}
+			z.emit(typ, z.pos, end)
+			z.pos = end
+			textStart = end
+		}
+	}
+	z.emit(Text, textStart, len(z.src))
+	return z.tokens
+}
+
+func (z *tokenizer) emit(typ TokenType, start int, end int) {
+	if end <= start {
+		return
+	}
+	z.tokens = append(z.tokens, Token{Type: typ, Start: start, End: end, Line: z.lineOf(start)})
+}
+
+// lineOf returns the line number of the offset. Offsets are always requested
+// in increasing order, so lines are counted incrementally.
+func (z *tokenizer) lineOf(offset int) int {
+	for ; z.lineAt < offset; z.lineAt++ {
+		if z.src[z.lineAt] == '\n' {
+			z.line++
+		}
+	}
+	return z.line
+}
+
+// closingTag returns the offset of the closing tag of a raw text element.
+func (z *tokenizer) closingTag(tag string) int {
+	closing := []byte("</" + tag)
+	for i := z.pos; i+len(closing) <= len(z.src); i++ {
+		if z.src[i] == '<' && bytes.EqualFold(z.src[i:i+len(closing)], closing) {
+			next := i + len(closing)
+			if next == len(z.src) || isSpace(z.src[next]) || z.src[next] == '>' || z.src[next] == '/' {
+				return i
+			}
+		}
+	}
+	return len(z.src)
+}
+
+// tag reads the markup starting at '<'. It reports false if it is not the start
+// of a tag, comment or declaration, in which case the '<' is just text.
+func (z *tokenizer) tag() (Token, bool) {
+	rest := z.src[z.pos:]
+	switch {
+	case bytes.HasPrefix(rest, []byte("<!--")):
+		end := bytes.Index(rest[4:], []byte("-->"))
+		if end < 0 {
+			z.pos = len(z.src)
+		} else {
+			z.pos += 4 + end + 3
+		}
+		return Token{Type: Comment}, true
+	case bytes.HasPrefix(rest, []byte("<!")) || bytes.HasPrefix(rest, []byte("<?")):
+		end := bytes.IndexByte(rest, '>')
+		if end < 0 {
+			z.pos = len(z.src)
+		} else {
+			z.pos += end + 1
+		}
+		return Token{Type: Doctype}, true
+	case bytes.HasPrefix(rest, []byte("</")):
+		if len(rest) < 3 || !isLetter(rest[2]) {
+			return Token{}, false
+		}
+		z.pos += 2
+		name := z.name()
+		end := bytes.IndexByte(z.src[z.pos:], '>')
+		if end < 0 {
+			z.pos = len(z.src)
+		} else {
+			z.pos += end + 1
+		}
+		return Token{Type: EndTag, Tag: name}, true
+	case len(rest) > 1 && isLetter(rest[1]):
+		z.pos++
+		tok := Token{Type: StartTag, Tag: z.name()}
+		z.attrs(&tok)
+		return tok, true
+	}
+	return Token{}, false
+}
+
+func (z *tokenizer) name() string {
+	start := z.pos
+	for z.pos < len(z.src) && !isSpace(z.src[z.pos]) && z.src[z.pos] != '>' && z.src[z.pos] != '/' {
+		z.pos++
+	}
+	return strings.ToLower(string(z.src[start:z.pos]))
+}
+
+func (z *tokenizer) attrs(tok *Token) {
+	for z.pos < len(z.src) {
+		c := z.src[z.pos]
+		switch {
+		case isSpace(c):
+			z.pos++
+		case c == '>':
+			z.pos++
+			return
+		case c == '/':
+			z.pos++
+			if z.pos < len(z.src) && z.src[z.pos] == '>' {
+				tok.SelfClosing = true
+				z.pos++
+				return
+			}
+		default:
+			tok.Attrs = append(tok.Attrs, z.attr())
+		}
+	}
+}
+
+func (z *tokenizer) attr() Attr {
+	start := z.pos
+	for z.pos < len(z.src) {
+		c := z.src[z.pos]
+		if isSpace(c) || c == '=' || c == '>' || (c == '/' && z.pos > start) {
+			break
+		}
+		z.pos++
+	}
+	a := Attr{Name: strings.ToLower(string(z.src[start:z.pos])), ValueStart: -1, ValueEnd: -1}
+
+	eq := z.pos
+	for eq < len(z.src) && isSpace(z.src[eq]) {
+		eq++
+	}
+	if eq >= len(z.src) || z.src[eq] != '=' {
+		return a
+	}
+	z.pos = eq + 1
+	for z.pos < len(z.src) && isSpace(z.src[z.pos]) {
+		z.pos++
+	}
+	if z.pos >= len(z.src) {
+		return a
+	}
+
+	if q := z.src[z.pos]; q == '"' || q == '\'' {
+		a.Quote = q
+		z.pos++
+		a.ValueStart = z.pos
+		end := bytes.IndexByte(z.src[z.pos:], q)
+		if end < 0 {
+			z.pos = len(z.src)
+			a.ValueEnd = z.pos
+		} else {
+			a.ValueEnd = z.pos + end
+			z.pos = a.ValueEnd + 1
+		}
+	} else {
+		a.ValueStart = z.pos
+		for z.pos < len(z.src) && !isSpace(z.src[z.pos]) && z.src[z.pos] != '>' {
+			z.pos++
+		}
+		a.ValueEnd = z.pos
+	}
+	a.Value = html.UnescapeString(string(z.src[a.ValueStart:a.ValueEnd]))
+	return a
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,93 @@
+package markup_test
+
+import (
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/markup"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	src := []byte(`<!doctype html>
+<html>
+  <!-- a <b>comment</b> -->
+  <p class="intro" hidden data-x='1 &amp; 2'>a < b</p>
+  <script>if (a < b) { document.write("</p>") }</script>
+  <br/>
+</html>`)
+	tokens := markup.Tokenize(src)
+
+	t.Run("every byte belongs to a token in order", func(t *testing.T) {
+		end := 0
+		for _, tok := range tokens {
+			assert.Equal(t, end, tok.Start)
+			end = tok.End
+		}
+		assert.Equal(t, len(src), end)
+	})
+
+	t.Run("parses tags, comments and raw text", func(t *testing.T) {
+		var types []markup.TokenType
+		var tags []string
+		for _, tok := range tokens {
+			if tok.Type == markup.Text {
+				continue
+			}
+			types = append(types, tok.Type)
+			tags = append(tags, tok.Tag)
+		}
+		assert.Equal(t, []markup.TokenType{
+			markup.Doctype, markup.StartTag, markup.Comment, markup.StartTag, markup.EndTag,
+			markup.StartTag, markup.RawText, markup.EndTag, markup.StartTag, markup.EndTag,
+		}, types)
+		assert.Equal(t, []string{"", "html", "", "p", "p", "script", "", "script", "br", "html"}, tags)
+	})
+
+	t.Run("parses attributes and lines", func(t *testing.T) {
+		var p markup.Token
+		for _, tok := range tokens {
+			if tok.Tag == "p" && tok.Type == markup.StartTag {
+				p = tok
+			}
+		}
+		assert.Equal(t, 4, p.Line)
+
+		class, ok := p.Attr("class")
+		assert.True(t, ok)
+		assert.Equal(t, "intro", class.Value)
+		assert.Equal(t, "intro", string(src[class.ValueStart:class.ValueEnd]))
+
+		hidden, ok := p.Attr("hidden")
+		assert.True(t, ok)
+		assert.Equal(t, -1, hidden.ValueStart)
+
+		data, ok := p.Attr("data-x")
+		assert.True(t, ok)
+		assert.Equal(t, "1 & 2", data.Value)
+		assert.Equal(t, byte('\''), data.Quote)
+	})
+}
+
+func TestRefs(t *testing.T) {
+	src := []byte(`<a href="/foo?a=1&amp;b=2">foo</a>
+<img src=/logo.svg srcset="/small.jpg 480w, /large.jpg 1080w,/huge.jpg">
+<form action="search.html"></form>
+<p id="intro"><a name="old-intro"></a></p>`)
+	tokens := markup.Tokenize(src)
+
+	t.Run("returns urls of elements", func(t *testing.T) {
+		refs := markup.Refs(src, tokens)
+		var urls []string
+		for _, r := range refs {
+			urls = append(urls, r.URL)
+		}
+		assert.Equal(t, []string{"/foo?a=1&b=2", "/logo.svg", "/small.jpg", "/large.jpg", "/huge.jpg", "search.html"}, urls)
+		assert.Equal(t, "/large.jpg", string(src[refs[3].Start:refs[3].End]))
+		assert.Equal(t, 2, refs[3].Line)
+		assert.Equal(t, "srcset", refs[3].Attr)
+	})
+
+	t.Run("returns ids of elements", func(t *testing.T) {
+		assert.Equal(t, map[string]bool{"intro": true, "old-intro": true}, markup.IDs(tokens))
+	})
+}
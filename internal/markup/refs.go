@@ -0,0 +1,107 @@
+package markup
+
+import "html"
+
+// urlAttrs are the attributes of each element that reference a URL.
+var urlAttrs = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"audio":  {"src"},
+	"button": {"formaction"},
+	"embed":  {"src"},
+	"form":   {"action"},
+	"iframe": {"src"},
+	"img":    {"src", "srcset"},
+	"input":  {"src"},
+	"link":   {"href", "imagesrcset"},
+	"object": {"data"},
+	"script": {"src"},
+	"source": {"src", "srcset"},
+	"track":  {"src"},
+	"video":  {"src", "poster"},
+}
+
+// Ref is a URL referenced from an attribute of an element.
+type Ref struct {
+	URL  string
+	Tag  string
+	Attr string
+	Line int
+	// Start and End are the offsets of the raw URL in the source.
+	Start int
+	End   int
+}
+
+// Refs returns every URL referenced by the attributes of the tokens, in order.
+// Each candidate of a srcset attribute is returned as its own reference.
+func Refs(src []byte, tokens []Token) []Ref {
+	var refs []Ref
+	for _, tok := range tokens {
+		if tok.Type != StartTag {
+			continue
+		}
+		for _, name := range urlAttrs[tok.Tag] {
+			a, ok := tok.Attr(name)
+			if !ok || a.ValueStart < 0 {
+				continue
+			}
+			if name == "srcset" || name == "imagesrcset" {
+				for _, c := range srcsetURLs(src, a.ValueStart, a.ValueEnd) {
+					refs = append(refs, Ref{URL: html.UnescapeString(string(src[c[0]:c[1]])), Tag: tok.Tag, Attr: name, Line: tok.Line, Start: c[0], End: c[1]})
+				}
+				continue
+			}
+			refs = append(refs, Ref{URL: a.Value, Tag: tok.Tag, Attr: name, Line: tok.Line, Start: a.ValueStart, End: a.ValueEnd})
+		}
+	}
+	return refs
+}
+
+// srcsetURLs returns the offsets of the URL of each candidate of a srcset value,
+// such as 'small.jpg 480w, large.jpg 1080w'.
+func srcsetURLs(src []byte, start int, end int) [][2]int {
+	var urls [][2]int
+	i := start
+	for i < end {
+		for i < end && (isSpace(src[i]) || src[i] == ',') {
+			i++
+		}
+		urlStart := i
+		for i < end && !isSpace(src[i]) {
+			i++
+		}
+		urlEnd := i
+		for urlEnd > urlStart && src[urlEnd-1] == ',' {
+			urlEnd--
+		}
+		if urlEnd > urlStart {
+			urls = append(urls, [2]int{urlStart, urlEnd})
+		}
+		if urlEnd < i {
+			// the URL was directly followed by a comma, there is no descriptor
+			continue
+		}
+		for i < end && src[i] != ',' {
+			i++
+		}
+	}
+	return urls
+}
+
+// IDs returns every fragment identifier defined in the document, from id
+// attributes and the name attribute of anchors.
+func IDs(tokens []Token) map[string]bool {
+	ids := map[string]bool{}
+	for _, tok := range tokens {
+		if tok.Type != StartTag {
+			continue
+		}
+		if a, ok := tok.Attr("id"); ok && a.Value != "" {
+			ids[a.Value] = true
+		}
+		if a, ok := tok.Attr("name"); ok && tok.Tag == "a" && a.Value != "" {
+			ids[a.Value] = true
+		}
+	}
+	return ids
+}
@@ -0,0 +1,88 @@
+package minify
+
+import (
+	"bytes"
+
+	"github.com/man-on-box/litepage/internal/css"
+)
+
+// CSS removes comments and the whitespace browsers do not need from a
+// stylesheet. Strings, url() values and comments starting with '/*!', which
+// usually hold licenses, are kept as they are.
+func CSS(src []byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(src))
+
+	// space is whether whitespace was skipped since the last byte written
+	space := false
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			next := len(src)
+			if end >= 0 {
+				next = i + 2 + end + 2
+			}
+			if i+2 < len(src) && src[i+2] == '!' {
+				writeSpace(&buf, space, c)
+				space = false
+				buf.Write(src[i:next])
+			} else if buf.Len() > 0 && css.IsIdent(buf.Bytes()[buf.Len()-1]) && next < len(src) && css.IsIdent(src[next]) {
+				// a comment between two names separates them like whitespace does, while
+				// anywhere else a space would change the meaning, such as in '.a/**/.b'
+				space = true
+			}
+			i = next
+		case css.IsSpace(c):
+			space = true
+			i++
+		case c == '"' || c == '\'':
+			writeSpace(&buf, space, c)
+			space = false
+			end := min(css.StringEnd(src, i)+1, len(src))
+			buf.Write(src[i:end])
+			i = end
+		case css.HasPrefixFold(src[i:], "url(") && (i == 0 || !css.IsIdent(src[i-1])):
+			writeSpace(&buf, space, c)
+			space = false
+			_, _, end := css.URLValue(src, i+4)
+			buf.Write(src[i:end])
+			i = end
+		default:
+			if c == '}' {
+				// the last declaration of a block needs no semicolon
+				trimSemicolon(&buf)
+			}
+			writeSpace(&buf, space, c)
+			space = false
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return bytes.TrimSpace(buf.Bytes())
+}
+
+// writeSpace writes a single space for skipped whitespace, unless it is next to
+// punctuation where whitespace is never needed. The space before ':' is kept,
+// as it separates a descendant from a pseudo class in selectors.
+func writeSpace(buf *bytes.Buffer, space bool, next byte) {
+	if !space || buf.Len() == 0 {
+		return
+	}
+	prev := buf.Bytes()[buf.Len()-1]
+	if isCSSPunct(prev) || prev == ':' || isCSSPunct(next) {
+		return
+	}
+	buf.WriteByte(' ')
+}
+
+func isCSSPunct(c byte) bool {
+	return c == '{' || c == '}' || c == ';' || c == ','
+}
+
+func trimSemicolon(buf *bytes.Buffer) {
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] == ';' {
+		buf.Truncate(buf.Len() - 1)
+	}
+}
@@ -0,0 +1,189 @@
+// Package minify removes the bytes of pages and assets that browsers do not
+// need, without changing how they are rendered.
+package minify
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/markup"
+	"github.com/man-on-box/litepage/internal/model"
+)
+
+// blockTags are elements around which whitespace is not rendered.
+var blockTags = map[string]bool{
+	"html": true, "head": true, "body": true, "title": true, "meta": true, "link": true, "base": true,
+	"address": true, "article": true, "aside": true, "blockquote": true, "details": true, "dialog": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hgroup": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true,
+	"p": true, "pre": true, "section": true, "summary": true, "table": true, "caption": true, "colgroup": true,
+	"col": true, "thead": true, "tbody": true, "tfoot": true, "tr": true, "td": true, "th": true,
+	"ul": true, "option": true, "optgroup": true, "source": true, "track": true, "template": true,
+}
+
+// preserveTags are elements whose text is rendered with its whitespace.
+var preserveTags = map[string]bool{
+	"pre":      true,
+	"textarea": true,
+}
+
+// foreignTags are elements whose content is XML, kept as it is written.
+var foreignTags = map[string]bool{
+	"svg":  true,
+	"math": true,
+}
+
+// HTML collapses whitespace, removes comments and unneeded quotes around
+// attribute values, and normalizes tags. The text of pre and textarea elements,
+// inline scripts and styles, SVG and MathML content and conditional comments are
+// kept as they are.
+func HTML(src []byte) []byte {
+	tokens := markup.Tokenize(src)
+	var buf bytes.Buffer
+	buf.Grow(len(src))
+
+	preserve := 0
+	foreign := 0
+	// whitespace between the elements of the head is never rendered
+	inHead := false
+	for i, tok := range tokens {
+		raw := src[tok.Start:tok.End]
+		switch tok.Type {
+		case markup.Comment:
+			if isConditional(raw) {
+				buf.Write(raw)
+			}
+		case markup.Doctype, markup.RawText:
+			buf.Write(raw)
+		case markup.Text:
+			if preserve > 0 {
+				buf.Write(raw)
+				continue
+			}
+			text := collapse(raw)
+			if inHead && len(bytes.TrimSpace(text)) == 0 {
+				continue
+			}
+			if isBoundary(tokens, i, -1) || bytes.HasSuffix(buf.Bytes(), []byte(" ")) {
+				text = bytes.TrimLeft(text, " ")
+			}
+			if isBoundary(tokens, i, 1) {
+				text = bytes.TrimRight(text, " ")
+			}
+			buf.Write(text)
+		case markup.StartTag:
+			if foreign > 0 || foreignTags[tok.Tag] {
+				if !tok.SelfClosing && foreignTags[tok.Tag] {
+					foreign++
+				}
+				buf.Write(raw)
+				continue
+			}
+			if preserveTags[tok.Tag] && !tok.SelfClosing {
+				preserve++
+			}
+			inHead = tok.Tag == "head" || inHead && tok.Tag != "body"
+			writeStartTag(&buf, src, tok)
+		case markup.EndTag:
+			if foreign > 0 {
+				if foreignTags[tok.Tag] {
+					foreign--
+				}
+				buf.Write(raw)
+				continue
+			}
+			if preserveTags[tok.Tag] && preserve > 0 {
+				preserve--
+			}
+			if tok.Tag == "head" {
+				inHead = false
+			}
+			buf.WriteString("</" + tok.Tag + ">")
+		}
+	}
+	return buf.Bytes()
+}
+
+// HTMLTransform returns a transform that minifies html pages.
+func HTMLTransform() model.Transform {
+	return func(pagePath string, contents []byte) ([]byte, error) {
+		if !file.IsHTML(pagePath) {
+			return contents, nil
+		}
+		return HTML(contents), nil
+	}
+}
+
+func writeStartTag(buf *bytes.Buffer, src []byte, tok markup.Token) {
+	buf.WriteString("<" + tok.Tag)
+	for _, a := range tok.Attrs {
+		buf.WriteString(" " + a.Name)
+		if a.ValueStart < 0 {
+			continue
+		}
+		value := src[a.ValueStart:a.ValueEnd]
+		buf.WriteByte('=')
+		if a.Quote == 0 || canUnquote(value) {
+			buf.Write(value)
+			continue
+		}
+		buf.WriteByte(a.Quote)
+		buf.Write(value)
+		buf.WriteByte(a.Quote)
+	}
+	buf.WriteByte('>')
+}
+
+// canUnquote reports whether the attribute value can be written without quotes.
+func canUnquote(value []byte) bool {
+	if len(value) == 0 || value[len(value)-1] == '/' {
+		return false
+	}
+	return !bytes.ContainsAny(value, " \t\n\r\f\"'=<>`")
+}
+
+// isConditional reports whether the comment is part of an Internet Explorer
+// conditional comment, such as '<!--[if IE]>' or '<!--<![endif]-->'.
+func isConditional(comment []byte) bool {
+	body := strings.TrimPrefix(string(comment), "<!--")
+	return strings.HasPrefix(body, "[") || strings.HasPrefix(body, "<![")
+}
+
+// isBoundary reports whether the text token at i is next to a block element, or
+// the start or end of the page, in the direction dir. Removed comments are skipped.
+func isBoundary(tokens []markup.Token, i int, dir int) bool {
+	for j := i + dir; j >= 0 && j < len(tokens); j += dir {
+		tok := tokens[j]
+		switch tok.Type {
+		case markup.Comment:
+			continue
+		case markup.Doctype:
+			return true
+		case markup.StartTag, markup.EndTag:
+			return blockTags[tok.Tag]
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// collapse replaces every run of whitespace with a single space.
+func collapse(text []byte) []byte {
+	out := make([]byte, 0, len(text))
+	space := false
+	for _, c := range text {
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' {
+			if !space {
+				out = append(out, ' ')
+			}
+			space = true
+			continue
+		}
+		out = append(out, c)
+		space = false
+	}
+	return out
+}
@@ -0,0 +1,255 @@
+package minify
+
+import (
+	"bytes"
+	"path"
+
+	"github.com/man-on-box/litepage/internal/model"
+)
+
+// regexKeywords are the keywords after which a '/' starts a regular expression
+// rather than a division.
+var regexKeywords = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true, "new": true,
+	"delete": true, "void": true, "throw": true, "case": true, "do": true, "else": true,
+	"yield": true, "await": true,
+}
+
+// JS removes comments and the whitespace browsers do not need from a script.
+// It does not rename or restructure code. Line breaks are kept wherever they
+// could end a statement, so automatic semicolon insertion is not affected.
+// Strings, template literals, regular expressions and comments starting with
+// '/*!', which usually hold licenses, are kept as they are.
+func JS(src []byte) []byte {
+	m := jsMinifier{src: src}
+	m.buf.Grow(len(src))
+	m.run(0, false)
+	return bytes.TrimSpace(m.buf.Bytes())
+}
+
+// AssetExtensions are the extensions of the files AssetTransform minifies.
+var AssetExtensions = []string{".css", ".js", ".mjs"}
+
+// AssetTransform returns a transform that minifies stylesheets and scripts.
+func AssetTransform() model.Transform {
+	return func(filePath string, contents []byte) ([]byte, error) {
+		switch path.Ext(filePath) {
+		case ".css":
+			return CSS(contents), nil
+		case ".js", ".mjs":
+			return JS(contents), nil
+		}
+		return contents, nil
+	}
+}
+
+type jsMinifier struct {
+	src []byte
+	buf bytes.Buffer
+	// space and newline are whether whitespace or a line break was skipped
+	// since the last byte written.
+	space   bool
+	newline bool
+	// word is the identifier or keyword being written, if any.
+	word []byte
+}
+
+// run minifies the code starting at i. Inside a template literal expression it
+// stops after the closing brace of the expression, returning its offset.
+func (m *jsMinifier) run(i int, inTemplate bool) int {
+	depth := 0
+	src := m.src
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == '\n' || c == '\r':
+			m.newline = true
+			i++
+		case isJSSpace(c):
+			m.space = true
+			i++
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			end := bytes.IndexByte(src[i:], '\n')
+			if end < 0 {
+				return len(src)
+			}
+			i += end
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			next := len(src)
+			if end >= 0 {
+				next = i + 2 + end + 2
+			}
+			comment := src[i:next]
+			if len(comment) > 2 && comment[2] == '!' {
+				m.write(comment)
+				m.newline = true
+			} else if bytes.ContainsAny(comment, "\n\r") {
+				m.newline = true
+			} else {
+				m.space = true
+			}
+			i = next
+		case c == '"' || c == '\'':
+			end := jsStringEnd(src, i)
+			m.write(src[i:end])
+			i = end
+		case c == '`':
+			i = m.template(i)
+		case c == '/' && m.regexAllowed():
+			end, ok := regexEnd(src, i)
+			if !ok {
+				m.write(src[i : i+1])
+				i++
+				continue
+			}
+			m.write(src[i:end])
+			i = end
+		default:
+			if inTemplate {
+				if c == '{' {
+					depth++
+				} else if c == '}' {
+					if depth == 0 {
+						m.write(src[i : i+1])
+						return i + 1
+					}
+					depth--
+				}
+			}
+			m.write(src[i : i+1])
+			i++
+		}
+	}
+	return i
+}
+
+// template writes the template literal starting at i, minifying the code of its
+// expressions, and returns the offset after it.
+func (m *jsMinifier) template(i int) int {
+	src := m.src
+	m.write(src[i : i+1])
+	start := i + 1
+	for j := start; j < len(src); j++ {
+		switch {
+		case src[j] == '\\':
+			j++
+		case src[j] == '`':
+			m.buf.Write(src[start : j+1])
+			return j + 1
+		case src[j] == '$' && j+1 < len(src) && src[j+1] == '{':
+			m.buf.Write(src[start : j+2])
+			m.word = m.word[:0]
+			m.space, m.newline = false, false
+			j = m.run(j+2, true)
+			m.space, m.newline = false, false
+			start = j
+			j--
+		}
+	}
+	m.buf.Write(src[start:])
+	return len(src)
+}
+
+// write writes the bytes of a token, preceded by the whitespace it needs.
+func (m *jsMinifier) write(b []byte) {
+	if m.buf.Len() > 0 && (m.space || m.newline) {
+		prev := m.buf.Bytes()[m.buf.Len()-1]
+		switch {
+		case m.newline && !newlineRemovable(prev, b[0]):
+			m.buf.WriteByte('\n')
+		case needsSpace(prev, b[0]):
+			m.buf.WriteByte(' ')
+		}
+	}
+	if m.space || m.newline || len(b) > 1 || !isJSIdent(b[0]) {
+		m.word = m.word[:0]
+	}
+	if len(b) == 1 && isJSIdent(b[0]) {
+		m.word = append(m.word, b[0])
+	}
+	m.space, m.newline = false, false
+	m.buf.Write(b)
+}
+
+// regexAllowed reports whether a '/' at this point starts a regular expression,
+// from the token written before it.
+func (m *jsMinifier) regexAllowed() bool {
+	if m.buf.Len() == 0 {
+		return true
+	}
+	prev := m.buf.Bytes()[m.buf.Len()-1]
+	if isJSIdent(prev) {
+		return regexKeywords[string(m.word)]
+	}
+	return bytes.IndexByte([]byte("(,=:[!&|?{};+-*%<>~^"), prev) >= 0
+}
+
+// newlineRemovable reports whether a line break between the two bytes can be
+// removed without a statement ending there.
+func newlineRemovable(prev byte, next byte) bool {
+	return bytes.IndexByte([]byte(";{,([=:?"), prev) >= 0 || bytes.IndexByte([]byte("})],;.?:="), next) >= 0
+}
+
+// needsSpace reports whether whitespace between the two bytes separates tokens
+// that would otherwise be read differently.
+func needsSpace(prev byte, next byte) bool {
+	switch {
+	case isJSIdent(prev) && isJSIdent(next):
+		return true
+	case (prev == '+' || prev == '-') && prev == next:
+		return true
+	case prev == '/' && (next == '/' || next == '*'):
+		return true
+	case prev >= '0' && prev <= '9' && next == '.':
+		return true
+	case prev == '<' && next == '!':
+		return true
+	}
+	return false
+}
+
+// jsStringEnd returns the offset after the string starting at i.
+func jsStringEnd(src []byte, i int) int {
+	quote := src[i]
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case quote, '\n':
+			return j + 1
+		}
+	}
+	return len(src)
+}
+
+// regexEnd returns the offset after the regular expression starting at i, not
+// including its flags. It reports false if the line ends before the expression.
+func regexEnd(src []byte, i int) (int, bool) {
+	inClass := false
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '\n', '\r':
+			return 0, false
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				return j + 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func isJSIdent(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
+
+func isJSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
@@ -0,0 +1,163 @@
+package minify_test
+
+import (
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/minify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "Collapses whitespace around block elements",
+			input: `<!DOCTYPE html>
+<html>
+  <head>
+    <title>  My   Page </title>
+  </head>
+  <body>
+    <div>
+      <p>
+        Hello,   <b>World</b> and <i>friends</i> !
+      </p>
+    </div>
+  </body>
+</html>
+`,
+			expected: `<!DOCTYPE html><html><head><title>My Page</title></head><body><div><p>Hello, <b>World</b> and <i>friends</i> !</p></div></body></html>`,
+		},
+		{
+			name:     "Removes comments but keeps conditional comments",
+			input:    "<p>a <!-- note --> b</p><!--[if IE]><p>old</p><![endif]--><!--[if !IE]><!--><p>new</p><!--<![endif]-->",
+			expected: "<p>a b</p><!--[if IE]><p>old</p><![endif]--><!--[if !IE]><!--><p>new</p><!--<![endif]-->",
+		},
+		{
+			name:     "Removes unneeded quotes and normalizes tags",
+			input:    `<A  HREF="/about"   class="nav link" data-x='' title="a=b" data-y=plain><BR /><input disabled value="/path/"></A >`,
+			expected: `<a href=/about class="nav link" data-x='' title="a=b" data-y=plain><br><input disabled value="/path/"></a>`,
+		},
+		{
+			name:     "Keeps the text of pre and textarea elements",
+			input:    "<div>\n  <pre>  line 1\n    <b>line  2</b>\n</pre>\n  <textarea>  keep\n  this </textarea>\n</div>",
+			expected: "<div><pre>  line 1\n    <b>line  2</b>\n</pre><textarea>  keep\n  this </textarea></div>",
+		},
+		{
+			name:     "Keeps inline scripts and styles",
+			input:    "<head>\n  <script>\n  if (a  <  b) { run(); }\n  </script>\n  <style>\n  p  {  color: red; }\n  </style>\n</head>",
+			expected: "<head><script>\n  if (a  <  b) { run(); }\n  </script><style>\n  p  {  color: red; }\n  </style></head>",
+		},
+		{
+			name:     "Keeps SVG markup as it is written",
+			input:    "<p>\n  <svg viewBox=\"0 0 10 10\">\n    <path d=\"M0 0\"/>\n  </svg>\n</p>",
+			expected: "<p><svg viewBox=\"0 0 10 10\"> <path d=\"M0 0\"/> </svg></p>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, string(minify.HTML([]byte(tt.input))))
+		})
+	}
+}
+
+func TestHTMLTransform(t *testing.T) {
+	transform := minify.HTMLTransform()
+
+	output, err := transform("/index.html", []byte("<p>\n  Hello\n</p>"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>Hello</p>", string(output))
+
+	output, err = transform("/feed.xml", []byte("<p>\n  Hello\n</p>"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>\n  Hello\n</p>", string(output))
+}
+
+func TestCSS(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Removes whitespace and comments",
+			input:    "/* layout */\nbody  {\n  margin : 0 auto;\n  font-family: a ,  b;\n}\n\n.nav  a:hover ,\n.nav :focus {\n  color: red !important;\n}\n",
+			expected: "body{margin :0 auto;font-family:a,b}.nav a:hover,.nav :focus{color:red !important}",
+		},
+		{
+			name:     "Keeps strings, urls and license comments",
+			input:    "/*! license */\na::before { content: \"  a ; b  \"; background: url( 'a b.png' ) , url(x.png); }",
+			expected: "/*! license */ a::before{content:\"  a ; b  \";background:url( 'a b.png' ),url(x.png)}",
+		},
+		{
+			name:     "Keeps whitespace in calc and media queries",
+			input:    "@media (min-width: 10px) and (max-width: 20px) {\n  p { width: calc(100% - 2 * 1px); }\n}",
+			expected: "@media (min-width:10px) and (max-width:20px){p{width:calc(100% - 2 * 1px)}}",
+		},
+		{
+			name:     "Separates tokens where a comment was",
+			input:    "a/**/b { color: red }",
+			expected: "a b{color:red}",
+		},
+		{
+			name:     "Removes comments within compound selectors",
+			input:    ".a/**/.b, a/**/:hover, #x/**/[y] { color: red }",
+			expected: ".a.b,a:hover,#x[y]{color:red}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, string(minify.CSS([]byte(tt.input))))
+		})
+	}
+}
+
+func TestJS(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Removes whitespace and comments",
+			input:    "// setup\nconst  total = a + b; /* sum */\nfunction add ( x, y ) {\n    return x + y;\n}\n",
+			expected: "const total=a+b;function add(x,y){return x+y;}",
+		},
+		{
+			name:     "Keeps line breaks that can end a statement",
+			input:    "let a = b\nlet c = d\nreturn\nx\ni++\n[1, 2].forEach(f)",
+			expected: "let a=b\nlet c=d\nreturn\nx\ni++\n[1,2].forEach(f)",
+		},
+		{
+			name:     "Keeps spaces between operators that would merge",
+			input:    "a = b + +c - -d; e = 1 .toString(); f = g / h",
+			expected: "a=b+ +c- -d;e=1 .toString();f=g/h",
+		},
+		{
+			name:     "Keeps strings and template literals",
+			input:    "s = \"a  // b\" + 'c /* d */'; t = `x  ${ a + `y ${ b }` }  z`",
+			expected: "s=\"a  // b\"+'c /* d */';t=`x  ${a+`y ${b}`}  z`",
+		},
+		{
+			name:     "Keeps regular expressions",
+			input:    "if (/ +\\/\\/[/ ]/g.test(s)) { return / x /.exec(s) }\nr = a / b / c",
+			expected: "if(/ +\\/\\/[/ ]/g.test(s)){return/ x /.exec(s)}\nr=a/b/c",
+		},
+		{
+			name:     "Keeps license comments",
+			input:    "/*! license */\nrun()",
+			expected: "/*! license */\nrun()",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, string(minify.JS([]byte(tt.input))))
+		})
+	}
+}
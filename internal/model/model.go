@@ -1,8 +1,35 @@
 package model
 
-import "io"
+import (
+	"bytes"
+	"io"
+)
 
 type Page struct {
 	Path    string
 	Handler func(w io.Writer)
 }
+
+// Transform rewrites the contents of a page once it has been rendered, before
+// it is written to the dist directory or served.
+type Transform func(pagePath string, contents []byte) ([]byte, error)
+
+// Deps returns the other files read when transforming a file, so that results
+// computed from the file are recomputed when any of them change.
+type Deps func(filePath string) []string
+
+// Render renders the page, then applies each transform in order.
+func (p Page) Render(transforms []Transform) ([]byte, error) {
+	var buf bytes.Buffer
+	p.Handler(&buf)
+	contents := buf.Bytes()
+
+	for _, transform := range transforms {
+		var err error
+		contents, err = transform(p.Path, contents)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return contents, nil
+}
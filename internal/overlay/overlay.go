@@ -0,0 +1,240 @@
+// Package overlay merges file systems as layers, such as a public directory
+// shared by several sites and one specific to each, where files of later
+// layers override the files at the same path in earlier ones.
+package overlay
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+
+	"github.com/man-on-box/litepage/internal/file"
+)
+
+// Layer is a file system, with the name it is reported by.
+type Layer struct {
+	Name string
+	FS   fs.FS
+}
+
+// FS is the merge of its layers. The topmost layer with a path decides what it
+// is: a file is read from that layer alone, while the entries of a directory
+// are merged from every layer where the path is a directory.
+type FS struct {
+	layers []Layer
+}
+
+func New(layers ...Layer) *FS {
+	return &FS{layers: layers}
+}
+
+// Open opens the file or directory at the name, from the topmost layer that has it.
+func (o *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	i, info, err := o.top(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if !info.IsDir() {
+		return o.layers[i].FS.Open(name)
+	}
+	entries, err := o.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	return &dir{info: info, entries: entries}, nil
+}
+
+// Stat returns the file info of the name, from the topmost layer that has it.
+func (o *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	_, info, err := o.top(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+// ReadDir returns the entries of the directory merged from every layer where
+// it is a directory, down to the first layer where it is a file, sorted by name.
+func (o *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	merged := map[string]fs.DirEntry{}
+	found := false
+	for i := len(o.layers) - 1; i >= 0; i-- {
+		info, err := fs.Stat(o.layers[i].FS, name)
+		if err != nil {
+			if hidden(o.layers[i].FS, name) {
+				break
+			}
+			continue
+		}
+		if !info.IsDir() {
+			// the file hides the directories of the layers below
+			break
+		}
+		found = true
+		entries, err := fs.ReadDir(o.layers[i].FS, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if _, ok := merged[e.Name()]; !ok {
+				merged[e.Name()] = e
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, e := range merged {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Name() < entries[b].Name() })
+	return entries, nil
+}
+
+// top returns the index of the topmost layer with the name, and its file info.
+func (o *FS) top(name string) (int, fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return 0, nil, fs.ErrInvalid
+	}
+	for i := len(o.layers) - 1; i >= 0; i-- {
+		info, err := fs.Stat(o.layers[i].FS, name)
+		if err == nil {
+			return i, info, nil
+		}
+		if hidden(o.layers[i].FS, name) {
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return 0, nil, err
+		}
+	}
+	return 0, nil, fs.ErrNotExist
+}
+
+// Lstat returns the file info of the name from the topmost layer that has it,
+// without following it if it is a symbolic link.
+func (o *FS) Lstat(name string) (fs.FileInfo, error) {
+	i, info, err := o.top(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: err}
+	}
+	if links, ok := o.layers[i].FS.(file.LinkFS); ok {
+		return links.Lstat(name)
+	}
+	return info, nil
+}
+
+// ReadLink returns the destination of the symbolic link at the name, from the
+// topmost layer that has it.
+func (o *FS) ReadLink(name string) (string, error) {
+	i, _, err := o.top(name)
+	if err != nil {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	links, ok := o.layers[i].FS.(file.LinkFS)
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return links.ReadLink(name)
+}
+
+// OSPath returns the path on disk of the file at the name, from the topmost
+// layer that has it, or "" if that layer is not on disk.
+func (o *FS) OSPath(name string) string {
+	i, info, err := o.top(name)
+	if err != nil || info.IsDir() {
+		// directories are merged from several layers
+		return ""
+	}
+	if links, ok := o.layers[i].FS.(file.LinkFS); ok {
+		return links.OSPath(name)
+	}
+	return ""
+}
+
+// hidden reports whether one of the parent directories of the name is a file in
+// the layer, which hides the directories at the same path in the layers below.
+func hidden(layer fs.FS, name string) bool {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if info, err := fs.Stat(layer, dir); err == nil {
+			return !info.IsDir()
+		}
+	}
+	return false
+}
+
+// Override is a file of a layer that hides the file at the same path in
+// earlier layers.
+type Override struct {
+	Path string
+	// Layer is the name of the layer the file is read from.
+	Layer string
+	// Overridden are the names of the layers whose file is hidden, in order.
+	Overridden []string
+}
+
+// Overrides returns the files that are found in more than one layer, sorted by path.
+func (o *FS) Overrides() ([]Override, error) {
+	found := map[string][]string{}
+	for _, l := range o.layers {
+		err := file.WalkFiles(l.FS, func(filePath string) error {
+			found[filePath] = append(found[filePath], l.Name)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var overrides []Override
+	for filePath, layers := range found {
+		if len(layers) < 2 {
+			continue
+		}
+		overrides = append(overrides, Override{Path: filePath, Layer: layers[len(layers)-1], Overridden: layers[:len(layers)-1]})
+	}
+	sort.Slice(overrides, func(a, b int) bool { return overrides[a].Path < overrides[b].Path })
+	return overrides, nil
+}
+
+// dir is a directory opened from the merged layers.
+type dir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *dir) Close() error { return nil }
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(rest))
+	d.offset += n
+	return rest[:n], nil
+}
@@ -0,0 +1,88 @@
+package overlay_test
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/man-on-box/litepage/internal/overlay"
+	"github.com/stretchr/testify/assert"
+)
+
+func layers() *overlay.FS {
+	common := fstest.MapFS{
+		"robots.txt":     {Data: []byte("common robots")},
+		"css/base.css":   {Data: []byte("common base")},
+		"css/theme.css":  {Data: []byte("common theme")},
+		"img/logo.svg":   {Data: []byte("common logo")},
+		"fonts/a.woff2":  {Data: []byte("common font")},
+		"docs/index.txt": {Data: []byte("common docs")},
+	}
+	brand := fstest.MapFS{
+		"css/theme.css": {Data: []byte("brand theme")},
+		"img/logo.svg":  {Data: []byte("brand logo")},
+	}
+	site := fstest.MapFS{
+		"css/theme.css": {Data: []byte("site theme")},
+		"css/site.css":  {Data: []byte("site css")},
+		"docs":          {Data: []byte("site docs file")},
+	}
+	return overlay.New(
+		overlay.Layer{Name: "common", FS: common},
+		overlay.Layer{Name: "brand", FS: brand},
+		overlay.Layer{Name: "site", FS: site},
+	)
+}
+
+func TestFS(t *testing.T) {
+	o := layers()
+
+	t.Run("Passes the file system checks", func(t *testing.T) {
+		assert.NoError(t, fstest.TestFS(o, "robots.txt", "css/base.css", "css/theme.css", "css/site.css", "img/logo.svg", "fonts/a.woff2", "docs"))
+	})
+
+	t.Run("Reads files from the topmost layer", func(t *testing.T) {
+		for name, expected := range map[string]string{
+			"robots.txt":    "common robots",
+			"css/theme.css": "site theme",
+			"img/logo.svg":  "brand logo",
+			"css/site.css":  "site css",
+			"docs":          "site docs file",
+		} {
+			data, err := fs.ReadFile(o, name)
+			assert.NoError(t, err, name)
+			assert.Equal(t, expected, string(data), name)
+		}
+	})
+
+	t.Run("Merges directories", func(t *testing.T) {
+		entries, err := fs.ReadDir(o, "css")
+		assert.NoError(t, err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		assert.Equal(t, []string{"base.css", "site.css", "theme.css"}, names)
+	})
+
+	t.Run("Hides directories under a file", func(t *testing.T) {
+		_, err := fs.Stat(o, "docs/index.txt")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("Errors on missing and invalid paths", func(t *testing.T) {
+		_, err := o.Open("css/missing.css")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		_, err = o.Open("../robots.txt")
+		assert.ErrorIs(t, err, fs.ErrInvalid)
+	})
+}
+
+func TestOverrides(t *testing.T) {
+	overrides, err := layers().Overrides()
+	assert.NoError(t, err)
+	assert.Equal(t, []overlay.Override{
+		{Path: "/css/theme.css", Layer: "site", Overridden: []string{"common", "brand"}},
+		{Path: "/img/logo.svg", Layer: "brand", Overridden: []string{"common"}},
+	}, overrides)
+}
@@ -0,0 +1,139 @@
+// Package pipeline runs external commands alongside litepage, such as Tailwind
+// or esbuild writing their output to the public directory.
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// Command is an external command, with the name its output is prefixed with.
+type Command struct {
+	Name string
+	Args []string
+	Dir  string
+}
+
+// label returns the name of the command, or its program if it has none.
+func (c Command) label() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return filepath.Base(c.Args[0])
+}
+
+func (c Command) cmd(ctx context.Context, out *lockedWriter) (*exec.Cmd, *prefixWriter, *prefixWriter) {
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	cmd.Dir = c.Dir
+	prefix := fmt.Sprintf("[%s] ", c.label())
+	stdout := &prefixWriter{out: out, prefix: prefix}
+	stderr := &prefixWriter{out: out, prefix: prefix}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd, stdout, stderr
+}
+
+// Run runs the commands one after the other, writing their output to out with
+// each line prefixed by the name of the command. It stops at the first command
+// that fails or exits with a non-zero status.
+func Run(commands []Command, out io.Writer) error {
+	w := &lockedWriter{out: out}
+	for _, c := range commands {
+		cmd, stdout, stderr := c.cmd(context.Background(), w)
+		err := cmd.Run()
+		stdout.Flush()
+		stderr.Flush()
+		if err != nil {
+			return fmt.Errorf("pipeline command '%s' failed: %w", c.label(), err)
+		}
+	}
+	return nil
+}
+
+// Start starts the commands as child processes, writing their output to out with
+// each line prefixed by the name of the command. Commands that exit are reported,
+// without stopping the others. The returned function stops the commands that are
+// still running and waits for them to exit.
+func Start(commands []Command, out io.Writer) (func(), error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &lockedWriter{out: out}
+	var wg sync.WaitGroup
+	for _, c := range commands {
+		cmd, stdout, stderr := c.cmd(ctx, w)
+		if err := cmd.Start(); err != nil {
+			cancel()
+			wg.Wait()
+			return nil, fmt.Errorf("could not start pipeline command '%s': %w", c.label(), err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := cmd.Wait()
+			stdout.Flush()
+			stderr.Flush()
+			if ctx.Err() != nil {
+				// stopped along with the server
+				return
+			}
+			var exitErr *exec.ExitError
+			if err != nil && !errors.As(err, &exitErr) {
+				fmt.Fprintf(w, "[%s] stopped: %v\n", c.label(), err)
+				return
+			}
+			fmt.Fprintf(w, "[%s] exited with status %d\n", c.label(), cmd.ProcessState.ExitCode())
+		}()
+	}
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}, nil
+}
+
+// lockedWriter serializes the lines written by commands running at the same time.
+type lockedWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Write(p)
+}
+
+// prefixWriter writes each complete line with the prefix.
+type prefixWriter struct {
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if _, err := w.out.Write(append([]byte(w.prefix), w.buf[:i+1]...)); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+}
+
+// Flush writes the last line, if it did not end with a line break.
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.out.Write(append(append([]byte(w.prefix), w.buf...), '\n'))
+		w.buf = nil
+	}
+}
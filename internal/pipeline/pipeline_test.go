@@ -0,0 +1,70 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/man-on-box/litepage/internal/pipeline"
+	"github.com/stretchr/testify/assert"
+)
+
+// goCommand returns a command running the go tool, which is available wherever
+// the tests run.
+func goCommand(t *testing.T, name string, args ...string) pipeline.Command {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	return pipeline.Command{Name: name, Args: append([]string{goBin}, args...)}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRun(t *testing.T) {
+	t.Run("Runs the commands prefixing their output", func(t *testing.T) {
+		var out bytes.Buffer
+		err := pipeline.Run([]pipeline.Command{goCommand(t, "os", "env", "GOOS"), goCommand(t, "", "env", "GOARCH")}, &out)
+		assert.NoError(t, err)
+		assert.Equal(t, "[os] "+runtime.GOOS+"\n[go] "+runtime.GOARCH+"\n", strings.ReplaceAll(out.String(), "go.exe", "go"))
+	})
+
+	t.Run("Stops at the first command that fails", func(t *testing.T) {
+		var out bytes.Buffer
+		err := pipeline.Run([]pipeline.Command{goCommand(t, "bad", "not-a-command"), goCommand(t, "os", "env", "GOOS")}, &out)
+		assert.ErrorContains(t, err, "pipeline command 'bad' failed")
+		assert.Contains(t, out.String(), "[bad] ")
+		assert.NotContains(t, out.String(), "[os]")
+	})
+}
+
+func TestStart(t *testing.T) {
+	var out syncBuffer
+	stop, err := pipeline.Start([]pipeline.Command{goCommand(t, "os", "env", "GOOS")}, &out)
+	assert.NoError(t, err)
+	defer stop()
+
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "[os] exited with status 0")
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "[os] "+runtime.GOOS+"\n[os] exited with status 0\n", out.String())
+}
@@ -0,0 +1,152 @@
+// Package reload reloads the pages open in the browser when the files of the
+// site change, while serving in development.
+package reload
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/markup"
+	"github.com/man-on-box/litepage/internal/model"
+	"github.com/man-on-box/litepage/internal/rewrite"
+)
+
+// Path is where pages listen for changes under the base path, with server-sent events.
+const Path = "/_litepage/reload"
+
+// script reloads the page when the server sends an event at the base path. The
+// event source reconnects by itself when the server restarts.
+func script(basePath string) string {
+	return `<script>new EventSource(` + strconv.Quote(basePath+Path) + `).onmessage = () => location.reload();</script>`
+}
+
+// Reloader watches file systems for changes, and tells the pages listening to
+// reload. The standard library cannot be notified of changes, so file systems
+// are polled at the interval.
+type Reloader struct {
+	basePath string
+	files    []fs.FS
+	interval time.Duration
+
+	mu        sync.Mutex
+	listeners map[chan struct{}]bool
+}
+
+func New(basePath string, interval time.Duration, files ...fs.FS) *Reloader {
+	return &Reloader{basePath: basePath, files: files, interval: interval, listeners: map[chan struct{}]bool{}}
+}
+
+// Watch polls the file systems until the context is done.
+func (r *Reloader) Watch(ctx context.Context) {
+	last := r.snapshot()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := r.snapshot()
+			if current != last {
+				last = current
+				r.notify()
+			}
+		}
+	}
+}
+
+// snapshot describes the files of the file systems, from their size and
+// modification time.
+func (r *Reloader) snapshot() string {
+	var s []byte
+	for i, files := range r.files {
+		fs.WalkDir(files, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			s = fmt.Appendf(s, "%d:%s:%d:%d\n", i, p, info.ModTime().UnixNano(), info.Size())
+			return nil
+		})
+	}
+	return string(s)
+}
+
+func (r *Reloader) notify() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for l := range r.listeners {
+		select {
+		case l <- struct{}{}:
+		default:
+			// a reload is already pending
+		}
+	}
+}
+
+// Handler serves the events pages listen to at Path under the base path, and
+// passes every other request to the next handler.
+func (r *Reloader) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != r.basePath+Path {
+			next.ServeHTTP(w, req)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		l := make(chan struct{}, 1)
+		r.mu.Lock()
+		r.listeners[l] = true
+		r.mu.Unlock()
+		defer func() {
+			r.mu.Lock()
+			delete(r.listeners, l)
+			r.mu.Unlock()
+		}()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-l:
+				fmt.Fprint(w, "data: reload\n\n")
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// Transform returns a transform that adds the script listening for changes at
+// the base path to the end of the body of html pages.
+func Transform(basePath string) model.Transform {
+	return func(pagePath string, contents []byte) ([]byte, error) {
+		if !file.IsHTML(pagePath) {
+			return contents, nil
+		}
+		at := len(contents)
+		for _, tok := range markup.Tokenize(contents) {
+			if tok.Type == markup.EndTag && (tok.Tag == "body" || tok.Tag == "html") {
+				at = tok.Start
+				break
+			}
+		}
+		return rewrite.Apply(contents, []rewrite.Edit{{Start: at, End: at, Text: script(basePath)}}), nil
+	}
+}
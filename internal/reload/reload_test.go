@@ -0,0 +1,68 @@
+package reload_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/man-on-box/litepage/internal/reload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	r := reload.New("/base", 10*time.Millisecond, os.DirFS(dir))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	})
+	server := httptest.NewServer(r.Handler(next))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/index.html")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the events are served under the base path only
+	resp, err = http.Get(server.URL + reload.Path)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	resp, err = http.Get(server.URL + "/base" + reload.Path)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	err = os.WriteFile(filepath.Join(dir, "styles.css"), []byte("body {}"), 0644)
+	assert.NoError(t, err)
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "data: reload\n", line)
+}
+
+func TestTransform(t *testing.T) {
+	transform := reload.Transform("")
+
+	contents, err := transform("/index.html", []byte("<html><body><p>Hi</p></body></html>"))
+	assert.NoError(t, err)
+	assert.Equal(t, `<html><body><p>Hi</p><script>new EventSource("/_litepage/reload").onmessage = () => location.reload();</script></body></html>`, string(contents))
+
+	contents, err = reload.Transform("/base")("/index.html", []byte("<html><body></body></html>"))
+	assert.NoError(t, err)
+	assert.Equal(t, `<html><body><script>new EventSource("/base/_litepage/reload").onmessage = () => location.reload();</script></body></html>`, string(contents))
+
+	contents, err = transform("/feed.xml", []byte("<feed></feed>"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<feed></feed>", string(contents))
+}
@@ -0,0 +1,107 @@
+package rewrite
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/man-on-box/litepage/internal/css"
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/markup"
+	"github.com/man-on-box/litepage/internal/model"
+)
+
+// Edit replaces the source between Start and End with Text.
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Apply returns the source with the edits applied. Edits must not overlap.
+func Apply(src []byte, edits []Edit) []byte {
+	if len(edits) == 0 {
+		return src
+	}
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Start < edits[j].Start })
+
+	var buf bytes.Buffer
+	buf.Grow(len(src))
+	pos := 0
+	for _, e := range edits {
+		buf.Write(src[pos:e.Start])
+		buf.WriteString(e.Text)
+		pos = e.End
+	}
+	buf.Write(src[pos:])
+	return buf.Bytes()
+}
+
+// StyleRefs returns the URLs referenced by the inline CSS of the page, in style
+// elements and style attributes, with offsets and lines relative to the page source.
+func StyleRefs(src []byte, tokens []markup.Token) []css.Ref {
+	var refs []css.Ref
+	add := func(start int, end int) {
+		lines := bytes.Count(src[:start], []byte("\n"))
+		for _, r := range css.Refs(src[start:end]) {
+			r.Start += start
+			r.End += start
+			r.Line += lines
+			refs = append(refs, r)
+		}
+	}
+
+	inStyle := false
+	for _, tok := range tokens {
+		switch tok.Type {
+		case markup.StartTag:
+			inStyle = tok.Tag == "style"
+			if a, ok := tok.Attr("style"); ok && a.ValueStart >= 0 {
+				add(a.ValueStart, a.ValueEnd)
+			}
+		case markup.RawText:
+			if inStyle {
+				add(tok.Start, tok.End)
+			}
+		}
+	}
+	return refs
+}
+
+// IsRootRelative reports whether the URL is a path from the root of the domain,
+// such as '/styles.css', rather than relative or to another domain.
+func IsRootRelative(url string) bool {
+	return strings.HasPrefix(url, "/") && !strings.HasPrefix(url, "//")
+}
+
+// HasBasePath reports whether the root relative URL already starts with the base path.
+func HasBasePath(url string, basePath string) bool {
+	rest, ok := strings.CutPrefix(url, basePath)
+	return ok && (rest == "" || strings.ContainsAny(rest[:1], "/?#"))
+}
+
+// BasePath returns a transform that prefixes every root relative URL of html
+// pages with the base path, in URL attributes as well as inline CSS. URLs that
+// already start with the base path are left as they are.
+func BasePath(basePath string) model.Transform {
+	return func(pagePath string, contents []byte) ([]byte, error) {
+		if basePath == "" || !file.IsHTML(pagePath) {
+			return contents, nil
+		}
+
+		tokens := markup.Tokenize(contents)
+		var edits []Edit
+		prefix := func(url string, start int) {
+			if IsRootRelative(url) && !HasBasePath(url, basePath) {
+				edits = append(edits, Edit{Start: start, End: start, Text: basePath})
+			}
+		}
+		for _, ref := range markup.Refs(contents, tokens) {
+			prefix(ref.URL, ref.Start)
+		}
+		for _, ref := range StyleRefs(contents, tokens) {
+			prefix(ref.URL, ref.Start)
+		}
+		return Apply(contents, edits), nil
+	}
+}
@@ -0,0 +1,64 @@
+package rewrite_test
+
+import (
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/rewrite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasePath(t *testing.T) {
+	transform := rewrite.BasePath("/base")
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "prefixes root relative attributes",
+			input:    `<a href="/foo">Foo</a><img src='/logo.svg'><form action=/search></form>`,
+			expected: `<a href="/base/foo">Foo</a><img src='/base/logo.svg'><form action=/base/search></form>`,
+		},
+		{
+			name:     "prefixes each srcset candidate",
+			input:    `<img srcset="/small.jpg 480w, /large.jpg 1080w">`,
+			expected: `<img srcset="/base/small.jpg 480w, /base/large.jpg 1080w">`,
+		},
+		{
+			name:     "prefixes url() in inline css",
+			input:    `<style>body { background: url("/bg.png") }</style><div style="background: url(/bg.png)"></div>`,
+			expected: `<style>body { background: url("/base/bg.png") }</style><div style="background: url(/base/bg.png)"></div>`,
+		},
+		{
+			name:     "leaves relative, external and already prefixed urls",
+			input:    `<a href="foo">Foo</a><a href="//cdn.com/x.js">CDN</a><a href="https://a.com/">A</a><a href="/base/foo">Base</a><a href="/base">Root</a><a href="#top">Top</a>`,
+			expected: `<a href="foo">Foo</a><a href="//cdn.com/x.js">CDN</a><a href="https://a.com/">A</a><a href="/base/foo">Base</a><a href="/base">Root</a><a href="#top">Top</a>`,
+		},
+		{
+			name:     "prefixes paths that only start like the base path",
+			input:    `<a href="/baseball">Baseball</a>`,
+			expected: `<a href="/base/baseball">Baseball</a>`,
+		},
+		{
+			name:     "leaves text and scripts",
+			input:    `<p>href="/foo"</p><script>fetch("/api")</script>`,
+			expected: `<p>href="/foo"</p><script>fetch("/api")</script>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := transform("/index.html", []byte(tt.input))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(out))
+		})
+	}
+
+	t.Run("does not transform pages that are not html", func(t *testing.T) {
+		input := `<a href="/foo">Foo</a>`
+		out, err := transform("/feed.xml", []byte(input))
+		assert.NoError(t, err)
+		assert.Equal(t, input, string(out))
+	})
+}
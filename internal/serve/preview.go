@@ -0,0 +1,70 @@
+package serve
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/man-on-box/litepage/internal/file"
+)
+
+type PreviewConfig struct {
+	Config
+	// DistDir is the directory the built site is served from.
+	DistDir string
+}
+
+type previewServer struct {
+	siteServer
+	distDir string
+}
+
+// NewPreview creates a server for the site already built in the dist directory,
+// so that the exact files that will be deployed can be checked before deploying.
+func NewPreview(config PreviewConfig) SiteServer {
+	s := &previewServer{
+		siteServer: siteServer{Config: config.Config},
+		distDir:    config.DistDir,
+	}
+	return s
+}
+
+func (s *previewServer) SetupRoutes() http.Handler {
+	site := &siteFiles{files: os.DirFS(s.distDir), headers: s.Config.Headers, compress: s.Config.Compress}
+	if s.Config.Host != nil {
+		return s.hostHandler(site)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.outsideBasePath(r.URL.Path) {
+			if !s.redirectToBasePath(w, r, s.existsIn(site)) {
+				s.customNotFound(w, r)
+			}
+			return
+		}
+
+		// resolve paths the same way the dev server does, allowing the extension
+		// and index of html pages to be left out
+		p := strings.TrimPrefix(r.URL.Path, s.Config.BasePath)
+		for _, c := range file.Candidates(p) {
+			if site.Exists(c) {
+				log.Printf("[%d]: %s", http.StatusOK, r.URL.Path)
+				site.ServeFile(w, r, c, http.StatusOK)
+				return
+			}
+		}
+		s.customNotFound(w, r)
+	})
+}
+
+func (s *previewServer) Serve(port string) error {
+	usePort := port
+	if usePort == "" {
+		usePort = defaultPort
+	}
+	fmt.Printf("LITEPAGE starting preview server for '%s' at http://localhost:%s...\n", s.distDir, usePort)
+
+	return http.ListenAndServe("localhost:"+usePort, s.SetupRoutes())
+}
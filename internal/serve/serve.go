@@ -1,17 +1,28 @@
 package serve
 
 import (
+	"bytes"
+	"context"
 	_ "embed"
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"log"
+	"mime"
 	"net/http"
-	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/man-on-box/litepage/internal/asset"
+	"github.com/man-on-box/litepage/internal/compress"
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/host"
+	"github.com/man-on-box/litepage/internal/images"
 	"github.com/man-on-box/litepage/internal/model"
+	"github.com/man-on-box/litepage/internal/reload"
 	"github.com/man-on-box/litepage/internal/sitemap"
 )
 
@@ -27,11 +38,32 @@ type SiteServer interface {
 }
 
 type Config struct {
-	PublicDir   string
+	// Public holds the public files served along with the pages.
+	Public      fs.FS
 	Pages       *[]model.Page
 	SiteDomain  string
 	BasePath    string
 	WithSitemap bool
+	// Host, if set, makes the server follow the routing rules of the given host
+	// strictly, rather than the lenient rules used by default.
+	Host       *host.Host
+	Transforms []model.Transform
+	// Assets, if set, serves public files under their fingerprinted names, along
+	// with the manifest of them.
+	Assets *asset.Fingerprinter
+	// Headers, if set, returns headers to send along with each page, such as a
+	// Content-Security-Policy computed from its contents.
+	Headers func(pagePath string, contents []byte) http.Header
+	// AssetTransforms, if set, are applied to public files before they are served.
+	AssetTransforms []model.Transform
+	// Compress, if set, compresses responses for browsers that accept one of its
+	// encodings. The dev server compresses them on the fly, while the preview
+	// server serves the compressed copies written next to the built files.
+	Compress *compress.Config
+	// Reload, if set, serves the events that tell pages to reload when files change.
+	Reload *reload.Reloader
+	// Variants, if set, serves the resized variants of images, generated on request.
+	Variants *images.Variants
 }
 
 type siteServer struct {
@@ -46,11 +78,29 @@ func New(config Config) SiteServer {
 }
 
 func (s *siteServer) SetupRoutes() http.Handler {
+	var handler http.Handler
+	if s.Config.Host != nil {
+		handler = s.setupHostRoutes()
+	} else {
+		handler = s.setupRoutes()
+	}
+	if s.Config.Compress != nil {
+		handler = compress.Handler(handler, *s.Config.Compress)
+	}
+	if s.Config.Reload != nil {
+		// events are streamed, so they must not go through compression
+		handler = s.Config.Reload.Handler(handler)
+	}
+	return handler
+}
+
+func (s *siteServer) setupRoutes() http.Handler {
+
 	mux := http.NewServeMux()
-	var rootHandler func(w io.Writer)
+	var rootHandler func(w http.ResponseWriter)
 	registeredPaths := map[string]bool{}
 
-	registerHandler := func(path string, handler func(w io.Writer)) {
+	registerHandler := func(path string, handler func(w http.ResponseWriter)) {
 		registeredPaths[path] = true
 
 		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
@@ -64,10 +114,16 @@ func (s *siteServer) SetupRoutes() http.Handler {
 
 	for _, p := range *s.Config.Pages {
 		fullPath := s.Config.BasePath + p.Path
-		pageHandler := func(w io.Writer) {
+		pageHandler := func(w http.ResponseWriter) {
+			contents, err := p.Render(s.Config.Transforms)
+			if err != nil {
+				log.Printf("[%d]: %s: %v", http.StatusInternalServerError, fullPath, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 			log.Printf("[%d]: %s", http.StatusOK, fullPath)
-			p.Handler(w)
-
+			s.setHeaders(w, p.Path, contents)
+			w.Write(contents)
 		}
 		registerHandler(fullPath, pageHandler)
 
@@ -99,13 +155,32 @@ func (s *siteServer) SetupRoutes() http.Handler {
 		})
 	}
 
+	if s.Config.Assets != nil {
+		registerHandler(s.Config.BasePath+asset.ManifestPath, s.manifestHandler)
+	}
+
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == s.Config.BasePath+"/" && rootHandler != nil {
 			rootHandler(w)
 			return
 		}
-		if len(s.Config.BasePath) > 0 && !strings.HasPrefix(r.URL.Path, s.Config.BasePath) {
-			s.customNotFound(w, r)
+		if s.outsideBasePath(r.URL.Path) {
+			exists := func(p string) bool {
+				if registeredPaths[p] || p == s.Config.BasePath+"/" && rootHandler != nil {
+					return true
+				}
+				if s.Config.WithSitemap && p == s.Config.BasePath+"/sitemap.xml" {
+					return true
+				}
+				staticPath := strings.TrimPrefix(p, s.Config.BasePath)
+				if _, ok := s.publicFile(staticPath); ok {
+					return true
+				}
+				return s.isVariant(staticPath)
+			}
+			if !s.redirectToBasePath(w, r, exists) {
+				s.customNotFound(w, r)
+			}
 			return
 		}
 		s.serveFile(w, r)
@@ -113,12 +188,67 @@ func (s *siteServer) SetupRoutes() http.Handler {
 	return mux
 }
 
+// setHeaders sets the configured headers of the page on the response.
+func (s *siteServer) setHeaders(w http.ResponseWriter, pagePath string, contents []byte) {
+	if s.Config.Headers == nil {
+		return
+	}
+	for name, values := range s.Config.Headers(pagePath, contents) {
+		w.Header()[name] = values
+	}
+}
+
+// outsideBasePath reports whether the URL path is not under the base path, such
+// as '/testing' for the base path '/test'.
+func (s *siteServer) outsideBasePath(urlPath string) bool {
+	if s.Config.BasePath == "" {
+		return false
+	}
+	rest, ok := strings.CutPrefix(urlPath, s.Config.BasePath)
+	return !ok || rest != "" && rest[0] != '/'
+}
+
+// redirectToBasePath redirects a request outside of the base path to the same
+// path under the base path, if it exists there. It reports whether it redirected.
+func (s *siteServer) redirectToBasePath(w http.ResponseWriter, r *http.Request, exists func(p string) bool) bool {
+	prefixed := s.Config.BasePath + r.URL.Path
+	if !exists(prefixed) {
+		return false
+	}
+
+	target := prefixed
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	log.Printf("[%d]: %s is outside of the base path '%s', redirecting to %s", http.StatusFound, r.URL.Path, s.Config.BasePath, prefixed)
+	http.Redirect(w, r, target, http.StatusFound)
+	return true
+}
+
+// existsIn returns whether a file of the site is served at a URL path under the
+// base path, allowing the extension and index of html pages to be left out.
+func (s *siteServer) existsIn(site host.Site) func(p string) bool {
+	return func(p string) bool {
+		for _, c := range file.Candidates(strings.TrimPrefix(p, s.Config.BasePath)) {
+			if site.Exists(c) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 func (s *siteServer) Serve(port string) error {
 	usePort := port
 	if usePort == "" {
 		usePort = defaultPort
 	}
 	fmt.Printf("LITEPAGE starting dev server at http://localhost:%s...\n", usePort)
+	if s.Config.Reload != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.Config.Reload.Watch(ctx)
+	}
 
 	mux := s.SetupRoutes()
 	return http.ListenAndServe("localhost:"+usePort, mux)
@@ -126,19 +256,284 @@ func (s *siteServer) Serve(port string) error {
 
 func (s *siteServer) serveFile(w http.ResponseWriter, r *http.Request) {
 	staticPath := strings.TrimPrefix(r.URL.Path, s.Config.BasePath)
-	requestedFile := filepath.Join(s.Config.PublicDir, filepath.Clean(staticPath))
-	if _, err := os.Stat(requestedFile); os.IsNotExist(err) {
+	if _, ok := s.publicFile(staticPath); !ok && s.isVariant(staticPath) {
+		s.serveVariant(w, r, staticPath)
+		return
+	}
+	if filePath, ok := s.publicFile(staticPath); ok && (filePath != staticPath || len(s.Config.AssetTransforms) > 0) {
+		if len(s.Config.AssetTransforms) > 0 {
+			s.serveTransformed(w, r, filePath)
+			return
+		}
+		http.ServeFileFS(w, r, s.Config.Public, file.FSPath(filePath))
+		return
+	}
+	if _, err := fs.Stat(s.Config.Public, file.FSPath(staticPath)); err != nil {
 		s.customNotFound(w, r)
 	} else {
-		http.ServeFile(w, r, s.Config.PublicDir+staticPath)
+		http.ServeFileFS(w, r, s.Config.Public, file.FSPath(staticPath))
 	}
 }
 
+// publicFile returns the public file served for the path, which is the file named
+// after a fingerprinted path, or the file at the path itself.
+func (s *siteServer) publicFile(staticPath string) (string, bool) {
+	staticPath = path.Clean("/" + staticPath)
+	if file.IsFile(s.Config.Public, staticPath) {
+		return staticPath, true
+	}
+	if s.Config.Assets != nil {
+		return s.Config.Assets.Resolve(staticPath)
+	}
+	return "", false
+}
+
+// isVariant reports whether the path is a resized variant of a public image.
+func (s *siteServer) isVariant(staticPath string) bool {
+	if s.Config.Variants == nil {
+		return false
+	}
+	_, _, ok := s.Config.Variants.Resolve(path.Clean("/" + staticPath))
+	return ok
+}
+
+// serveVariant serves the resized variant of a public image at the path.
+func (s *siteServer) serveVariant(w http.ResponseWriter, r *http.Request, staticPath string) {
+	filePath, width, _ := s.Config.Variants.Resolve(path.Clean("/" + staticPath))
+	data, _, err := s.Config.Variants.Generate(filePath, width)
+	if err != nil {
+		log.Printf("[%d]: %s: %v", http.StatusInternalServerError, r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[%d]: %s", http.StatusOK, r.URL.Path)
+	http.ServeContent(w, r, staticPath, time.Time{}, bytes.NewReader(data))
+}
+
+// serveTransformed serves the public file once the asset transforms are applied.
+func (s *siteServer) serveTransformed(w http.ResponseWriter, r *http.Request, filePath string) {
+	contents, err := transformAsset(s.Config.Public, filePath, s.Config.AssetTransforms)
+	if err != nil {
+		log.Printf("[%d]: %s: %v", http.StatusInternalServerError, r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, filePath, time.Time{}, bytes.NewReader(contents))
+}
+
+// transformAsset reads the file and applies the transforms to it.
+func transformAsset(files fs.FS, filePath string, transforms []model.Transform) ([]byte, error) {
+	contents, err := fs.ReadFile(files, file.FSPath(filePath))
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range transforms {
+		contents, err = t(filePath, contents)
+		if err != nil {
+			return nil, fmt.Errorf("could not transform asset '%s': %w", filePath, err)
+		}
+	}
+	return contents, nil
+}
+
+func (s *siteServer) manifestHandler(w http.ResponseWriter) {
+	manifestPath := s.Config.BasePath + asset.ManifestPath
+	manifest, err := s.Config.Assets.Manifest()
+	var data []byte
+	if err == nil {
+		data, err = manifest.JSON()
+	}
+	if err != nil {
+		log.Printf("[%d]: %s: %v", http.StatusInternalServerError, manifestPath, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[%d]: %s", http.StatusOK, manifestPath)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (s *siteServer) setupHostRoutes() http.Handler {
+	site := &siteFiles{files: s.Config.Public, pages: map[string]model.Page{}, transforms: s.Config.Transforms, assets: s.Config.Assets, headers: s.Config.Headers, assetTransforms: s.Config.AssetTransforms, variants: s.Config.Variants}
+	for _, p := range *s.Config.Pages {
+		site.pages[p.Path] = p
+	}
+	if s.Config.WithSitemap {
+		smap := sitemap.Build(s.Config.SiteDomain, s.Config.BasePath, s.Config.Pages)
+		site.pages["/sitemap.xml"] = model.Page{Path: "/sitemap.xml", Handler: func(w io.Writer) {
+			w.Write([]byte(smap))
+		}}
+	}
+	if s.Config.Assets != nil {
+		site.pages[asset.ManifestPath] = model.Page{Path: asset.ManifestPath, Handler: func(w io.Writer) {
+			manifest, err := s.Config.Assets.Manifest()
+			if err != nil {
+				log.Printf("could not create asset manifest: %v", err)
+				return
+			}
+			data, _ := manifest.JSON()
+			w.Write(data)
+		}}
+	}
+
+	return s.hostHandler(site)
+}
+
+// hostHandler serves the site following the rules of the configured host,
+// logging every response.
+func (s *siteServer) hostHandler(site host.Site) http.Handler {
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		if rec, ok := w.(*statusRecorder); ok {
+			// customNotFound logs the request itself
+			rec.logged = true
+		}
+		s.customNotFound(w, r)
+	}
+	handler := s.Config.Host.Handler(site, s.Config.BasePath, notFound)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the host would not see these requests, but the dev server redirects them like without emulation
+		if s.outsideBasePath(r.URL.Path) && s.redirectToBasePath(w, r, s.existsIn(site)) {
+			return
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rec, r)
+		if !rec.logged {
+			log.Printf("[%d]: %s", rec.status, r.URL.Path)
+		}
+	})
+}
+
+// siteFiles is the site as the host would see it once built, made of the files
+// of a file system and, when serving in development, the registered pages.
+type siteFiles struct {
+	files      fs.FS
+	pages      map[string]model.Page
+	transforms []model.Transform
+	// assets, if set, resolves fingerprinted paths to the files they were named after.
+	assets *asset.Fingerprinter
+	// headers, if set, returns headers to send along with html files.
+	headers func(filePath string, contents []byte) http.Header
+	// assetTransforms are applied to the files of the directory when they are read.
+	assetTransforms []model.Transform
+	// compress, if set, serves the compressed copies written next to files to
+	// browsers that accept their encoding.
+	compress *compress.Config
+	// variants, if set, generates the resized variants of images on request.
+	variants *images.Variants
+}
+
+func (d *siteFiles) Exists(filePath string) bool {
+	if _, ok := d.pages[filePath]; ok {
+		return true
+	}
+	if file.IsFile(d.files, filePath) {
+		return true
+	}
+	if d.assets != nil {
+		if _, ok := d.assets.Resolve(filePath); ok {
+			return true
+		}
+	}
+	if d.variants != nil {
+		_, _, ok := d.variants.Resolve(filePath)
+		return ok
+	}
+	return false
+}
+
+func (d *siteFiles) ReadFile(filePath string) ([]byte, error) {
+	if p, ok := d.pages[filePath]; ok {
+		return p.Render(d.transforms)
+	}
+	if _, err := fs.Stat(d.files, file.FSPath(filePath)); err != nil {
+		if d.assets != nil {
+			if resolved, ok := d.assets.Resolve(filePath); ok {
+				filePath = resolved
+			}
+		}
+		if d.variants != nil {
+			if image, width, ok := d.variants.Resolve(filePath); ok {
+				data, _, err := d.variants.Generate(image, width)
+				return data, err
+			}
+		}
+	}
+	return transformAsset(d.files, filePath, d.assetTransforms)
+}
+
+func (d *siteFiles) ServeFile(w http.ResponseWriter, r *http.Request, filePath string, status int) {
+	data, err := d.ReadFile(filePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if d.headers != nil && file.IsHTML(filePath) {
+		for name, values := range d.headers(filePath, data) {
+			w.Header()[name] = values
+		}
+	}
+	if w.Header().Get("Content-Type") == "" {
+		contentType := mime.TypeByExtension(filepath.Ext(filePath))
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		w.Header().Set("Content-Type", contentType)
+	}
+	if d.compress != nil && status == http.StatusOK {
+		data = d.encode(w, r, filePath, data)
+	}
+	if status == http.StatusOK {
+		http.ServeContent(w, r, filePath, time.Time{}, bytes.NewReader(data))
+		return
+	}
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
+
+// encode returns the compressed copy of the file in the encoding preferred by
+// the request, if one was written, setting the headers describing it.
+func (d *siteFiles) encode(w http.ResponseWriter, r *http.Request, filePath string, data []byte) []byte {
+	var available []compress.Encoding
+	for _, e := range d.compress.Encodings {
+		if file.IsFile(d.files, filePath+e.Extension) {
+			available = append(available, e)
+		}
+	}
+	if len(available) == 0 {
+		return data
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	e, ok := compress.Negotiate(r.Header.Get("Accept-Encoding"), available)
+	if !ok {
+		return data
+	}
+	compressed, err := fs.ReadFile(d.files, file.FSPath(filePath+e.Extension))
+	if err != nil {
+		return data
+	}
+	w.Header().Set("Content-Encoding", e.Name)
+	return compressed
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	logged bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
 func (s *siteServer) customNotFound(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[%d]: %s", http.StatusNotFound, r.URL.Path)
 	w.WriteHeader(http.StatusNotFound)
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	showBasePathError := len(s.Config.BasePath) > 0 && !strings.HasPrefix(r.URL.Path, s.Config.BasePath)
+	showBasePathError := s.outsideBasePath(r.URL.Path)
 	notFoundTmpl.Execute(w, struct {
 		ShowBasePathError bool
 		BasePath          string
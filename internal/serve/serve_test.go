@@ -1,14 +1,26 @@
 package serve_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"html/template"
+	"image"
+	"image/png"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/man-on-box/litepage/internal/asset"
+	"github.com/man-on-box/litepage/internal/compress"
+	"github.com/man-on-box/litepage/internal/host"
+	"github.com/man-on-box/litepage/internal/ignore"
+	"github.com/man-on-box/litepage/internal/images"
 	"github.com/man-on-box/litepage/internal/model"
 	"github.com/man-on-box/litepage/internal/serve"
 	"github.com/stretchr/testify/assert"
@@ -226,7 +238,7 @@ func TestSiteServer(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := serve.Config{
-				PublicDir:   tmpPublicDir,
+				Public:      os.DirFS(tmpPublicDir),
 				Pages:       testPages,
 				SiteDomain:  "test.com",
 				WithSitemap: true,
@@ -252,7 +264,7 @@ func TestSiteServer(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name+" with base path", func(t *testing.T) {
 			c := serve.Config{
-				PublicDir:   tmpPublicDir,
+				Public:      os.DirFS(tmpPublicDir),
 				Pages:       testPages,
 				SiteDomain:  "test.com",
 				BasePath:    "/test",
@@ -276,3 +288,607 @@ func TestSiteServer(t *testing.T) {
 		})
 	}
 }
+
+func TestSiteServerWithHostEmulation(t *testing.T) {
+	testPages := &[]model.Page{
+		{
+			Path: "/index.html",
+			Handler: func(w io.Writer) {
+				w.Write([]byte("<h1>Index Page</h1>"))
+			},
+		},
+		{
+			Path: "/nested/index.htm",
+			Handler: func(w io.Writer) {
+				w.Write([]byte("<h1>Nested Index Page</h1>"))
+			},
+		},
+		{
+			Path: "/404.html",
+			Handler: func(w io.Writer) {
+				w.Write([]byte("<h1>Custom 404</h1>"))
+			},
+		},
+	}
+
+	tmpPublicDir, err := os.MkdirTemp("", "public")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpPublicDir)
+
+	err = os.WriteFile(tmpPublicDir+"/testfile.txt", []byte("Hello from static text file"), 0644)
+	assert.NoError(t, err)
+
+	h, err := host.Lookup("github-pages")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Serves index page at root",
+			path:           "/",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "<h1>Index Page</h1>",
+		},
+		{
+			name:           "Does not resolve '.htm' index pages",
+			path:           "/nested/",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "<h1>Custom 404</h1>",
+		},
+		{
+			name:           "Serves public files",
+			path:           "/testfile.txt",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "Hello from static text file",
+		},
+		{
+			name:           "Serves sitemap",
+			path:           "/sitemap.xml",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := serve.Config{
+				Public:      os.DirFS(tmpPublicDir),
+				Pages:       testPages,
+				SiteDomain:  "test.com",
+				BasePath:    "/test",
+				WithSitemap: true,
+				Host:        h,
+			}
+			s := serve.New(c)
+			server := httptest.NewServer(s.SetupRoutes())
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + c.BasePath + tt.path)
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if len(tt.expectedBody) > 0 {
+				assert.Equal(t, tt.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestPreviewServer(t *testing.T) {
+	tmpDistDir, err := os.MkdirTemp("", "dist")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDistDir)
+
+	files := map[string]string{
+		"/index.html":        "<h1>Index Page</h1>",
+		"/foo.htm":           "<h1>Foo Page</h1>",
+		"/nested/index.html": "<h1>Nested Index Page</h1>",
+		"/testfile.txt":      "Hello from static text file",
+	}
+	for path, content := range files {
+		err := os.MkdirAll(filepath.Dir(tmpDistDir+path), 0755)
+		assert.NoError(t, err)
+		err = os.WriteFile(tmpDistDir+path, []byte(content), 0644)
+		assert.NoError(t, err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Can serve index page at '/'",
+			path:           "/",
+			expectedStatus: http.StatusOK,
+			expectedBody:   files["/index.html"],
+		},
+		{
+			name:           "Can serve foo page at '/foo'",
+			path:           "/foo",
+			expectedStatus: http.StatusOK,
+			expectedBody:   files["/foo.htm"],
+		},
+		{
+			name:           "Can serve nested index page at '/nested'",
+			path:           "/nested",
+			expectedStatus: http.StatusOK,
+			expectedBody:   files["/nested/index.html"],
+		},
+		{
+			name:           "Can serve nested index page at '/nested/index.html'",
+			path:           "/nested/index.html",
+			expectedStatus: http.StatusOK,
+			expectedBody:   files["/nested/index.html"],
+		},
+		{
+			name:           "Returns text file",
+			path:           "/testfile.txt",
+			expectedStatus: http.StatusOK,
+			expectedBody:   files["/testfile.txt"],
+		},
+		{
+			name:           "Does not load text file without .txt extension",
+			path:           "/testfile",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Returns 404 for non existent page",
+			path:           "/nope",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, basePath := range []string{"", "/test"} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s with base path '%s'", tt.name, basePath), func(t *testing.T) {
+				c := serve.PreviewConfig{
+					Config:  serve.Config{BasePath: basePath},
+					DistDir: tmpDistDir,
+				}
+				s := serve.NewPreview(c)
+				server := httptest.NewServer(s.SetupRoutes())
+				defer server.Close()
+
+				resp, err := http.Get(server.URL + basePath + tt.path)
+				assert.NoError(t, err)
+				defer resp.Body.Close()
+
+				body, err := io.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+				if len(tt.expectedBody) > 0 {
+					assert.Equal(t, tt.expectedBody, string(body))
+				}
+			})
+		}
+	}
+
+	t.Run("Does not serve files outside of the dist directory", func(t *testing.T) {
+		root := t.TempDir()
+		distDir := filepath.Join(root, "dist")
+		assert.NoError(t, os.MkdirAll(distDir, 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(root, "secret.txt"), []byte("top secret contents"), 0644))
+		s := serve.NewPreview(serve.PreviewConfig{DistDir: distDir})
+
+		for _, p := range []string{"/../secret.txt", "/nested/../../secret.txt"} {
+			// requested without the client cleaning the path first
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.URL.Path = p
+			rec := httptest.NewRecorder()
+			s.SetupRoutes().ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusNotFound, rec.Code, p)
+			assert.NotContains(t, rec.Body.String(), "top secret contents", p)
+		}
+	})
+
+	t.Run("Redirects to the base path outside of it", func(t *testing.T) {
+		s := serve.NewPreview(serve.PreviewConfig{Config: serve.Config{BasePath: "/test"}, DistDir: tmpDistDir})
+		server := httptest.NewServer(s.SetupRoutes())
+		defer server.Close()
+
+		resp, err := http.Get(server.URL + "/nested")
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "/test/nested", resp.Request.URL.Path)
+
+		resp, err = http.Get(server.URL + "/nope.html")
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestRedirectToBasePath(t *testing.T) {
+	testPages := &[]model.Page{
+		{
+			Path: "/index.html",
+			Handler: func(w io.Writer) {
+				w.Write([]byte("<h1>Index Page</h1>"))
+			},
+		},
+		{
+			Path: "/foo.html",
+			Handler: func(w io.Writer) {
+				w.Write([]byte("<h1>Foo Page</h1>"))
+			},
+		},
+	}
+
+	tmpPublicDir, err := os.MkdirTemp("", "public")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpPublicDir)
+
+	err = os.WriteFile(tmpPublicDir+"/testfile.txt", []byte("Hello from static text file"), 0644)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		path             string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{path: "/", expectedStatus: http.StatusFound, expectedLocation: "/test/"},
+		{path: "/foo?a=b", expectedStatus: http.StatusFound, expectedLocation: "/test/foo?a=b"},
+		{path: "/testfile.txt", expectedStatus: http.StatusFound, expectedLocation: "/test/testfile.txt"},
+		{path: "/sitemap.xml", expectedStatus: http.StatusFound, expectedLocation: "/test/sitemap.xml"},
+		{path: "/nope", expectedStatus: http.StatusNotFound},
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	netlify, err := host.Lookup("netlify")
+	assert.NoError(t, err)
+
+	for _, h := range []*host.Host{nil, netlify} {
+		for _, tt := range tests {
+			name := fmt.Sprintf("Request to '%s' outside of base path returns %d", tt.path, tt.expectedStatus)
+			if h != nil {
+				name += " with host emulation"
+			}
+			t.Run(name, func(t *testing.T) {
+				c := serve.Config{
+					Public:      os.DirFS(tmpPublicDir),
+					Pages:       testPages,
+					SiteDomain:  "test.com",
+					BasePath:    "/test",
+					WithSitemap: true,
+					Host:        h,
+				}
+				server := httptest.NewServer(serve.New(c).SetupRoutes())
+				defer server.Close()
+
+				resp, err := client.Get(server.URL + tt.path)
+				assert.NoError(t, err)
+				defer resp.Body.Close()
+
+				assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+				assert.Equal(t, tt.expectedLocation, resp.Header.Get("Location"))
+			})
+		}
+	}
+}
+
+func TestSiteServerWithFingerprint(t *testing.T) {
+	tmpPublicDir := t.TempDir()
+	err := os.WriteFile(tmpPublicDir+"/styles.css", []byte("body { color: red; }"), 0644)
+	assert.NoError(t, err)
+
+	assets := asset.NewFingerprinter(os.DirFS(tmpPublicDir), []string{".css"}, nil, nil)
+	hashed, err := assets.Lookup("/styles.css")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Serves the file under its fingerprinted name", path: hashed, expectedStatus: http.StatusOK, expectedBody: "body { color: red; }"},
+		{name: "Serves the file under its own name", path: "/styles.css", expectedStatus: http.StatusOK, expectedBody: "body { color: red; }"},
+		{name: "Serves a stale fingerprint of the file", path: "/styles.0123abcd.css", expectedStatus: http.StatusOK, expectedBody: "body { color: red; }"},
+		{name: "Returns 404 for a fingerprint of a missing file", path: "/missing.0123abcd.css", expectedStatus: http.StatusNotFound},
+		{name: "Serves the manifest", path: asset.ManifestPath, expectedStatus: http.StatusOK, expectedBody: fmt.Sprintf("{\n  \"/styles.css\": \"%s\"\n}\n", hashed)},
+	}
+
+	netlify, err := host.Lookup("netlify")
+	assert.NoError(t, err)
+
+	for _, h := range []*host.Host{nil, netlify} {
+		for _, basePath := range []string{"", "/test"} {
+			c := serve.Config{
+				Public:     os.DirFS(tmpPublicDir),
+				Pages:      &[]model.Page{},
+				SiteDomain: "test.com",
+				BasePath:   basePath,
+				Host:       h,
+				Assets:     assets,
+			}
+			server := httptest.NewServer(serve.New(c).SetupRoutes())
+			defer server.Close()
+
+			for _, tt := range tests {
+				t.Run(fmt.Sprintf("%s with base path '%s' and host emulation %t", tt.name, basePath, h != nil), func(t *testing.T) {
+					resp, err := http.Get(server.URL + basePath + tt.path)
+					assert.NoError(t, err)
+					defer resp.Body.Close()
+
+					assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+					if tt.expectedBody != "" {
+						body, err := io.ReadAll(resp.Body)
+						assert.NoError(t, err)
+						assert.Equal(t, tt.expectedBody, string(body))
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestSiteServerWithHeaders(t *testing.T) {
+	testPages := &[]model.Page{
+		{
+			Path: "/index.html",
+			Handler: func(w io.Writer) {
+				w.Write([]byte("<h1>Index Page</h1>"))
+			},
+		},
+	}
+	headers := func(pagePath string, contents []byte) http.Header {
+		return http.Header{"X-Page": []string{fmt.Sprintf("%s %d", pagePath, len(contents))}}
+	}
+
+	tmpDistDir := t.TempDir()
+	err := os.WriteFile(tmpDistDir+"/index.html", []byte("<h1>Index Page</h1>"), 0644)
+	assert.NoError(t, err)
+
+	netlify, err := host.Lookup("netlify")
+	assert.NoError(t, err)
+
+	for _, h := range []*host.Host{nil, netlify} {
+		c := serve.Config{
+			Public:     os.DirFS(t.TempDir()),
+			Pages:      testPages,
+			SiteDomain: "test.com",
+			Host:       h,
+			Headers:    headers,
+		}
+		servers := map[string]serve.SiteServer{
+			"dev":     serve.New(c),
+			"preview": serve.NewPreview(serve.PreviewConfig{Config: c, DistDir: tmpDistDir}),
+		}
+		for name, s := range servers {
+			t.Run(fmt.Sprintf("Sends the headers of the page from the %s server with host emulation %t", name, h != nil), func(t *testing.T) {
+				server := httptest.NewServer(s.SetupRoutes())
+				defer server.Close()
+
+				resp, err := http.Get(server.URL + "/index.html")
+				assert.NoError(t, err)
+				defer resp.Body.Close()
+
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, "/index.html 19", resp.Header.Get("X-Page"))
+			})
+		}
+	}
+}
+
+func TestSiteServerWithCompress(t *testing.T) {
+	page := strings.Repeat("<p>Index Page</p>", 100)
+	testPages := &[]model.Page{
+		{
+			Path: "/index.html",
+			Handler: func(w io.Writer) {
+				w.Write([]byte(page))
+			},
+		},
+	}
+
+	tmpDistDir := t.TempDir()
+	err := os.WriteFile(tmpDistDir+"/index.html", []byte(page), 0644)
+	assert.NoError(t, err)
+	c := compress.Config{Encodings: []compress.Encoding{compress.Gzip()}, MinSize: 100, Extensions: compress.DefaultExtensions}
+	_, err = compress.WriteDir(tmpDistDir, c)
+	assert.NoError(t, err)
+
+	netlify, err := host.Lookup("netlify")
+	assert.NoError(t, err)
+
+	for _, h := range []*host.Host{nil, netlify} {
+		sc := serve.Config{
+			Public:     os.DirFS(t.TempDir()),
+			Pages:      testPages,
+			SiteDomain: "test.com",
+			Host:       h,
+			Compress:   &c,
+		}
+		servers := map[string]serve.SiteServer{
+			"dev":     serve.New(sc),
+			"preview": serve.NewPreview(serve.PreviewConfig{Config: sc, DistDir: tmpDistDir}),
+		}
+		for name, s := range servers {
+			server := httptest.NewServer(s.SetupRoutes())
+			defer server.Close()
+
+			for _, accept := range []string{"gzip, deflate", "identity"} {
+				t.Run(fmt.Sprintf("Negotiates '%s' from the %s server with host emulation %t", accept, name, h != nil), func(t *testing.T) {
+					req, err := http.NewRequest(http.MethodGet, server.URL+"/", nil)
+					assert.NoError(t, err)
+					req.Header.Set("Accept-Encoding", accept)
+					resp, err := http.DefaultClient.Do(req)
+					assert.NoError(t, err)
+					defer resp.Body.Close()
+
+					assert.Equal(t, http.StatusOK, resp.StatusCode)
+					assert.Equal(t, "Accept-Encoding", resp.Header.Get("Vary"))
+					assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+					body, err := io.ReadAll(resp.Body)
+					assert.NoError(t, err)
+					if accept == "identity" {
+						assert.Equal(t, "", resp.Header.Get("Content-Encoding"))
+						assert.Equal(t, page, string(body))
+						return
+					}
+
+					assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+					r, err := gzip.NewReader(bytes.NewReader(body))
+					assert.NoError(t, err)
+					decompressed, err := io.ReadAll(r)
+					assert.NoError(t, err)
+					assert.Equal(t, page, string(decompressed))
+				})
+			}
+		}
+	}
+}
+
+func TestSiteServerWithVariants(t *testing.T) {
+	publicDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(publicDir, "photos"), 0755))
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	f, err := os.Create(filepath.Join(publicDir, "photos", "cat.png"))
+	assert.NoError(t, err)
+	assert.NoError(t, png.Encode(f, img))
+	f.Close()
+	variants := images.NewVariants(os.DirFS(publicDir), images.VariantConfig{Dirs: []string{"/photos"}, Widths: []int{10, 80}})
+
+	netlify, err := host.Lookup("netlify")
+	assert.NoError(t, err)
+
+	for _, h := range []*host.Host{nil, netlify} {
+		sc := serve.Config{
+			Public:     os.DirFS(publicDir),
+			Pages:      &[]model.Page{},
+			SiteDomain: "test.com",
+			BasePath:   "/base",
+			Host:       h,
+			Variants:   variants,
+		}
+		server := httptest.NewServer(serve.New(sc).SetupRoutes())
+		defer server.Close()
+
+		tests := []struct {
+			path   string
+			status int
+		}{
+			{path: "/base/photos/cat-10w.png", status: http.StatusOK},
+			{path: "/base/photos/cat-80w.png", status: http.StatusNotFound},
+			{path: "/base/photos/cat.png", status: http.StatusOK},
+		}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("Serves %s with status %d with host emulation %t", tt.path, tt.status, h != nil), func(t *testing.T) {
+				resp, err := http.Get(server.URL + tt.path)
+				assert.NoError(t, err)
+				defer resp.Body.Close()
+				assert.Equal(t, tt.status, resp.StatusCode)
+				if tt.path == "/base/photos/cat-10w.png" {
+					config, err := png.DecodeConfig(resp.Body)
+					assert.NoError(t, err)
+					assert.Equal(t, 10, config.Width)
+					assert.Equal(t, 5, config.Height)
+				}
+			})
+		}
+	}
+}
+
+func TestSiteServerWithFS(t *testing.T) {
+	public := fstest.MapFS{
+		"robots.txt":             {Data: []byte("User-agent: *")},
+		"img/icons/nested/a.svg": {Data: []byte("<svg></svg>")},
+		"docs/index.html":        {Data: []byte("<h1>Docs</h1>")},
+	}
+	testPages := &[]model.Page{
+		{
+			Path: "/index.html",
+			Handler: func(w io.Writer) {
+				w.Write([]byte("<h1>Index Page</h1>"))
+			},
+		},
+	}
+
+	netlify, err := host.Lookup("netlify")
+	assert.NoError(t, err)
+
+	for _, h := range []*host.Host{nil, netlify} {
+		sc := serve.Config{
+			Public:     public,
+			Pages:      testPages,
+			SiteDomain: "test.com",
+			Host:       h,
+		}
+		server := httptest.NewServer(serve.New(sc).SetupRoutes())
+		defer server.Close()
+
+		tests := []struct {
+			path           string
+			expectedStatus int
+			expectedBody   string
+		}{
+			{path: "/robots.txt", expectedStatus: http.StatusOK, expectedBody: "User-agent: *"},
+			{path: "/img/icons/nested/a.svg", expectedStatus: http.StatusOK, expectedBody: "<svg></svg>"},
+			{path: "/docs/", expectedStatus: http.StatusOK, expectedBody: "<h1>Docs</h1>"},
+			{path: "/img/icons/missing.svg", expectedStatus: http.StatusNotFound, expectedBody: "404: Not Found"},
+			{path: "/robots.txt/nested", expectedStatus: http.StatusNotFound, expectedBody: "404: Not Found"},
+			{path: "/../robots.txt", expectedStatus: http.StatusOK, expectedBody: "User-agent: *"},
+		}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("Serves %s with status %d with host emulation %t", tt.path, tt.expectedStatus, h != nil), func(t *testing.T) {
+				resp, err := http.Get(server.URL + tt.path)
+				assert.NoError(t, err)
+				defer resp.Body.Close()
+				assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+				body, err := io.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				assert.Contains(t, string(body), tt.expectedBody)
+			})
+		}
+	}
+}
+
+func TestSiteServerWithIgnoredFiles(t *testing.T) {
+	matcher, err := ignore.New(".DS_Store", "*.psd", "src/")
+	assert.NoError(t, err)
+	public := ignore.NewFS(fstest.MapFS{
+		"robots.txt":        {Data: []byte("User-agent: *")},
+		".DS_Store":         {Data: []byte("finder")},
+		"img/logo.psd":      {Data: []byte("psd")},
+		"img/src/draft.png": {Data: []byte("draft")},
+	}, matcher)
+	sc := serve.Config{
+		Public:     public,
+		Pages:      &[]model.Page{},
+		SiteDomain: "test.com",
+	}
+	server := httptest.NewServer(serve.New(sc).SetupRoutes())
+	defer server.Close()
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{path: "/robots.txt", expectedStatus: http.StatusOK},
+		{path: "/.DS_Store", expectedStatus: http.StatusNotFound},
+		{path: "/img/logo.psd", expectedStatus: http.StatusNotFound},
+		{path: "/img/src/draft.png", expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("Serves %s with status %d", tt.path, tt.expectedStatus), func(t *testing.T) {
+			resp, err := http.Get(server.URL + tt.path)
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package verify
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/man-on-box/litepage/internal/asset"
+	"github.com/man-on-box/litepage/internal/build"
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/images"
+	"github.com/man-on-box/litepage/internal/model"
+	"github.com/man-on-box/litepage/internal/serve"
+)
+
+// SiteVerifier builds a site and serves it with the same transforms, and
+// compares the two, so it finds pages and public files that render differently
+// each time rather than the differences between the dev server and a build.
+type SiteVerifier interface {
+	Verify() (Report, error)
+}
+
+type Config struct {
+	// Public holds the public files served and copied along with the pages.
+	Public fs.FS
+	// Copy configures how public files are copied when building.
+	Copy        file.CopyOptions
+	Pages       *[]model.Page
+	SiteDomain  string
+	BasePath    string
+	WithSitemap bool
+	Transforms  []model.Transform
+	Assets      *asset.Fingerprinter
+	// AssetTransforms are applied to public files both when building and serving.
+	AssetTransforms []model.Transform
+	// AssetExtensions are the extensions of the public files the asset transforms handle when building.
+	AssetExtensions []string
+	// Variants, if set, are written when building and generated on request when serving.
+	Variants *images.Variants
+}
+
+// Difference is a file that the dev server does not serve exactly as it was built.
+type Difference struct {
+	Path         string
+	Status       int
+	ServedSize   int
+	BuiltSize    int
+	Missing      bool
+	DiffersAtPos int
+}
+
+func (d Difference) String() string {
+	switch {
+	case d.Missing:
+		return fmt.Sprintf("%s: served with status %d, but was not built", d.Path, d.Status)
+	case d.Status != http.StatusOK:
+		return fmt.Sprintf("%s: served with status %d, but was built", d.Path, d.Status)
+	default:
+		return fmt.Sprintf("%s: content differs at byte %d (served %d bytes, built %d bytes)", d.Path, d.DiffersAtPos, d.ServedSize, d.BuiltSize)
+	}
+}
+
+type Report struct {
+	Checked     int
+	Differences []Difference
+}
+
+type siteVerifier struct {
+	Config Config
+}
+
+func New(config Config) SiteVerifier {
+	v := &siteVerifier{
+		Config: config,
+	}
+	return v
+}
+
+// Verify builds the site into a temporary directory, then requests every page
+// and public file from the dev server and compares it with the built file.
+func (v *siteVerifier) Verify() (Report, error) {
+	report := Report{}
+
+	distDir, err := os.MkdirTemp("", "litepage-verify")
+	if err != nil {
+		return report, fmt.Errorf("could not create temporary dist directory: %w", err)
+	}
+	defer os.RemoveAll(distDir)
+
+	bc := build.Config{
+		DistDir:         distDir,
+		Public:          v.Config.Public,
+		Copy:            v.Config.Copy,
+		Pages:           v.Config.Pages,
+		SiteDomain:      v.Config.SiteDomain,
+		BasePath:        v.Config.BasePath,
+		WithSitemap:     v.Config.WithSitemap,
+		Transforms:      v.Config.Transforms,
+		Assets:          v.Config.Assets,
+		AssetTransforms: v.Config.AssetTransforms,
+		AssetExtensions: v.Config.AssetExtensions,
+		Variants:        v.Config.Variants,
+	}
+	if err := build.New(bc).Build(); err != nil {
+		return report, err
+	}
+
+	sc := serve.Config{
+		Public:          v.Config.Public,
+		Pages:           v.Config.Pages,
+		SiteDomain:      v.Config.SiteDomain,
+		BasePath:        v.Config.BasePath,
+		WithSitemap:     v.Config.WithSitemap,
+		Transforms:      v.Config.Transforms,
+		Assets:          v.Config.Assets,
+		AssetTransforms: v.Config.AssetTransforms,
+		Variants:        v.Config.Variants,
+	}
+	handler := serve.New(sc).SetupRoutes()
+
+	paths, err := v.paths()
+	if err != nil {
+		return report, err
+	}
+
+	for _, p := range paths {
+		report.Checked++
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, v.Config.BasePath+p, nil))
+		served := rec.Body.Bytes()
+
+		built, err := os.ReadFile(filepath.Join(distDir, filepath.FromSlash(p)))
+		if err != nil {
+			report.Differences = append(report.Differences, Difference{Path: p, Status: rec.Code, Missing: true})
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			report.Differences = append(report.Differences, Difference{Path: p, Status: rec.Code})
+			continue
+		}
+		if !bytes.Equal(served, built) {
+			report.Differences = append(report.Differences, Difference{
+				Path:         p,
+				Status:       rec.Code,
+				ServedSize:   len(served),
+				BuiltSize:    len(built),
+				DiffersAtPos: firstDifference(served, built),
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// paths returns the path of every page, followed by every public file that is
+// not overwritten by a page.
+func (v *siteVerifier) paths() ([]string, error) {
+	var paths []string
+	pages := map[string]bool{}
+	for _, p := range *v.Config.Pages {
+		paths = append(paths, p.Path)
+		pages[p.Path] = true
+	}
+	if v.Config.WithSitemap {
+		paths = append(paths, "/sitemap.xml")
+		pages["/sitemap.xml"] = true
+	}
+
+	err := file.WalkFiles(v.Config.Public, func(p string) error {
+		if !pages[p] {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read public directory: %w", err)
+	}
+
+	if v.Config.Variants != nil {
+		variants, err := v.Config.Variants.Paths()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, variants...)
+	}
+
+	if v.Config.Assets != nil {
+		manifest, err := v.Config.Assets.Manifest()
+		if err != nil {
+			return nil, err
+		}
+		var hashed []string
+		for _, p := range manifest {
+			hashed = append(hashed, p)
+		}
+		sort.Strings(hashed)
+		paths = append(paths, hashed...)
+		paths = append(paths, asset.ManifestPath)
+	}
+	return paths, nil
+}
+
+func firstDifference(a []byte, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return min(len(a), len(b))
+}
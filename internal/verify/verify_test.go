@@ -0,0 +1,61 @@
+package verify_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/man-on-box/litepage/internal/model"
+	"github.com/man-on-box/litepage/internal/verify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSiteVerifier(t *testing.T) {
+	renders := 0
+	testPages := &[]model.Page{
+		{
+			Path: "/index.html",
+			Handler: func(w io.Writer) {
+				w.Write([]byte("<h1>Index Page</h1>"))
+			},
+		},
+		{
+			Path: "/nested/counter.html",
+			Handler: func(w io.Writer) {
+				renders++
+				w.Write([]byte(fmt.Sprintf("<h1>Rendered %d times</h1>", renders)))
+			},
+		},
+	}
+
+	tmpPublicDir, err := os.MkdirTemp("", "public")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpPublicDir)
+
+	err = os.WriteFile(tmpPublicDir+"/testfile.txt", []byte("Hello from static text file"), 0644)
+	assert.NoError(t, err)
+
+	for _, basePath := range []string{"", "/test"} {
+		t.Run(fmt.Sprintf("Reports pages that differ with base path '%s'", basePath), func(t *testing.T) {
+			c := verify.Config{
+				Public:      os.DirFS(tmpPublicDir),
+				Pages:       testPages,
+				SiteDomain:  "test.com",
+				BasePath:    basePath,
+				WithSitemap: true,
+			}
+			report, err := verify.New(c).Verify()
+			assert.NoError(t, err)
+
+			assert.Equal(t, 4, report.Checked)
+			assert.Len(t, report.Differences, 1)
+			d := report.Differences[0]
+			assert.Equal(t, "/nested/counter.html", d.Path)
+			assert.Equal(t, http.StatusOK, d.Status)
+			assert.Equal(t, len("<h1>Rendered "), d.DiffersAtPos)
+			assert.Contains(t, d.String(), "content differs at byte 13")
+		})
+	}
+}
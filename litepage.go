@@ -7,7 +7,8 @@
 //
 // You can then use Build() to build the static site into your
 // dist directory, or Serve() to host the site locally, useful
-// for local development.
+// for local development. Preview() builds the site and hosts the
+// dist directory, to check what will be deployed.
 //
 // For convenience, you can use BuildOrServe() method to either
 // build or serve, depending on environment variables. This allows
@@ -15,14 +16,39 @@
 package litepage
 
 import (
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/man-on-box/litepage/internal/asset"
 	"github.com/man-on-box/litepage/internal/build"
+	"github.com/man-on-box/litepage/internal/bundle"
+	"github.com/man-on-box/litepage/internal/compress"
+	"github.com/man-on-box/litepage/internal/csp"
+	"github.com/man-on-box/litepage/internal/file"
+	"github.com/man-on-box/litepage/internal/host"
+	"github.com/man-on-box/litepage/internal/ignore"
+	"github.com/man-on-box/litepage/internal/images"
+	"github.com/man-on-box/litepage/internal/importmap"
+	"github.com/man-on-box/litepage/internal/links"
+	"github.com/man-on-box/litepage/internal/lint"
+	"github.com/man-on-box/litepage/internal/minify"
 	"github.com/man-on-box/litepage/internal/model"
+	"github.com/man-on-box/litepage/internal/overlay"
+	"github.com/man-on-box/litepage/internal/pipeline"
+	"github.com/man-on-box/litepage/internal/reload"
+	"github.com/man-on-box/litepage/internal/rewrite"
 	"github.com/man-on-box/litepage/internal/serve"
 	"github.com/man-on-box/litepage/internal/validate"
+	"github.com/man-on-box/litepage/internal/verify"
 )
 
 type Litepage interface {
@@ -33,9 +59,21 @@ type Litepage interface {
 	// Serve hosts the static site on the specified port, instead of
 	// writing the site to the dist directory. Use this for local development.
 	Serve(port string) error
+	// Preview builds the static site, then hosts the dist directory on the specified
+	// port. Use this to check the exact files that will be deployed.
+	Preview(port string) error
+	// Verify checks that the site is the same whether it is served or built. It builds the
+	// site to a temporary directory, then requests every page and public file from the dev
+	// server, and returns an error listing each file where the status or content differs.
+	// The dev server is configured as for building rather than as Serve configures it, so
+	// differences made on purpose when serving, such as leaving out minification or adding
+	// the live reload script, are not reported: Verify checks that pages and public files
+	// render the same every time, not what Serve adds to them.
+	Verify() error
 	// BuildOrServe by default will build the static site in the dist directory.
 	// If LP_MODE env variable is set to 'serve', it will instead serve the static site on port
-	// 3000, or on port specified if LP_PORT env variable was set.
+	// 3000, or on port specified if LP_PORT env variable was set. If it is set to 'preview',
+	// it will build the site and then serve the dist directory.
 	//
 	// This is useful for when you want to serve the site during development and
 	// build it for production without requiring changes to the code.
@@ -45,18 +83,205 @@ type Litepage interface {
 	// as well as the handler to render the page contents to the standard writer
 	// interface.
 	Page(filePath string, handler func(w io.Writer)) error
+	// Asset returns the URL of the public file at the file path, including the base path.
+	// If fingerprinting is enabled, the URL is the fingerprinted name of the file, such as
+	// "/styles.3f2a9c1b.css" for "/styles.css".
+	Asset(filePath string) (string, error)
+	// TemplateFuncs returns functions to use in your templates, 'asset' which calls Asset,
+	// 'integrity' which calls Integrity, 'importmap' which calls ImportMap, 'imagesize' which
+	// calls ImageSize and 'srcset' which calls Srcset. Add them with template.Funcs, from either html/template or text/template.
+	TemplateFuncs() map[string]any
+	// Integrity returns the Subresource Integrity digest of the public file at the file path,
+	// such as "sha384-oqVuAfXR...", to render in the integrity attribute of script and link tags.
+	Integrity(filePath string) (string, error)
+	// ImportMap returns the script tag declaring the import map of the ES modules in the module
+	// directory set with WithImportMap, to render in the head of your pages before any module
+	// script. URLs include the base path, and are fingerprinted if fingerprinting is enabled.
+	ImportMap() (string, error)
+	// ImageSize returns the width and height in pixels of the public image at the file path, read
+	// from its header. PNG, JPEG, GIF and SVG images are supported.
+	ImageSize(filePath string) (ImageSize, error)
+	// Srcset returns the srcset attribute listing the resized variants of the public image at the
+	// file path along with the image itself, set up with WithImageVariants, and the sizes attribute
+	// if sizes is not empty, such as `srcset="/photos/cat-480w.jpg 480w, /photos/cat.jpg 1600w"
+	// sizes="(min-width: 960px) 50vw, 100vw"`, to render in img tags.
+	Srcset(filePath string, sizes string) (string, error)
+}
+
+// ImageSize is the intrinsic width and height of an image, in pixels.
+type ImageSize struct {
+	Width  int
+	Height int
 }
 
 type Option func(*litepage) error
 
+// Severity sets whether problems found in the site are only reported, or fail the build.
+type Severity int
+
+const (
+	// Warn reports problems found in the site, without failing the build.
+	Warn Severity = iota
+	// Fail reports problems found in the site, and fails the build if there are any.
+	Fail
+)
+
+// Symlinks sets how symbolic links in the public directory are copied when building.
+type Symlinks int
+
+const (
+	// FollowSymlinks copies the files and directories symbolic links point to, as the dev server
+	// serves them.
+	FollowSymlinks Symlinks = iota
+	// CopySymlinks copies symbolic links as links with the same destination.
+	CopySymlinks
+	// RejectSymlinks fails the build at every symbolic link, listing them.
+	RejectSymlinks
+)
+
+// ExternalLinkCheck configures how links to other sites are checked. Zero values use
+// the defaults described on each field.
+type ExternalLinkCheck struct {
+	// Severity sets whether broken external links fail the build, by default they are only reported.
+	Severity Severity
+	// Concurrency is the number of links checked at the same time. Default is 8.
+	Concurrency int
+	// Timeout is the time allowed for each request. Default is 10 seconds.
+	Timeout time.Duration
+	// HostInterval is the minimum time between two requests to the same host. Default is 500ms.
+	HostInterval time.Duration
+	// CacheFile is where links that resolved are remembered, so they are only checked again
+	// once CacheTTL has passed. Default is a file in the user cache directory.
+	CacheFile string
+	// CacheTTL is how long a link that resolved is not checked again. Default is 24 hours.
+	CacheTTL time.Duration
+	// StandIns maps hosts to the base URL of a server to send their requests to instead,
+	// for example {"example.com": "http://localhost:8080"} to check links against a local server.
+	// A path of the base URL is kept, so "http://localhost:8080/mock" receives "/mock/page".
+	StandIns map[string]string
+}
+
+// CSP configures the Content-Security-Policy of pages. The hashes of the inline scripts and
+// styles of each page are added to the policy, so that they run without 'unsafe-inline'.
+type CSP struct {
+	// Policy is the policy the hashes are added to. Default is "default-src 'self'".
+	Policy string
+	// Headers writes the policy of each page to the '_headers' file of the built site,
+	// supported by Netlify and Cloudflare Pages, rather than to a meta tag in the page.
+	Headers bool
+}
+
+// MinifyHTML configures the minification of pages.
+type MinifyHTML struct {
+	// SkipServe leaves pages as they are rendered when serving, to keep them readable while
+	// developing. They are still minified when building.
+	SkipServe bool
+}
+
+// Encoding is a Content-Encoding that files can be compressed with, such as gzip or brotli.
+type Encoding struct {
+	// Name is the value of the Content-Encoding header, such as "br".
+	Name string
+	// Extension is added to the name of compressed copies, such as ".br".
+	Extension string
+	// NewWriter returns a writer compressing what is written to w.
+	NewWriter func(w io.Writer) io.WriteCloser
+}
+
+// Gzip compresses files with gzip from the standard library, at the best compression level.
+func Gzip() Encoding {
+	return Encoding(compress.Gzip())
+}
+
+// Precompress configures the compressed copies written next to the files of the built site.
+// Zero values use the defaults described on each field.
+type Precompress struct {
+	// Encodings are the encodings files are compressed with, in order of preference when a
+	// browser accepts several. Default is Gzip.
+	Encodings []Encoding
+	// MinSize is the size in bytes below which files are not compressed. Default is 1024.
+	MinSize int
+	// Extensions are the extensions of files that are compressed. Default is text files such
+	// as ".html", ".css", ".js", ".json", ".xml" and ".svg".
+	Extensions []string
+}
+
+// Command is an external command run alongside litepage, such as Tailwind or esbuild. Commands
+// should write their output to the public directory, where litepage picks it up.
+type Command struct {
+	// Name prefixes each line of the output of the command in the log. Default is the program name.
+	Name string
+	// Build is the command run before building, such as
+	// {"npx", "@tailwindcss/cli", "-i", "styles/main.css", "-o", "public/styles.css", "--minify"}.
+	// Leave it empty to not run the command when building.
+	Build []string
+	// Watch is the command run in watch mode while serving, such as
+	// {"npx", "@tailwindcss/cli", "-i", "styles/main.css", "-o", "public/styles.css", "--watch"}.
+	// Leave it empty to not run the command when serving.
+	Watch []string
+	// Dir is the working directory of the command. Default is the current directory.
+	Dir string
+}
+
+// ImageVariants configures the resized variants of the JPEG and PNG images of your public directory.
+type ImageVariants struct {
+	// Dirs are the directories of the public directory whose images get variants, such as "/photos".
+	Dirs []string
+	// Widths are the widths in pixels of the variants of each image, such as {480, 960, 1440}.
+	// Images only get the variants narrower than themselves.
+	Widths []int
+	// Quality is the quality JPEG variants are encoded with, from 1 to 100. Default is 80.
+	Quality int
+	// CacheDir is where variants are kept between builds, so images are only resized again when
+	// they change. Default is a directory in the user cache directory.
+	CacheDir string
+}
+
+type crawlConfig struct {
+	severity   Severity
+	entryPages []string
+}
+
 type litepage struct {
-	siteDomain  string
-	distDir     string
-	publicDir   string
-	basePath    string
-	withSitemap bool
-	pages       *[]model.Page
-	pathMap     map[string]bool
+	siteDomain     string
+	distDir        string
+	publicDir      string
+	public         fs.FS
+	publicLayers   []overlay.Layer
+	overlay        *overlay.FS
+	ignorePatterns []string
+	ignore         *ignore.Matcher
+	copy           file.CopyOptions
+	basePath       string
+	withSitemap    bool
+	host           *host.Host
+	crawl          *crawlConfig
+	linkCheck      bool
+	extLinks       *ExternalLinkCheck
+	rewriteBase    bool
+	baseLint       *Severity
+	assetExts      []string
+	assets         *asset.Fingerprinter
+	integrity      *asset.Integrity
+	serveIntegrity *asset.Integrity
+	serving        bool
+	injectSRI      bool
+	csp            *CSP
+	minifyHTML     *MinifyHTML
+	minifyAssets   bool
+	precompress    *compress.Config
+	cssEntries     []string
+	moduleDir      string
+	pipeline       []Command
+	imageSizes     *images.Sizes
+	injectSizes    bool
+	variantConfig  *images.VariantConfig
+	variants       *images.Variants
+	stripper       *images.Stripper
+	modules        *importmap.Modules
+	bundler        *bundle.Bundler
+	pages          *[]model.Page
+	pathMap        map[string]bool
 }
 
 // New creates a new Litepage instance with the specified domain and optional configurations.
@@ -85,6 +310,42 @@ func New(domain string, options ...Option) (Litepage, error) {
 			return nil, err
 		}
 	}
+	if lp.csp != nil && lp.csp.Headers && lp.basePath != "" {
+		// hosts match the rules of '_headers' against the deployed URL, which would need the
+		// base path, while the rules of the public '_headers' file are written without it
+		return nil, fmt.Errorf("content security policy headers cannot be used with a base path, use the meta tag instead")
+	}
+	switch {
+	case len(lp.publicLayers) == 1:
+		lp.public = lp.publicLayers[0].FS
+	case len(lp.publicLayers) > 1:
+		lp.overlay = overlay.New(lp.publicLayers...)
+		lp.public = lp.overlay
+	default:
+		lp.public = file.DirFS(lp.publicDir)
+	}
+	if err := lp.ignoreFiles(); err != nil {
+		return nil, err
+	}
+	var deps model.Deps
+	if lp.cssEntries != nil {
+		lp.bundler = bundle.New(lp.public, lp.basePath, lp.cssEntries)
+		deps = lp.bundler.Deps
+	}
+	if lp.assetExts != nil {
+		// files are named after the contents they are built with, so bundles change
+		// name when an import changes, and minified files after the bytes deployed
+		lp.assets = asset.NewFingerprinter(lp.public, lp.assetExts, lp.assetTransforms(false), deps)
+	}
+	if lp.moduleDir != "" {
+		lp.modules = &importmap.Modules{Public: lp.public, Dir: lp.moduleDir, BasePath: lp.basePath, URL: lp.Asset}
+	}
+	lp.imageSizes = images.NewSizes(lp.public)
+	if lp.variantConfig != nil {
+		lp.variants = images.NewVariants(lp.public, *lp.variantConfig)
+	}
+	lp.integrity = asset.NewIntegrity(lp.public, lp.assetTransforms(false), deps)
+	lp.serveIntegrity = asset.NewIntegrity(lp.public, lp.assetTransforms(true), deps)
 
 	return lp, nil
 }
@@ -105,6 +366,83 @@ func WithPublicDir(publicDir string) Option {
 	}
 }
 
+// Read the public files of your site from a file system rather than a directory on disk, such as
+// an embed.FS, so a single binary can build or serve the site with its assets. Use fs.Sub to serve
+// a subdirectory of it, such as "public" for files embedded with //go:embed public. Several file
+// systems are merged as layers, like WithPublicDirs. It takes precedence over WithPublicDir.
+func WithPublicFS(layers ...fs.FS) Option {
+	return func(lp *litepage) error {
+		if len(layers) == 0 {
+			return fmt.Errorf("public file system is required")
+		}
+		for _, fsys := range layers {
+			if fsys == nil {
+				return fmt.Errorf("public file system must not be nil")
+			}
+			lp.publicLayers = append(lp.publicLayers, overlay.Layer{Name: fmt.Sprintf("file system %d", len(lp.publicLayers)+1), FS: fsys})
+		}
+		return nil
+	}
+}
+
+// Merge several public directories as layers, such as a directory shared by several sites and one
+// specific to this site. Files of later directories override the files at the same path in earlier
+// ones, both when building and serving, and the directories of every layer are merged. Overridden
+// files are listed when building. Layers added with WithPublicFS are merged in the order of the
+// options. It takes precedence over WithPublicDir.
+func WithPublicDirs(dirs ...string) Option {
+	return func(lp *litepage) error {
+		if len(dirs) == 0 {
+			return fmt.Errorf("public directories need at least one directory, like 'public'")
+		}
+		for _, dir := range dirs {
+			if dir == "" {
+				return fmt.Errorf("public directory must not be empty")
+			}
+			lp.publicLayers = append(lp.publicLayers, overlay.Layer{Name: dir, FS: file.DirFS(dir)})
+		}
+		return nil
+	}
+}
+
+// Leave out the public files matching gitignore style patterns, such as ".DS_Store", "*.psd" or
+// "src/", so they are neither copied when building nor served by the dev server. Patterns can also
+// be listed in a .litepageignore file at the root of the public directory, which is read when the
+// site is created, so restart the dev server after changing it. Its patterns come after these ones.
+func WithIgnore(patterns ...string) Option {
+	return func(lp *litepage) error {
+		lp.ignorePatterns = append(lp.ignorePatterns, patterns...)
+		return nil
+	}
+}
+
+// Set how symbolic links in the public directory are copied when building. By default the files and
+// directories they point to are copied, and links leading back to one of their parent directories
+// fail the build. Copied links keep their destination, so relative links should point within the
+// public directory.
+func WithSymlinks(policy Symlinks) Option {
+	return func(lp *litepage) error {
+		switch policy {
+		case FollowSymlinks, CopySymlinks, RejectSymlinks:
+		default:
+			return fmt.Errorf("symlink policy must be FollowSymlinks, CopySymlinks or RejectSymlinks")
+		}
+		lp.copy.Symlinks = file.SymlinkPolicy(policy)
+		return nil
+	}
+}
+
+// Hard link the public files to the dist directory instead of copying them when building, which
+// is faster and saves space for large files like videos. Files are copied when the public and dist
+// directories are not on the same file system, or the public files are not on disk. Files written
+// by the build, such as processed assets, replace their link rather than changing the public file.
+func WithHardLinks() Option {
+	return func(lp *litepage) error {
+		lp.copy.HardLinks = true
+		return nil
+	}
+}
+
 // By default a sitemap.xml is created mapping all pages of the static site. You can disable this
 // behavior by specifying without a sitemap.
 func WithoutSitemap() Option {
@@ -125,6 +463,334 @@ func WithBasePath(basePath string) Option {
 	}
 }
 
+// Emulate the routing rules of the host you deploy to when serving or previewing your site, so that
+// pages that work locally also work in production. Supported hosts are "github-pages",
+// "cloudflare-pages" and "netlify". By default the dev server is lenient, and resolves
+// paths that your host might not.
+func WithHostEmulation(hostName string) Option {
+	return func(lp *litepage) error {
+		h, err := host.Lookup(hostName)
+		if err != nil {
+			return fmt.Errorf("cannot emulate host: %w", err)
+		}
+		lp.host = h
+		return nil
+	}
+}
+
+// Crawl the site when building, starting from the entry pages (by default "/index.html")
+// and following their links, to find links that resolve to neither a registered page nor a
+// public file. Registered html pages that are not linked from any crawled page are also
+// reported, apart from 404 pages. Use the severity to choose whether broken links fail
+// the build. Unreachable pages are only reported and never fail it.
+func WithCrawl(severity Severity, entryPages ...string) Option {
+	return func(lp *litepage) error {
+		if len(entryPages) == 0 {
+			entryPages = []string{"/index.html"}
+		}
+		for _, p := range entryPages {
+			if err := validate.IsValidFilePath(p); err != nil {
+				return fmt.Errorf("crawl entry page is not valid '%s': %w", p, err)
+			}
+		}
+		lp.crawl = &crawlConfig{severity: severity, entryPages: entryPages}
+		return nil
+	}
+}
+
+// Check the links of every page once the site is built, and fail the build if any of them
+// do not resolve. Relative and root-relative links are resolved against the base path, and
+// links to a '#fragment' must match the id of an element on the linked page.
+func WithLinkCheck() Option {
+	return func(lp *litepage) error {
+		lp.linkCheck = true
+		return nil
+	}
+}
+
+// Check the links to other sites from every page once the site is built, and report the
+// ones that cannot be reached. Links that resolved are cached on disk, so that building
+// again does not request them until the cache expires.
+func WithExternalLinkCheck(config ExternalLinkCheck) Option {
+	return func(lp *litepage) error {
+		switch {
+		case config.Concurrency < 0:
+			return fmt.Errorf("external link check concurrency must not be negative, got %d", config.Concurrency)
+		case config.Timeout < 0:
+			return fmt.Errorf("external link check timeout must not be negative, got %s", config.Timeout)
+		case config.HostInterval < 0:
+			return fmt.Errorf("external link check host interval must not be negative, got %s", config.HostInterval)
+		case config.CacheTTL < 0:
+			return fmt.Errorf("external link check cache TTL must not be negative, got %s", config.CacheTTL)
+		}
+		if config.Concurrency == 0 {
+			config.Concurrency = 8
+		}
+		if config.Timeout == 0 {
+			config.Timeout = 10 * time.Second
+		}
+		if config.HostInterval == 0 {
+			config.HostInterval = 500 * time.Millisecond
+		}
+		if config.CacheTTL == 0 {
+			config.CacheTTL = 24 * time.Hour
+		}
+		if config.CacheFile == "" {
+			cacheDir, err := os.UserCacheDir()
+			if err != nil {
+				return fmt.Errorf("could not find cache directory for external links, please set a cache file: %w", err)
+			}
+			config.CacheFile = filepath.Join(cacheDir, "litepage", lp.siteDomain, "external-links.json")
+		}
+		for h, standIn := range config.StandIns {
+			u, err := url.Parse(standIn)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("stand-in for '%s' must be an absolute URL like 'http://localhost:8080', got '%s'", h, standIn)
+			}
+		}
+		lp.extLinks = &config
+		return nil
+	}
+}
+
+// Rewrite root-relative URLs of your pages to start with the base path, so that templates
+// can link to "/styles.css" and work wherever the site is deployed. The href, src, srcset,
+// action and other URL attributes are rewritten, as well as url() in inline CSS. URLs that
+// already start with the base path are left as they are.
+func WithBasePathRewrite() Option {
+	return func(lp *litepage) error {
+		lp.rewriteBase = true
+		return nil
+	}
+}
+
+// Lint the built pages and stylesheets for root-relative URLs that do not start with the
+// base path, which would point outside of the site once deployed. Use the severity to choose
+// whether they fail the build. Does nothing if no base path is set.
+func WithBasePathLint(severity Severity) Option {
+	return func(lp *litepage) error {
+		lp.baseLint = &severity
+		return nil
+	}
+}
+
+// Fingerprint public files with the extensions (by default ".css" and ".js") when building,
+// by copying them to a name with a hash of their contents, such as "/styles.3f2a9c1b.css",
+// so that browsers can cache them forever. A manifest mapping each file to its fingerprinted
+// name is written to "/asset-manifest.json". Use Asset or the 'asset' template function to
+// link to the fingerprinted names, which the dev server also resolves.
+func WithFingerprint(extensions ...string) Option {
+	return func(lp *litepage) error {
+		if len(extensions) == 0 {
+			extensions = []string{".css", ".js"}
+		}
+		for _, ext := range extensions {
+			if !strings.HasPrefix(ext, ".") || strings.Contains(ext, "/") {
+				return fmt.Errorf("fingerprint extension must start with a '.' like '.css', got '%s'", ext)
+			}
+		}
+		lp.assetExts = extensions
+		return nil
+	}
+}
+
+// Add an integrity attribute to the script and link tags of your pages that load a file from
+// your public directory, so browsers refuse it if its contents were tampered with. Tags that
+// already have an integrity attribute are left as they are. Use Integrity or the 'integrity'
+// template function to render the attribute yourself instead.
+func WithIntegrity() Option {
+	return func(lp *litepage) error {
+		lp.injectSRI = true
+		return nil
+	}
+}
+
+// Set a Content-Security-Policy on every page, allowing its inline scripts and styles by hash.
+// By default the policy is added to a meta tag at the start of the head of the page, set
+// Headers to write it to the '_headers' file of the built site instead, which cannot be
+// used with a base path. The dev server also sends the policy as a header, so that
+// violations show up in the browser console locally.
+func WithCSP(config CSP) Option {
+	return func(lp *litepage) error {
+		if config.Policy == "" {
+			config.Policy = csp.DefaultPolicy
+		}
+		lp.csp = &config
+		return nil
+	}
+}
+
+// Minify the html pages of your site, collapsing whitespace and removing comments and unneeded
+// quotes around attribute values. The text of pre and textarea elements, inline scripts and
+// styles, SVG and conditional comments are kept as they are.
+func WithMinifyHTML(config MinifyHTML) Option {
+	return func(lp *litepage) error {
+		lp.minifyHTML = &config
+		return nil
+	}
+}
+
+// Minify the .css and .js files of your public directory when building, removing comments and
+// whitespace without renaming or restructuring code. The savings are reported once the build is
+// done. The dev server keeps serving the original files, so they stay readable while developing.
+func WithMinifyAssets() Option {
+	return func(lp *litepage) error {
+		lp.minifyAssets = true
+		return nil
+	}
+}
+
+// Bundle the entry stylesheets (such as "/css/main.css"), inlining the files they import with
+// @import rules so that browsers load a single file. Relative url() references of imported
+// files are rewritten to be relative to the entry. The bundle replaces the entry when building,
+// and the dev server serves the same bundle, rebuilt on every request.
+func WithCSSBundle(entries ...string) Option {
+	return func(lp *litepage) error {
+		if len(entries) == 0 {
+			return fmt.Errorf("css bundle needs at least one entry stylesheet, like '/css/main.css'")
+		}
+		for _, entry := range entries {
+			if err := validate.IsValidFilePath(entry); err != nil || filepath.Ext(entry) != ".css" {
+				return fmt.Errorf("css bundle entry must be the path of a stylesheet like '/css/main.css', got '%s'", entry)
+			}
+		}
+		lp.cssEntries = entries
+		return nil
+	}
+}
+
+// Generate the import map of the ES modules in the module directory of your public directory (by
+// default "/js"), so modules can import each other by name, such as "components/card" for
+// "/js/components/card.js". Render it in your pages with ImportMap or the 'importmap' template
+// function. A modulepreload link is also added to each page for every module its module scripts
+// import, directly or not, so browsers fetch them all at once.
+func WithImportMap(dir string) Option {
+	return func(lp *litepage) error {
+		if dir == "" {
+			dir = "/js"
+		}
+		if err := validate.IsValidBasePath(dir); err != nil {
+			return fmt.Errorf("import map directory is not valid '%s': %w", dir, err)
+		}
+		lp.moduleDir = dir
+		return nil
+	}
+}
+
+// Run external commands, such as Tailwind or esbuild, as part of your site. Their Build commands
+// run one after the other before building, and fail the build if one exits with a non-zero status.
+// Their Watch commands run as child processes while serving, and pages reload in the browser
+// when the files of the public directory change, such as when a command writes its output.
+// The output of each command is prefixed with its name in the log.
+func WithPipeline(commands ...Command) Option {
+	return func(lp *litepage) error {
+		for _, c := range commands {
+			if len(c.Build) == 0 && len(c.Watch) == 0 {
+				return fmt.Errorf("pipeline command '%s' must have a Build or Watch command", c.Name)
+			}
+		}
+		lp.pipeline = append(lp.pipeline, commands...)
+		return nil
+	}
+}
+
+// Add the missing width and height attributes of the img tags of your pages that load an image
+// from your public directory, so browsers reserve their space before they load and the layout
+// does not shift. When only one of them is set, the other keeps the aspect ratio of the image.
+// PNG, JPEG, GIF and SVG images are supported, others are left as they are.
+func WithImageSize() Option {
+	return func(lp *litepage) error {
+		lp.injectSizes = true
+		return nil
+	}
+}
+
+// Generate resized variants of the JPEG and PNG images in the given directories of your public
+// directory, such as "/photos/cat-480w.jpg" for "/photos/cat.jpg", at each of the widths narrower
+// than the image. Variants are written next to the images when building, and kept in the cache
+// directory between builds so images are only resized again when they change. The dev server
+// generates them on request. Render them in your pages with Srcset or the 'srcset' template function.
+func WithImageVariants(config ImageVariants) Option {
+	return func(lp *litepage) error {
+		if len(config.Dirs) == 0 {
+			return fmt.Errorf("image variants need at least one directory, like '/photos'")
+		}
+		for _, dir := range config.Dirs {
+			if err := validate.IsValidBasePath(dir); err != nil {
+				return fmt.Errorf("image variants directory is not valid '%s': %w", dir, err)
+			}
+		}
+		if len(config.Widths) == 0 {
+			return fmt.Errorf("image variants need at least one width, like 480")
+		}
+		for _, w := range config.Widths {
+			if w <= 0 {
+				return fmt.Errorf("image variants width must be a positive number of pixels, got %d", w)
+			}
+		}
+		if config.Quality < 0 || config.Quality > 100 {
+			return fmt.Errorf("image variants quality must be from 1 to 100, got %d", config.Quality)
+		}
+		if config.CacheDir == "" {
+			cacheDir, err := os.UserCacheDir()
+			if err != nil {
+				return fmt.Errorf("could not find cache directory for image variants, please set a cache directory: %w", err)
+			}
+			config.CacheDir = filepath.Join(cacheDir, "litepage", "images")
+		}
+		lp.variantConfig = &images.VariantConfig{Dirs: config.Dirs, Widths: config.Widths, Quality: config.Quality, CacheDir: config.CacheDir}
+		return nil
+	}
+}
+
+// Remove the metadata of the JPEG and PNG images of your public directory, such as the GPS
+// coordinates and camera details of photos: the EXIF, XMP, IPTC and comment segments of JPEGs, and
+// the text and EXIF chunks of PNGs. Pixel data and color profiles are left untouched, and the
+// orientation of photos is kept. Images that contained GPS coordinates are listed when building.
+func WithStripMetadata() Option {
+	return func(lp *litepage) error {
+		lp.stripper = images.NewStripper()
+		return nil
+	}
+}
+
+// Write compressed copies of the pages and public files of your site next to them when building,
+// such as "/index.html.gz", for hosts that serve them to browsers that accept their encoding.
+// Other encodings can be added, for example brotli from a third party package. The dev server
+// compresses responses on the fly, and the preview server serves the copies from the dist
+// directory, both with the Content-Encoding and Vary headers.
+func WithPrecompress(config Precompress) Option {
+	return func(lp *litepage) error {
+		if len(config.Encodings) == 0 {
+			config.Encodings = []Encoding{Gzip()}
+		}
+		if config.MinSize == 0 {
+			config.MinSize = compress.DefaultMinSize
+		}
+		if len(config.Extensions) == 0 {
+			config.Extensions = compress.DefaultExtensions
+		}
+
+		c := &compress.Config{MinSize: config.MinSize, Extensions: config.Extensions}
+		for _, e := range config.Encodings {
+			if e.Name == "" || e.NewWriter == nil {
+				return fmt.Errorf("precompress encoding must have a name and a writer, got '%s'", e.Name)
+			}
+			if !strings.HasPrefix(e.Extension, ".") || strings.Contains(e.Extension, "/") {
+				return fmt.Errorf("precompress encoding extension must start with a '.' like '.gz', got '%s'", e.Extension)
+			}
+			c.Encodings = append(c.Encodings, compress.Encoding(e))
+		}
+		for _, ext := range config.Extensions {
+			if !strings.HasPrefix(ext, ".") || strings.Contains(ext, "/") {
+				return fmt.Errorf("precompress extension must start with a '.' like '.html', got '%s'", ext)
+			}
+		}
+		lp.precompress = c
+		return nil
+	}
+}
+
 func (lp *litepage) Page(filePath string, handler func(w io.Writer)) error {
 	err := validate.IsValidFilePath(filePath)
 	if err != nil {
@@ -143,38 +809,543 @@ func (lp *litepage) Page(filePath string, handler func(w io.Writer)) error {
 	return nil
 }
 
+func (lp *litepage) Asset(filePath string) (string, error) {
+	if err := validate.IsValidFilePath(filePath); err != nil {
+		return "", fmt.Errorf("asset path is not valid '%s': %w", filePath, err)
+	}
+	if lp.assets == nil {
+		return lp.basePath + filePath, nil
+	}
+	hashed, err := lp.assets.Lookup(filePath)
+	if err != nil {
+		return "", err
+	}
+	return lp.basePath + hashed, nil
+}
+
+func (lp *litepage) TemplateFuncs() map[string]any {
+	return map[string]any{
+		"asset":     lp.Asset,
+		"integrity": lp.Integrity,
+		"importmap": func() (template.HTML, error) {
+			tag, err := lp.ImportMap()
+			return template.HTML(tag), err
+		},
+		"imagesize": lp.ImageSize,
+		"srcset": func(filePath string, sizes string) (template.HTMLAttr, error) {
+			attrs, err := lp.Srcset(filePath, sizes)
+			return template.HTMLAttr(attrs), err
+		},
+	}
+}
+
+func (lp *litepage) ImageSize(filePath string) (ImageSize, error) {
+	if err := validate.IsValidFilePath(filePath); err != nil {
+		return ImageSize{}, fmt.Errorf("image path is not valid '%s': %w", filePath, err)
+	}
+	size, err := lp.imageSizes.Lookup(filePath)
+	return ImageSize(size), err
+}
+
+func (lp *litepage) Srcset(filePath string, sizes string) (string, error) {
+	if lp.variants == nil {
+		return "", fmt.Errorf("image variants are not enabled, use WithImageVariants to set the directories and widths")
+	}
+	if err := validate.IsValidFilePath(filePath); err != nil {
+		return "", fmt.Errorf("image path is not valid '%s': %w", filePath, err)
+	}
+	// variants are written after public files are fingerprinted, so they keep their name
+	url := func(p string) (string, error) {
+		if p == filePath {
+			return lp.Asset(p)
+		}
+		return lp.basePath + p, nil
+	}
+	return lp.variants.Srcset(filePath, sizes, url)
+}
+
+func (lp *litepage) ImportMap() (string, error) {
+	if lp.modules == nil {
+		return "", fmt.Errorf("import map is not enabled, use WithImportMap to set the module directory")
+	}
+	m, err := lp.modules.Map()
+	if err != nil {
+		return "", fmt.Errorf("could not create import map: %w", err)
+	}
+	return m.Tag()
+}
+
+func (lp *litepage) Integrity(filePath string) (string, error) {
+	if err := validate.IsValidFilePath(filePath); err != nil {
+		return "", fmt.Errorf("asset path is not valid '%s': %w", filePath, err)
+	}
+	return lp.integrityOf(lp.serving).Lookup(filePath)
+}
+
+// integrityOf returns the integrity of public files as they are built, or as
+// they are served by the dev server.
+func (lp *litepage) integrityOf(serving bool) *asset.Integrity {
+	if serving {
+		return lp.serveIntegrity
+	}
+	return lp.integrity
+}
+
+// assetTransforms returns the transforms applied to public files when they are copied, in order.
+// Serving leaves out the transforms that only make files smaller.
+func (lp *litepage) assetTransforms(serving bool) []model.Transform {
+	var transforms []model.Transform
+	if lp.bundler != nil {
+		transforms = append(transforms, lp.bundler.Transform())
+	}
+	if lp.stripper != nil {
+		transforms = append(transforms, lp.stripper.Transform())
+	}
+	if lp.minifyAssets && !serving {
+		transforms = append(transforms, minify.AssetTransform())
+	}
+	return transforms
+}
+
+// assetExtensions returns the extensions of the public files the asset transforms handle.
+func (lp *litepage) assetExtensions(serving bool) []string {
+	var extensions []string
+	if lp.bundler != nil {
+		extensions = append(extensions, bundle.Extensions...)
+	}
+	if lp.stripper != nil {
+		extensions = append(extensions, images.StripExtensions...)
+	}
+	if lp.minifyAssets && !serving {
+		extensions = append(extensions, minify.AssetExtensions...)
+	}
+	return extensions
+}
+
+// transforms returns the transforms applied to every page after it is rendered, in order.
+// Serving leaves out the transforms that only make pages smaller.
+func (lp *litepage) transforms(serving bool) []model.Transform {
+	var transforms []model.Transform
+	if lp.rewriteBase {
+		transforms = append(transforms, rewrite.BasePath(lp.basePath))
+	}
+	if lp.modules != nil {
+		// preload links are added before integrity attributes, so they get one too
+		transforms = append(transforms, importmap.PreloadTransform(*lp.modules, lp.assets))
+	}
+	if lp.injectSizes {
+		transforms = append(transforms, images.SizeTransform(lp.imageSizes, lp.assets, lp.basePath))
+	}
+	if lp.injectSRI {
+		transforms = append(transforms, asset.IntegrityTransform(lp.integrityOf(serving), lp.assets, lp.basePath))
+	}
+	if serving && lp.liveReload() {
+		transforms = append(transforms, reload.Transform(lp.basePath))
+	}
+	if lp.minifyHTML != nil && !(serving && lp.minifyHTML.SkipServe) {
+		transforms = append(transforms, minify.HTMLTransform())
+	}
+	// the policy hashes the final contents of inline scripts and styles, so it comes last
+	if lp.csp != nil && !lp.csp.Headers {
+		transforms = append(transforms, csp.MetaTransform(lp.csp.Policy))
+	}
+	return transforms
+}
+
+// pipelineCommands returns the build or watch commands of the pipeline.
+func (lp *litepage) pipelineCommands(watch bool) []pipeline.Command {
+	var commands []pipeline.Command
+	for _, c := range lp.pipeline {
+		args := c.Build
+		if watch {
+			args = c.Watch
+		}
+		if len(args) > 0 {
+			commands = append(commands, pipeline.Command{Name: c.Name, Args: args, Dir: c.Dir})
+		}
+	}
+	return commands
+}
+
+// liveReload reports whether pages reload when files change while serving, which is
+// when the pipeline has commands writing files in watch mode.
+func (lp *litepage) liveReload() bool {
+	return len(lp.pipelineCommands(true)) > 0
+}
+
+// headers returns the headers the dev server sends along with each page, if any.
+func (lp *litepage) headers() func(pagePath string, contents []byte) http.Header {
+	if lp.csp == nil {
+		return nil
+	}
+	return csp.Headers(lp.csp.Policy)
+}
+
 func (lp *litepage) Serve(port string) error {
+	// pages are rendered on request, so Integrity must describe the files as they are served
+	lp.serving = true
 	sc := serve.Config{
-		PublicDir:   lp.publicDir,
-		Pages:       lp.pages,
-		SiteDomain:  lp.siteDomain,
-		BasePath:    lp.basePath,
-		WithSitemap: lp.withSitemap,
+		Public:          lp.public,
+		Pages:           lp.pages,
+		SiteDomain:      lp.siteDomain,
+		BasePath:        lp.basePath,
+		WithSitemap:     lp.withSitemap,
+		Host:            lp.host,
+		Transforms:      lp.transforms(true),
+		Assets:          lp.assets,
+		Headers:         lp.headers(),
+		Compress:        lp.precompress,
+		AssetTransforms: lp.assetTransforms(true),
+		Variants:        lp.variants,
+	}
+	if lp.liveReload() {
+		fmt.Printf("LITEPAGE starting pipeline...\n")
+		stop, err := pipeline.Start(lp.pipelineCommands(true), os.Stdout)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		sc.Reload = reload.New(lp.basePath, 250*time.Millisecond, lp.public)
 	}
 	server := serve.New(sc)
 	return server.Serve(port)
 }
 
+func (lp *litepage) Preview(port string) error {
+	err := lp.Build()
+	if err != nil {
+		return err
+	}
+
+	pc := serve.PreviewConfig{
+		Config: serve.Config{
+			Public:      lp.public,
+			Pages:       lp.pages,
+			SiteDomain:  lp.siteDomain,
+			BasePath:    lp.basePath,
+			WithSitemap: lp.withSitemap,
+			Host:        lp.host,
+			Headers:     lp.headers(),
+			Compress:    lp.precompress,
+		},
+		DistDir: lp.distDir,
+	}
+	server := serve.NewPreview(pc)
+	return server.Serve(port)
+}
+
 func (lp *litepage) Build() error {
+	if commands := lp.pipelineCommands(false); len(commands) > 0 {
+		fmt.Printf("LITEPAGE running pipeline...\n")
+		if err := pipeline.Run(commands, os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	if lp.crawl != nil {
+		if err := lp.crawlSite(); err != nil {
+			return err
+		}
+	}
+
 	bc := build.Config{
-		DistDir:     lp.distDir,
-		PublicDir:   lp.publicDir,
+		DistDir:         lp.distDir,
+		Public:          lp.public,
+		Copy:            lp.copy,
+		Pages:           lp.pages,
+		SiteDomain:      lp.siteDomain,
+		BasePath:        lp.basePath,
+		WithSitemap:     lp.withSitemap,
+		Transforms:      lp.transforms(false),
+		Assets:          lp.assets,
+		AssetTransforms: lp.assetTransforms(false),
+		AssetExtensions: lp.assetExtensions(false),
+		Compress:        lp.precompress,
+		Variants:        lp.variants,
+	}
+	builder := build.New(bc)
+	err := builder.Build()
+	if err != nil {
+		return err
+	}
+
+	if lp.overlay != nil {
+		if err := lp.reportOverrides(); err != nil {
+			return err
+		}
+	}
+	if lp.stripper != nil {
+		lp.reportLocations()
+	}
+
+	if lp.csp != nil && lp.csp.Headers {
+		if err := lp.writeCSPHeaders(); err != nil {
+			return err
+		}
+	}
+
+	if lp.baseLint != nil {
+		if err := lp.lintBasePath(); err != nil {
+			return err
+		}
+	}
+	if lp.linkCheck {
+		if err := lp.checkLinks(); err != nil {
+			return err
+		}
+	}
+	if lp.extLinks != nil {
+		return lp.checkExternalLinks()
+	}
+	return nil
+}
+
+// reportOverrides lists the public files that override files of earlier layers.
+func (lp *litepage) reportOverrides() error {
+	overrides, err := lp.overlay.Overrides()
+	if err != nil {
+		return fmt.Errorf("could not list overridden public files: %w", err)
+	}
+	if lp.ignore != nil {
+		kept := overrides[:0]
+		for _, o := range overrides {
+			if !lp.ignore.Ignored(file.FSPath(o.Path), false) {
+				kept = append(kept, o)
+			}
+		}
+		overrides = kept
+	}
+	if len(overrides) == 0 {
+		return nil
+	}
+	fmt.Printf("LITEPAGE found %d public files overriding earlier layers:\n", len(overrides))
+	for _, o := range overrides {
+		fmt.Printf("- %s from '%s' overrides '%s'\n", o.Path, o.Layer, strings.Join(o.Overridden, "', '"))
+	}
+	return nil
+}
+
+// ignoreFiles hides the public files matching the patterns of WithIgnore and of
+// the .litepageignore file, along with the file itself.
+func (lp *litepage) ignoreFiles() error {
+	patterns := append([]string{}, lp.ignorePatterns...)
+	data, err := fs.ReadFile(lp.public, ignore.FileName)
+	switch {
+	case err == nil:
+		patterns = append(patterns, ignore.Parse(data)...)
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("could not read %s: %w", ignore.FileName, err)
+	}
+	if len(patterns) == 0 && err != nil {
+		return nil
+	}
+	matcher, err := ignore.New(append(patterns, "/"+ignore.FileName)...)
+	if err != nil {
+		return err
+	}
+	lp.ignore = matcher
+	lp.public = ignore.NewFS(lp.public, matcher)
+	return nil
+}
+
+// reportLocations lists the images whose GPS coordinates were removed.
+func (lp *litepage) reportLocations() {
+	located := lp.stripper.Located()
+	if len(located) == 0 {
+		return
+	}
+	fmt.Printf("LITEPAGE removed location data from %d images:\n", len(located))
+	for _, f := range located {
+		fmt.Printf("- %s\n", f)
+	}
+}
+
+// writeCSPHeaders adds the policy of every built page to the '_headers' file of
+// the dist directory, after any rules copied from the public directory.
+func (lp *litepage) writeCSPHeaders() error {
+	policies := map[string]string{}
+	var pagePaths []string
+	for _, p := range *lp.pages {
+		if !file.IsHTML(p.Path) {
+			continue
+		}
+		contents, err := os.ReadFile(filepath.Join(lp.distDir, filepath.FromSlash(p.Path)))
+		if err != nil {
+			return fmt.Errorf("could not read page to create its content security policy: %w", err)
+		}
+		policies[p.Path] = csp.Policy(lp.csp.Policy, csp.Collect(contents))
+		pagePaths = append(pagePaths, p.Path)
+	}
+
+	// the rules are added to the public file rather than the built one, which has them from previous builds
+	headersFile := filepath.Join(lp.distDir, "_headers")
+	existing, err := fs.ReadFile(lp.public, "_headers")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not read _headers: %w", err)
+	}
+	if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		existing = append(existing, '\n')
+	}
+	rules := append(existing, csp.HeaderRules(policies, pagePaths)...)
+	if err := file.WriteFile(headersFile, rules); err != nil {
+		return fmt.Errorf("could not write _headers: %w", err)
+	}
+	fmt.Printf("Wrote content security policy of %d pages to _headers\n", len(pagePaths))
+	return nil
+}
+
+func (lp *litepage) lintBasePath() error {
+	// only the files of this build are linted, rather than everything in the dist directory
+	built := map[string]bool{}
+	var files []string
+	err := file.WalkFiles(lp.public, func(filePath string) error {
+		built[filePath] = true
+		files = append(files, filePath)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not list public files: %w", err)
+	}
+	for _, p := range *lp.pages {
+		if !built[p.Path] {
+			files = append(files, p.Path)
+		}
+	}
+
+	problems, err := lint.BasePath(lint.Config{DistDir: lp.distDir, BasePath: lp.basePath, Files: files})
+	if err != nil {
+		return fmt.Errorf("could not lint base path: %w", err)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+
+	fmt.Printf("LITEPAGE found %d URLs missing the base path '%s':\n", len(problems), lp.basePath)
+	for _, p := range problems {
+		fmt.Printf("- %s\n", p)
+	}
+	if *lp.baseLint == Fail {
+		return fmt.Errorf("found %d URLs missing the base path", len(problems))
+	}
+	return nil
+}
+
+func (lp *litepage) checkLinks() error {
+	fmt.Printf("LITEPAGE checking links in '%s'...\n", lp.distDir)
+	report, err := links.Check(links.CheckConfig{DistDir: lp.distDir, BasePath: lp.basePath})
+	if err != nil {
+		return fmt.Errorf("could not check links: %w", err)
+	}
+
+	for _, b := range report.Broken {
+		fmt.Printf("- %s\n", b)
+	}
+	fmt.Printf("Checked %d pages, found %d broken links\n", report.Checked, len(report.Broken))
+
+	if len(report.Broken) > 0 {
+		return fmt.Errorf("link check found %d broken links", len(report.Broken))
+	}
+	return nil
+}
+
+func (lp *litepage) crawlSite() error {
+	fmt.Printf("LITEPAGE crawling site from %s...\n", strings.Join(lp.crawl.entryPages, ", "))
+	cc := links.CrawlConfig{
+		Public:      lp.public,
 		Pages:       lp.pages,
-		SiteDomain:  lp.siteDomain,
 		BasePath:    lp.basePath,
 		WithSitemap: lp.withSitemap,
+		EntryPages:  lp.crawl.entryPages,
+		Transforms:  lp.transforms(false),
+		Assets:      lp.assets,
+		Variants:    lp.variants,
 	}
-	builder := build.New(bc)
-	return builder.Build()
+	report, err := links.Crawl(cc)
+	if err != nil {
+		return fmt.Errorf("could not crawl site: %w", err)
+	}
+
+	for _, b := range report.Broken {
+		fmt.Printf("- %s\n", b)
+	}
+	for _, p := range report.Unreachable {
+		fmt.Printf("- %s is not linked from any crawled page\n", p)
+	}
+	fmt.Printf("Crawled %d pages, found %d broken links\n", len(report.Crawled), len(report.Broken))
+
+	if lp.crawl.severity == Fail && len(report.Broken) > 0 {
+		return fmt.Errorf("crawl found %d broken links", len(report.Broken))
+	}
+	return nil
+}
+
+func (lp *litepage) checkExternalLinks() error {
+	fmt.Printf("LITEPAGE checking external links in '%s'...\n", lp.distDir)
+	ec := links.ExternalConfig{
+		DistDir:      lp.distDir,
+		Concurrency:  lp.extLinks.Concurrency,
+		Timeout:      lp.extLinks.Timeout,
+		HostInterval: lp.extLinks.HostInterval,
+		CacheFile:    lp.extLinks.CacheFile,
+		CacheTTL:     lp.extLinks.CacheTTL,
+		StandIns:     lp.extLinks.StandIns,
+	}
+	report, err := links.CheckExternal(ec)
+	if err != nil {
+		return fmt.Errorf("could not check external links: %w", err)
+	}
+
+	for _, b := range report.Broken {
+		fmt.Printf("- %s\n", b)
+	}
+	fmt.Printf("Checked %d external links (%d cached), found %d broken links\n", report.Checked, report.Cached, len(report.Broken))
+
+	if lp.extLinks.Severity == Fail && len(report.Broken) > 0 {
+		return fmt.Errorf("external link check found %d broken links", len(report.Broken))
+	}
+	return nil
+}
+
+func (lp *litepage) Verify() error {
+	// the transforms of the build are used to serve too, so only differences in rendering are found
+	vc := verify.Config{
+		Public:          lp.public,
+		Copy:            lp.copy,
+		Pages:           lp.pages,
+		SiteDomain:      lp.siteDomain,
+		BasePath:        lp.basePath,
+		WithSitemap:     lp.withSitemap,
+		Transforms:      lp.transforms(false),
+		Assets:          lp.assets,
+		AssetTransforms: lp.assetTransforms(false),
+		AssetExtensions: lp.assetExtensions(false),
+		Variants:        lp.variants,
+	}
+	report, err := verify.New(vc).Verify()
+	if err != nil {
+		return fmt.Errorf("could not verify site: %w", err)
+	}
+
+	fmt.Printf("Verified %d files\n", report.Checked)
+	if len(report.Differences) == 0 {
+		return nil
+	}
+	for _, d := range report.Differences {
+		fmt.Printf("- %s\n", d)
+	}
+	return fmt.Errorf("found %d files that differ between serve and build", len(report.Differences))
 }
 
 func (lp *litepage) BuildOrServe() error {
 	mode := os.Getenv("LP_MODE")
 	port := os.Getenv("LP_PORT")
 
-	if mode == "serve" {
+	switch mode {
+	case "serve":
 		return lp.Serve(port)
-	} else {
+	case "preview":
+		return lp.Preview(port)
+	default:
 		return lp.Build()
 	}
 }
@@ -1,8 +1,25 @@
 package litepage_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"html"
+	"html/template"
+	"image"
+	"image/jpeg"
 	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/man-on-box/litepage"
 	"github.com/stretchr/testify/assert"
@@ -32,6 +49,51 @@ func TestCreateNewLitepage(t *testing.T) {
 		assert.ErrorContains(t, err, "base path is not valid")
 
 	})
+
+	t.Run("Returns error if content security policy headers are used with a base path", func(t *testing.T) {
+		_, err := litepage.New("nice-domain.com", litepage.WithCSP(litepage.CSP{Headers: true}), litepage.WithBasePath("/test"))
+		assert.ErrorContains(t, err, "content security policy headers cannot be used with a base path")
+		_, err = litepage.New("nice-domain.com", litepage.WithCSP(litepage.CSP{}), litepage.WithBasePath("/test"))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Returns error if host to emulate is unknown", func(t *testing.T) {
+		_, err := litepage.New("nice-domain.com", litepage.WithHostEmulation("geocities"))
+		assert.Error(t, err)
+		assert.ErrorContains(t, err, "cannot emulate host")
+	})
+
+	t.Run("Returns error if crawl entry page is not valid", func(t *testing.T) {
+		_, err := litepage.New("nice-domain.com", litepage.WithCrawl(litepage.Fail, "index.html"))
+		assert.Error(t, err)
+		assert.ErrorContains(t, err, "crawl entry page is not valid")
+	})
+
+	t.Run("Returns error if fingerprint extension is not valid", func(t *testing.T) {
+		_, err := litepage.New("nice-domain.com", litepage.WithFingerprint("css"))
+		assert.Error(t, err)
+		assert.ErrorContains(t, err, "fingerprint extension must start with a '.'")
+	})
+
+	t.Run("Returns error if precompress encoding extension is not valid", func(t *testing.T) {
+		gzip := litepage.Gzip()
+		gzip.Extension = "gz"
+		_, err := litepage.New("nice-domain.com", litepage.WithPrecompress(litepage.Precompress{Encodings: []litepage.Encoding{gzip}}))
+		assert.Error(t, err)
+		assert.ErrorContains(t, err, "precompress encoding extension must start with a '.'")
+	})
+
+	t.Run("Returns error if external link check settings are negative", func(t *testing.T) {
+		for expected, config := range map[string]litepage.ExternalLinkCheck{
+			"concurrency must not be negative":   {Concurrency: -1},
+			"timeout must not be negative":       {Timeout: -time.Second},
+			"host interval must not be negative": {HostInterval: -time.Second},
+			"cache TTL must not be negative":     {CacheTTL: -time.Hour},
+		} {
+			_, err := litepage.New("nice-domain.com", litepage.WithExternalLinkCheck(config))
+			assert.ErrorContains(t, err, expected)
+		}
+	})
 }
 
 func TestAddNewPage(t *testing.T) {
@@ -63,3 +125,759 @@ func TestAddNewPage(t *testing.T) {
 		assert.ErrorContains(t, err, "it already exists")
 	})
 }
+
+func TestAsset(t *testing.T) {
+	publicDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(publicDir, "styles.css"), []byte("body { color: red; }"), 0644)
+	assert.NoError(t, err)
+
+	t.Run("Returns the path with the base path without fingerprinting", func(t *testing.T) {
+		lp, err := litepage.New("nice-domain.com", litepage.WithPublicDir(publicDir), litepage.WithBasePath("/base"))
+		assert.NoError(t, err)
+
+		url, err := lp.Asset("/styles.css")
+		assert.NoError(t, err)
+		assert.Equal(t, "/base/styles.css", url)
+	})
+
+	t.Run("Returns the fingerprinted path with the base path", func(t *testing.T) {
+		lp, err := litepage.New("nice-domain.com", litepage.WithFingerprint(), litepage.WithPublicDir(publicDir), litepage.WithBasePath("/base"))
+		assert.NoError(t, err)
+
+		url, err := lp.Asset("/styles.css")
+		assert.NoError(t, err)
+		assert.Regexp(t, `^/base/styles\.[0-9a-f]{8}\.css$`, url)
+
+		_, err = lp.Asset("/missing.css")
+		assert.Error(t, err)
+	})
+
+	t.Run("Provides the asset template function", func(t *testing.T) {
+		lp, err := litepage.New("nice-domain.com", litepage.WithFingerprint(), litepage.WithPublicDir(publicDir))
+		assert.NoError(t, err)
+
+		tmpl := template.Must(template.New("").Funcs(lp.TemplateFuncs()).Parse(`<link href="{{ asset "/styles.css" }}">`))
+		var buf bytes.Buffer
+		assert.NoError(t, tmpl.Execute(&buf, nil))
+		assert.Regexp(t, `^<link href="/styles\.[0-9a-f]{8}\.css">$`, buf.String())
+	})
+}
+
+func TestIntegrity(t *testing.T) {
+	publicDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(publicDir, "app.js"), []byte("console.log('hi')"), 0644)
+	assert.NoError(t, err)
+
+	lp, err := litepage.New("nice-domain.com", litepage.WithPublicDir(publicDir))
+	assert.NoError(t, err)
+
+	t.Run("Returns the integrity of the file", func(t *testing.T) {
+		value, err := lp.Integrity("/app.js")
+		assert.NoError(t, err)
+		assert.Regexp(t, `^sha384-[A-Za-z0-9+/]{64}$`, value)
+
+		_, err = lp.Integrity("/missing.js")
+		assert.Error(t, err)
+		_, err = lp.Integrity("app.js")
+		assert.ErrorContains(t, err, "asset path is not valid")
+	})
+
+	t.Run("Provides the integrity template function", func(t *testing.T) {
+		value, err := lp.Integrity("/app.js")
+		assert.NoError(t, err)
+
+		tmpl := template.Must(template.New("").Funcs(lp.TemplateFuncs()).Parse(`{{ integrity "/app.js" }}`))
+		var buf bytes.Buffer
+		assert.NoError(t, tmpl.Execute(&buf, nil))
+		assert.Equal(t, value, html.UnescapeString(buf.String()))
+	})
+}
+
+func TestBuildWithCSPHeaders(t *testing.T) {
+	publicDir := t.TempDir()
+	distDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(publicDir, "_headers"), []byte("/*\n  X-Frame-Options: DENY"), 0644)
+	assert.NoError(t, err)
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(publicDir),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+		litepage.WithCSP(litepage.CSP{Policy: "script-src 'self'", Headers: true}),
+	)
+	assert.NoError(t, err)
+	lp.Page("/about.html", func(w io.Writer) {
+		w.Write([]byte("<html><head></head><body><p>About</p></body></html>"))
+	})
+	assert.NoError(t, lp.Build())
+
+	page, err := os.ReadFile(filepath.Join(distDir, "about.html"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(page), "Content-Security-Policy")
+
+	headers, err := os.ReadFile(filepath.Join(distDir, "_headers"))
+	assert.NoError(t, err)
+	assert.Equal(t, "/*\n  X-Frame-Options: DENY\n"+
+		"/about.html\n  Content-Security-Policy: script-src 'self'\n"+
+		"/about\n  Content-Security-Policy: script-src 'self'\n", string(headers))
+
+	t.Run("Writes the same rules when building again", func(t *testing.T) {
+		for _, withPublic := range []bool{true, false} {
+			if !withPublic {
+				assert.NoError(t, os.Remove(filepath.Join(publicDir, "_headers")))
+			}
+			assert.NoError(t, lp.Build())
+			first, err := os.ReadFile(filepath.Join(distDir, "_headers"))
+			assert.NoError(t, err)
+			assert.NoError(t, lp.Build())
+			second, err := os.ReadFile(filepath.Join(distDir, "_headers"))
+			assert.NoError(t, err)
+			assert.Equal(t, string(first), string(second))
+			assert.Equal(t, withPublic, strings.Contains(string(second), "X-Frame-Options"))
+		}
+	})
+}
+
+func TestBuildWithMinifyHTML(t *testing.T) {
+	distDir := t.TempDir()
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(t.TempDir()),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+		litepage.WithMinifyHTML(litepage.MinifyHTML{SkipServe: true}),
+	)
+	assert.NoError(t, err)
+	lp.Page("/index.html", func(w io.Writer) {
+		w.Write([]byte("<html>\n  <body>\n    <!-- nav -->\n    <p class=\"intro\">\n      Hello\n    </p>\n  </body>\n</html>\n"))
+	})
+	assert.NoError(t, lp.Build())
+
+	page, err := os.ReadFile(filepath.Join(distDir, "index.html"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<html><body><p class=intro>Hello</p></body></html>", string(page))
+}
+
+func TestBuildWithMinifyAssets(t *testing.T) {
+	publicDir := t.TempDir()
+	distDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(publicDir, "app.js"), []byte("// greet\nconsole.log( 'hi' )\n"), 0644)
+	assert.NoError(t, err)
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(publicDir),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+		litepage.WithMinifyAssets(),
+		litepage.WithIntegrity(),
+	)
+	assert.NoError(t, err)
+	lp.Page("/index.html", func(w io.Writer) {
+		w.Write([]byte(`<script src="/app.js"></script>`))
+	})
+	assert.NoError(t, lp.Build())
+
+	script, err := os.ReadFile(filepath.Join(distDir, "app.js"))
+	assert.NoError(t, err)
+	assert.Equal(t, "console.log('hi')", string(script))
+
+	sum := sha512.Sum384(script)
+	page, err := os.ReadFile(filepath.Join(distDir, "index.html"))
+	assert.NoError(t, err)
+	assert.Equal(t, `<script integrity="sha384-`+base64.StdEncoding.EncodeToString(sum[:])+`" src="/app.js"></script>`, string(page))
+}
+
+func TestBuildWithMinifyAndFingerprint(t *testing.T) {
+	publicDir := t.TempDir()
+	distDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(publicDir, "styles.css"), []byte("/* theme */\nbody {\n  color: red;\n}\n"), 0644)
+	assert.NoError(t, err)
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(publicDir),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+		litepage.WithMinifyAssets(),
+		litepage.WithFingerprint(".css"),
+		litepage.WithIntegrity(),
+	)
+	assert.NoError(t, err)
+	hashed, err := lp.Asset("/styles.css")
+	assert.NoError(t, err)
+	lp.Page("/index.html", func(w io.Writer) {
+		w.Write([]byte(`<link rel="stylesheet" href="` + hashed + `">`))
+	})
+	assert.NoError(t, lp.Build())
+
+	styles, err := os.ReadFile(filepath.Join(distDir, filepath.FromSlash(hashed)))
+	assert.NoError(t, err)
+	assert.Equal(t, "body{color:red}", string(styles))
+
+	// the name and the digest are of the minified file that is deployed
+	hash := sha256.Sum256(styles)
+	assert.Equal(t, "/styles."+hex.EncodeToString(hash[:])[:8]+".css", hashed)
+	sum := sha512.Sum384(styles)
+	page, err := os.ReadFile(filepath.Join(distDir, "index.html"))
+	assert.NoError(t, err)
+	assert.Equal(t, `<link integrity="sha384-`+base64.StdEncoding.EncodeToString(sum[:])+`" rel="stylesheet" href="`+hashed+`">`, string(page))
+}
+
+func TestBuildWithPrecompress(t *testing.T) {
+	publicDir := t.TempDir()
+	distDir := t.TempDir()
+	styles := strings.Repeat("p { color: red; }\n", 100)
+	err := os.WriteFile(filepath.Join(publicDir, "styles.css"), []byte(styles), 0644)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(publicDir, "app.js"), []byte("run()"), 0644)
+	assert.NoError(t, err)
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(publicDir),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+		litepage.WithPrecompress(litepage.Precompress{}),
+	)
+	assert.NoError(t, err)
+	page := strings.Repeat("<p>Hello</p>", 200)
+	lp.Page("/index.html", func(w io.Writer) {
+		w.Write([]byte(page))
+	})
+	assert.NoError(t, lp.Build())
+
+	for name, expected := range map[string]string{"index.html": page, "styles.css": styles} {
+		f, err := os.Open(filepath.Join(distDir, name+".gz"))
+		assert.NoError(t, err)
+		defer f.Close()
+		r, err := gzip.NewReader(f)
+		assert.NoError(t, err)
+		contents, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(contents))
+	}
+
+	// app.js is smaller than the minimum size
+	_, err = os.Stat(filepath.Join(distDir, "app.js.gz"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestBuildWithBasePathLint(t *testing.T) {
+	publicDir := t.TempDir()
+	distDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(publicDir, "styles.css"), []byte(".bg { background: url(/bg.png) }"), 0644)
+	assert.NoError(t, err)
+	// left from an earlier build
+	err = os.WriteFile(filepath.Join(distDir, "old.css"), []byte(".bg { background: url(/bg.png) }"), 0644)
+	assert.NoError(t, err)
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(publicDir),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+		litepage.WithBasePath("/test"),
+		litepage.WithFingerprint(".css"),
+		litepage.WithBasePathLint(litepage.Fail),
+	)
+	assert.NoError(t, err)
+	lp.Page("/index.html", func(w io.Writer) {
+		w.Write([]byte(`<a href="/test/">Home</a>`))
+	})
+
+	// the fingerprinted copy of the stylesheet and the file left in the dist directory are not linted
+	assert.EqualError(t, lp.Build(), "found 1 URLs missing the base path")
+}
+
+func TestBuildWithCSSBundle(t *testing.T) {
+	publicDir := t.TempDir()
+	distDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(publicDir, "css", "partials"), 0755))
+	err := os.WriteFile(filepath.Join(publicDir, "css", "main.css"), []byte(`@import "partials/card.css";`+"\n.main { color: red }"), 0644)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(publicDir, "css", "partials", "card.css"), []byte(`.card { background: url(../../img/card.png) }`), 0644)
+	assert.NoError(t, err)
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(publicDir),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+		litepage.WithCSSBundle("/css/main.css"),
+		litepage.WithFingerprint(".css"),
+	)
+	assert.NoError(t, err)
+	assert.NoError(t, lp.Build())
+
+	bundled := ".card { background: url(../img/card.png) }\n.main { color: red }"
+	hashed, err := lp.Asset("/css/main.css")
+	assert.NoError(t, err)
+	for _, p := range []string{"/css/main.css", hashed} {
+		contents, err := os.ReadFile(filepath.Join(distDir, filepath.FromSlash(p)))
+		assert.NoError(t, err)
+		assert.Equal(t, bundled, string(contents))
+	}
+
+	// changing an imported file changes the fingerprint of the bundle
+	err = os.WriteFile(filepath.Join(publicDir, "css", "partials", "card.css"), []byte(`.card { color: blue }`), 0644)
+	assert.NoError(t, err)
+	changed, err := lp.Asset("/css/main.css")
+	assert.NoError(t, err)
+	assert.NotEqual(t, hashed, changed)
+
+	t.Run("Returns error if entry is not a stylesheet", func(t *testing.T) {
+		_, err := litepage.New("nice-domain.com", litepage.WithCSSBundle("/css/main.scss"))
+		assert.ErrorContains(t, err, "css bundle entry must be the path of a stylesheet")
+	})
+}
+
+func TestImportMap(t *testing.T) {
+	publicDir := t.TempDir()
+	distDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(publicDir, "js"), 0755))
+	err := os.WriteFile(filepath.Join(publicDir, "js", "app.js"), []byte(`import { greet } from "./greet.js";`), 0644)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(publicDir, "js", "greet.js"), []byte(`export const greet = "hi";`), 0644)
+	assert.NoError(t, err)
+
+	t.Run("Returns error if import map is not enabled", func(t *testing.T) {
+		lp, err := litepage.New("nice-domain.com", litepage.WithPublicDir(publicDir))
+		assert.NoError(t, err)
+		_, err = lp.ImportMap()
+		assert.ErrorContains(t, err, "import map is not enabled")
+	})
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(publicDir),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+		litepage.WithBasePath("/base"),
+		litepage.WithFingerprint(".js"),
+		litepage.WithImportMap(""),
+	)
+	assert.NoError(t, err)
+	app, err := lp.Asset("/js/app.js")
+	assert.NoError(t, err)
+	greet, err := lp.Asset("/js/greet.js")
+	assert.NoError(t, err)
+
+	tmpl := template.Must(template.New("").Funcs(lp.TemplateFuncs()).Parse(
+		`<html><head>{{ importmap }}</head><body><script type="module" src="{{ asset "/js/app.js" }}"></script></body></html>`,
+	))
+	lp.Page("/index.html", func(w io.Writer) {
+		tmpl.Execute(w, nil)
+	})
+	assert.NoError(t, lp.Build())
+
+	page, err := os.ReadFile(filepath.Join(distDir, "index.html"))
+	assert.NoError(t, err)
+	assert.Equal(t, `<html><head><script type="importmap">{"imports":{`+
+		`"/base/js/app.js":"`+app+`","/base/js/greet.js":"`+greet+`","app":"`+app+`","greet":"`+greet+`"}}</script>`+
+		`<link rel="modulepreload" href="`+greet+`"></head>`+
+		`<body><script type="module" src="`+app+`"></script></body></html>`, string(page))
+}
+
+func TestBuildWithPipeline(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	t.Run("Returns error if a command has nothing to run", func(t *testing.T) {
+		_, err := litepage.New("nice-domain.com", litepage.WithPipeline(litepage.Command{Name: "tailwind"}))
+		assert.ErrorContains(t, err, "pipeline command 'tailwind' must have a Build or Watch command")
+	})
+
+	t.Run("Fails the build if a command fails", func(t *testing.T) {
+		distDir := t.TempDir()
+		lp, err := litepage.New("nice-domain.com",
+			litepage.WithPublicDir(t.TempDir()),
+			litepage.WithDistDir(distDir),
+			litepage.WithPipeline(litepage.Command{Name: "broken", Build: []string{goBin, "not-a-command"}}),
+		)
+		assert.NoError(t, err)
+		lp.Page("/index.html", func(w io.Writer) {})
+
+		err = lp.Build()
+		assert.ErrorContains(t, err, "pipeline command 'broken' failed")
+		_, err = os.Stat(filepath.Join(distDir, "index.html"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Runs the commands before building", func(t *testing.T) {
+		publicDir := t.TempDir()
+		distDir := t.TempDir()
+		lp, err := litepage.New("nice-domain.com",
+			litepage.WithPublicDir(publicDir),
+			litepage.WithDistDir(distDir),
+			litepage.WithoutSitemap(),
+			litepage.WithPipeline(litepage.Command{
+				Build: []string{goBin, "env", "GOOS"},
+				Watch: []string{goBin, "env", "GOOS"},
+			}),
+		)
+		assert.NoError(t, err)
+		lp.Page("/index.html", func(w io.Writer) {})
+		assert.NoError(t, lp.Build())
+
+		page, err := os.ReadFile(filepath.Join(distDir, "index.html"))
+		assert.NoError(t, err)
+		assert.Equal(t, "", string(page), "the live reload script is only added when serving")
+	})
+}
+
+func TestImageSize(t *testing.T) {
+	publicDir := t.TempDir()
+	distDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(publicDir, "logo.svg"), []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 120 40"></svg>`), 0644)
+	assert.NoError(t, err)
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(publicDir),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+		litepage.WithImageSize(),
+	)
+	assert.NoError(t, err)
+
+	size, err := lp.ImageSize("/logo.svg")
+	assert.NoError(t, err)
+	assert.Equal(t, litepage.ImageSize{Width: 120, Height: 40}, size)
+	_, err = lp.ImageSize("/missing.png")
+	assert.Error(t, err)
+
+	tmpl := template.Must(template.New("").Funcs(lp.TemplateFuncs()).Parse(
+		`<img src="/logo.svg">{{ with imagesize "/logo.svg" }}<p>{{ .Width }}x{{ .Height }}</p>{{ end }}`,
+	))
+	lp.Page("/index.html", func(w io.Writer) {
+		tmpl.Execute(w, nil)
+	})
+	assert.NoError(t, lp.Build())
+
+	page, err := os.ReadFile(filepath.Join(distDir, "index.html"))
+	assert.NoError(t, err)
+	assert.Equal(t, `<img width="120" height="40" src="/logo.svg"><p>120x40</p>`, string(page))
+}
+
+func TestBuildWithImageVariants(t *testing.T) {
+	publicDir := t.TempDir()
+	distDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(publicDir, "photos"), 0755))
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 300)), nil))
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "photos", "cat.jpg"), buf.Bytes(), 0644))
+
+	t.Run("Returns error if widths are not set", func(t *testing.T) {
+		_, err := litepage.New("nice-domain.com", litepage.WithImageVariants(litepage.ImageVariants{Dirs: []string{"/photos"}}))
+		assert.ErrorContains(t, err, "at least one width")
+	})
+
+	t.Run("Returns error if image variants are not enabled", func(t *testing.T) {
+		lp, err := litepage.New("nice-domain.com", litepage.WithPublicDir(publicDir))
+		assert.NoError(t, err)
+		_, err = lp.Srcset("/photos/cat.jpg", "")
+		assert.ErrorContains(t, err, "image variants are not enabled")
+	})
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(publicDir),
+		litepage.WithDistDir(distDir),
+		litepage.WithBasePath("/base"),
+		litepage.WithoutSitemap(),
+		litepage.WithImageVariants(litepage.ImageVariants{Dirs: []string{"/photos"}, Widths: []int{200, 800}, CacheDir: t.TempDir()}),
+	)
+	assert.NoError(t, err)
+
+	tmpl := template.Must(template.New("").Funcs(lp.TemplateFuncs()).Parse(
+		`<img src="/base/photos/cat.jpg" {{ srcset "/photos/cat.jpg" "(min-width: 800px) 50vw, 100vw" }}>`,
+	))
+	lp.Page("/index.html", func(w io.Writer) {
+		tmpl.Execute(w, nil)
+	})
+	assert.NoError(t, lp.Build())
+
+	page, err := os.ReadFile(filepath.Join(distDir, "index.html"))
+	assert.NoError(t, err)
+	assert.Equal(t, `<img src="/base/photos/cat.jpg" srcset="/base/photos/cat-200w.jpg 200w, /base/photos/cat.jpg 400w" sizes="(min-width: 800px) 50vw, 100vw">`, string(page))
+
+	variant, err := os.ReadFile(filepath.Join(distDir, "photos", "cat-200w.jpg"))
+	assert.NoError(t, err)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(variant))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, config.Width)
+	assert.Equal(t, 150, config.Height)
+	_, err = os.Stat(filepath.Join(distDir, "photos", "cat-800w.jpg"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, lp.Verify())
+}
+
+func TestBuildWithStripMetadata(t *testing.T) {
+	publicDir := t.TempDir()
+	distDir := t.TempDir()
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 30, 20)), nil))
+	original := buf.Bytes()
+	comment := []byte{0xff, 0xfe, 0x00, 0x12}
+	comment = append(comment, "Taken at home :)"...)
+	photo := append(append(original[:2:2], comment...), original[2:]...)
+	assert.NoError(t, os.WriteFile(filepath.Join(publicDir, "photo.jpg"), photo, 0644))
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(publicDir),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+		litepage.WithStripMetadata(),
+	)
+	assert.NoError(t, err)
+	lp.Page("/index.html", func(w io.Writer) {
+		w.Write([]byte(`<img src="/photo.jpg">`))
+	})
+	assert.NoError(t, lp.Build())
+
+	built, err := os.ReadFile(filepath.Join(distDir, "photo.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, original, built)
+
+	assert.NoError(t, lp.Verify())
+}
+
+//go:embed testdata/public
+var embedded embed.FS
+
+func TestPublicFS(t *testing.T) {
+	t.Run("Returns error if file system is nil", func(t *testing.T) {
+		_, err := litepage.New("nice-domain.com", litepage.WithPublicFS(nil))
+		assert.ErrorContains(t, err, "must not be nil")
+	})
+
+	public, err := fs.Sub(embedded, "testdata/public")
+	assert.NoError(t, err)
+	distDir := t.TempDir()
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicFS(public),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+		litepage.WithFingerprint(".css"),
+		litepage.WithImageSize(),
+	)
+	assert.NoError(t, err)
+
+	tmpl := template.Must(template.New("").Funcs(lp.TemplateFuncs()).Parse(
+		`<link rel="stylesheet" href="{{ asset "/css/main.css" }}"><img src="/img/icons/logo.svg">`,
+	))
+	lp.Page("/index.html", func(w io.Writer) {
+		tmpl.Execute(w, nil)
+	})
+	assert.NoError(t, lp.Build())
+
+	page, err := os.ReadFile(filepath.Join(distDir, "index.html"))
+	assert.NoError(t, err)
+	assert.Equal(t, `<link rel="stylesheet" href="/css/main.9767e91e.css"><img width="16" height="16" src="/img/icons/logo.svg">`, string(page))
+	for _, name := range []string{"css/main.css", "css/main.9767e91e.css", "img/icons/logo.svg"} {
+		_, err := os.Stat(filepath.Join(distDir, filepath.FromSlash(name)))
+		assert.NoError(t, err, name)
+	}
+
+	assert.NoError(t, lp.Verify())
+}
+
+func TestPublicDirs(t *testing.T) {
+	t.Run("Returns error without directories", func(t *testing.T) {
+		_, err := litepage.New("nice-domain.com", litepage.WithPublicDirs())
+		assert.ErrorContains(t, err, "at least one directory")
+	})
+
+	common := t.TempDir()
+	site := t.TempDir()
+	distDir := t.TempDir()
+	files := map[string]string{
+		filepath.Join(common, "robots.txt"):       "User-agent: *",
+		filepath.Join(common, "css", "theme.css"): "body { color: red; }",
+		filepath.Join(common, "css", "base.css"):  "body { margin: 0; }",
+		filepath.Join(site, "css", "theme.css"):   "body { color: blue; }",
+		filepath.Join(site, "img", "logo.svg"):    "<svg></svg>",
+	}
+	for name, contents := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		assert.NoError(t, os.WriteFile(name, []byte(contents), 0644))
+	}
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDirs(common, site),
+		litepage.WithDistDir(distDir),
+		litepage.WithoutSitemap(),
+	)
+	assert.NoError(t, err)
+	lp.Page("/index.html", func(w io.Writer) {
+		w.Write([]byte(`<link rel="stylesheet" href="/css/theme.css">`))
+	})
+	assert.NoError(t, lp.Build())
+
+	for name, expected := range map[string]string{
+		"robots.txt":    "User-agent: *",
+		"css/base.css":  "body { margin: 0; }",
+		"css/theme.css": "body { color: blue; }",
+		"img/logo.svg":  "<svg></svg>",
+	} {
+		contents, err := os.ReadFile(filepath.Join(distDir, filepath.FromSlash(name)))
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, string(contents), name)
+	}
+
+	assert.NoError(t, lp.Verify())
+}
+
+func TestIgnore(t *testing.T) {
+	t.Run("Returns error with an invalid pattern", func(t *testing.T) {
+		_, err := litepage.New("nice-domain.com", litepage.WithPublicDir(t.TempDir()), litepage.WithIgnore("[a-z"))
+		assert.ErrorContains(t, err, "invalid ignore pattern '[a-z'")
+	})
+
+	publicDir := t.TempDir()
+	distDir := t.TempDir()
+	files := map[string]string{
+		".litepageignore":        "# sources\n*.psd\nsrc/\n",
+		".DS_Store":              "finder",
+		"robots.txt":             "User-agent: *",
+		"img/logo.png":           "png",
+		"img/logo.psd":           "psd",
+		"img/.DS_Store":          "finder",
+		"img/src/logo-draft.png": "draft",
+	}
+	for name, contents := range files {
+		name = filepath.Join(publicDir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		assert.NoError(t, os.WriteFile(name, []byte(contents), 0644))
+	}
+
+	lp, err := litepage.New("nice-domain.com",
+		litepage.WithPublicDir(publicDir),
+		litepage.WithDistDir(distDir),
+		litepage.WithIgnore(".DS_Store"),
+		litepage.WithoutSitemap(),
+	)
+	assert.NoError(t, err)
+	lp.Page("/index.html", func(w io.Writer) {
+		w.Write([]byte(`<img src="/img/logo.png">`))
+	})
+	assert.NoError(t, lp.Build())
+
+	var built []string
+	err = filepath.WalkDir(distDir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(distDir, p)
+			built = append(built, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"index.html", "robots.txt", "img/logo.png"}, built)
+
+	assert.NoError(t, lp.Verify())
+}
+
+func TestCopyPublicFiles(t *testing.T) {
+	t.Run("Returns error with an unknown symlink policy", func(t *testing.T) {
+		_, err := litepage.New("nice-domain.com", litepage.WithSymlinks(litepage.Symlinks(7)))
+		assert.ErrorContains(t, err, "symlink policy must be")
+	})
+
+	root := t.TempDir()
+	publicDir := filepath.Join(root, "public")
+	distDir := filepath.Join(root, "dist")
+	files := map[string]string{
+		"css/main.css":  "body {\n  margin: 0;\n}\n",
+		"video/cat.mp4": "not really a video",
+	}
+	for name, contents := range files {
+		name = filepath.Join(publicDir, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		assert.NoError(t, os.WriteFile(name, []byte(contents), 0644))
+	}
+	assert.NoError(t, os.Symlink("video", filepath.Join(publicDir, "clips")))
+
+	build := func(options ...litepage.Option) error {
+		lp, err := litepage.New("nice-domain.com", append([]litepage.Option{
+			litepage.WithPublicDir(publicDir),
+			litepage.WithDistDir(distDir),
+			litepage.WithoutSitemap(),
+		}, options...)...)
+		assert.NoError(t, err)
+		lp.Page("/index.html", func(w io.Writer) {
+			w.Write([]byte(`<link rel="stylesheet" href="/css/main.css"><video src="/clips/cat.mp4"></video>`))
+		})
+		return lp.Build()
+	}
+
+	t.Run("Hard links public files without changing them", func(t *testing.T) {
+		assert.NoError(t, build(litepage.WithHardLinks(), litepage.WithMinifyAssets()))
+		// built twice, so the links of the first build are replaced
+		assert.NoError(t, build(litepage.WithHardLinks(), litepage.WithMinifyAssets()))
+
+		src, err := os.Stat(filepath.Join(publicDir, "video", "cat.mp4"))
+		assert.NoError(t, err)
+		dst, err := os.Stat(filepath.Join(distDir, "video", "cat.mp4"))
+		assert.NoError(t, err)
+		assert.True(t, os.SameFile(src, dst))
+
+		contents, err := os.ReadFile(filepath.Join(publicDir, "css", "main.css"))
+		assert.NoError(t, err)
+		assert.Equal(t, files["css/main.css"], string(contents))
+		contents, err = os.ReadFile(filepath.Join(distDir, "css", "main.css"))
+		assert.NoError(t, err)
+		assert.Equal(t, "body{margin:0}", string(contents))
+
+		contents, err = os.ReadFile(filepath.Join(distDir, "clips", "cat.mp4"))
+		assert.NoError(t, err)
+		assert.Equal(t, files["video/cat.mp4"], string(contents))
+	})
+
+	t.Run("Fingerprints hard linked files without changing public files", func(t *testing.T) {
+		lp, err := litepage.New("nice-domain.com", litepage.WithPublicDir(publicDir), litepage.WithFingerprint(".css"))
+		assert.NoError(t, err)
+		hashed, err := lp.Asset("/css/main.css")
+		assert.NoError(t, err)
+		// a fingerprinted copy left in the public directory is hard linked to the dist directory
+		stale := filepath.Join(publicDir, filepath.FromSlash(hashed))
+		assert.NoError(t, os.WriteFile(stale, []byte("stale"), 0644))
+		defer os.Remove(stale)
+
+		assert.NoError(t, build(litepage.WithHardLinks(), litepage.WithFingerprint(".css")))
+		contents, err := os.ReadFile(stale)
+		assert.NoError(t, err)
+		assert.Equal(t, "stale", string(contents))
+		contents, err = os.ReadFile(filepath.Join(distDir, filepath.FromSlash(hashed)))
+		assert.NoError(t, err)
+		assert.Equal(t, files["css/main.css"], string(contents))
+	})
+
+	t.Run("Adds content security policies to hard linked headers without changing public files", func(t *testing.T) {
+		headers := filepath.Join(publicDir, "_headers")
+		assert.NoError(t, os.WriteFile(headers, []byte("/*\n  X-Frame-Options: DENY\n"), 0644))
+		defer os.Remove(headers)
+
+		for i := 0; i < 2; i++ {
+			assert.NoError(t, build(litepage.WithHardLinks(), litepage.WithCSP(litepage.CSP{Headers: true})))
+		}
+		contents, err := os.ReadFile(headers)
+		assert.NoError(t, err)
+		assert.Equal(t, "/*\n  X-Frame-Options: DENY\n", string(contents))
+		contents, err = os.ReadFile(filepath.Join(distDir, "_headers"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(contents), "Content-Security-Policy")
+	})
+
+	t.Run("Copies symbolic links as links", func(t *testing.T) {
+		assert.NoError(t, build(litepage.WithSymlinks(litepage.CopySymlinks)))
+		dest, err := os.Readlink(filepath.Join(distDir, "clips"))
+		assert.NoError(t, err)
+		assert.Equal(t, "video", dest)
+
+		t.Run("Skips them when precompressing", func(t *testing.T) {
+			assert.NoError(t, build(litepage.WithSymlinks(litepage.CopySymlinks), litepage.WithPrecompress(litepage.Precompress{MinSize: 1})))
+			_, err := os.Stat(filepath.Join(distDir, "clips.gz"))
+			assert.True(t, os.IsNotExist(err))
+		})
+	})
+
+	t.Run("Rejects symbolic links", func(t *testing.T) {
+		err := build(litepage.WithSymlinks(litepage.RejectSymlinks))
+		assert.ErrorContains(t, err, "could not copy '/clips': symbolic links are not allowed")
+	})
+}